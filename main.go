@@ -65,7 +65,7 @@ func main() {
 	api.InitCollectorController(metricsBackend, tsdbPublisher)
 	if setting.Alerting.Enabled {
 		alerting.Init(metricsBackend, tsdbPublisher)
-		alerting.Construct()
+		alerting.Construct(notifyShutdown)
 	}
 
 	if err := notifications.Init(); err != nil {
@@ -0,0 +1,67 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raintank/worldping-api/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBackfill(t *testing.T) {
+	Convey("When the dispatcher starts", t, func() {
+		setting.Alerting.Backfill = true
+		setting.Alerting.BackfillMaxAge = time.Hour
+		setting.Alerting.BackfillRate = 10
+		live := int64(100000)
+
+		Convey("with backfill disabled it should start at the current time", func() {
+			setting.Alerting.Backfill = false
+			bf, next := newBackfill(live, live-60)
+			So(next, ShouldEqual, live)
+			So(bf.active, ShouldBeFalse)
+			So(bf.limit(next, live+5), ShouldEqual, live+5)
+		})
+		Convey("when jobs have never been dispatched it should start at the current time", func() {
+			bf, next := newBackfill(live, 0)
+			So(next, ShouldEqual, live)
+			So(bf.active, ShouldBeFalse)
+		})
+		Convey("when no seconds were missed it should start at the current time", func() {
+			bf, next := newBackfill(live, live-1)
+			So(next, ShouldEqual, live)
+			So(bf.active, ShouldBeFalse)
+		})
+		Convey("when seconds were missed", func() {
+			bf, next := newBackfill(live, live-61)
+			So(next, ShouldEqual, live-60)
+			So(bf.active, ShouldBeTrue)
+
+			Convey("it should mark them as missed", func() {
+				So(bf.missed(live-60), ShouldBeTrue)
+				So(bf.missed(live-1), ShouldBeTrue)
+				So(bf.missed(live), ShouldBeFalse)
+			})
+			Convey("it should replay them at a bounded rate", func() {
+				So(bf.limit(next, live+1), ShouldEqual, next+9)
+				So(bf.limit(live-5, live+1), ShouldEqual, live+1)
+			})
+			Convey("it should count the replayed seconds and jobs", func() {
+				bf.dispatched(live-60, 3)
+				bf.dispatched(live-59, 2)
+				bf.dispatched(live, 4)
+				So(bf.seconds, ShouldEqual, 2)
+				So(bf.jobs, ShouldEqual, 5)
+			})
+			Convey("it should stop limiting once caught up", func() {
+				bf.caughtUp()
+				So(bf.active, ShouldBeFalse)
+				So(bf.limit(live, live+20), ShouldEqual, live+20)
+			})
+		})
+		Convey("when more seconds were missed than the max age", func() {
+			_, next := newBackfill(live, live-7200)
+			So(next, ShouldEqual, live-3600)
+		})
+	})
+}
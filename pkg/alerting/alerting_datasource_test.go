@@ -0,0 +1,155 @@
+package alerting
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGraphiteDatasource(t *testing.T) {
+	var reqs []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		reqs = append(reqs, r)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"target": "worldping.example_com.probe1.http.error_state", "datapoints": [[0,100],[1,110],[null,120]]}]`)
+	}))
+	defer server.Close()
+
+	Convey("When querying graphite", t, func() {
+		reqs = nil
+		ds := NewGraphiteDatasource(server.URL + "/")
+		res, err := ds.Query(&SeriesQuery{
+			OrgId:     3,
+			Endpoint:  "example_com",
+			CheckType: "http",
+			Metric:    "error_state",
+			Step:      10 * time.Second,
+			From:      time.Unix(100, 0),
+			To:        time.Unix(120, 0),
+		})
+		So(err, ShouldBeNil)
+		So(reqs, ShouldHaveLength, 1)
+		So(reqs[0].URL.Path, ShouldEqual, "/render")
+		So(reqs[0].Form.Get("target"), ShouldEqual, "worldping.example_com.*.http.error_state")
+		So(reqs[0].Form.Get("from"), ShouldEqual, "100")
+		So(reqs[0].Form.Get("until"), ShouldEqual, "120")
+		So(reqs[0].Header.Get("x-org-id"), ShouldEqual, "3")
+
+		So(res, ShouldHaveLength, 1)
+		So(res[0].Target, ShouldEqual, "worldping.example_com.probe1.http.error_state")
+		So(res[0].Datapoints, ShouldHaveLength, 3)
+	})
+}
+
+func TestPrometheusDatasource(t *testing.T) {
+	var reqs []*http.Request
+	response := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		reqs = append(reqs, r)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, response)
+	}))
+	defer server.Close()
+
+	query := &SeriesQuery{
+		OrgId:     3,
+		Endpoint:  "example_com",
+		CheckType: "http",
+		Metric:    "total",
+		Step:      10 * time.Second,
+		From:      time.Unix(100, 0),
+		To:        time.Unix(120, 0),
+	}
+
+	Convey("When querying prometheus", t, func() {
+		reqs = nil
+		ds := NewPrometheusDatasource(server.URL + "/")
+		response = `{"status": "success", "data": {"resultType": "matrix", "result": [
+			{"metric": {"__name__": "worldping_http_total", "endpoint": "example_com", "probe": "probe1"}, "values": [[100, "250.5"], [110, "600"], [120, "NaN"]]},
+			{"metric": {"__name__": "worldping_http_total", "endpoint": "example_com", "probe": "probe2"}, "values": [[110.5, "700"]]}
+		]}}`
+		res, err := ds.Query(query)
+		So(err, ShouldBeNil)
+		So(reqs, ShouldHaveLength, 1)
+		So(reqs[0].URL.Path, ShouldEqual, "/api/v1/query_range")
+		So(reqs[0].Form.Get("query"), ShouldEqual, `worldping_http_total{endpoint="example_com"}`)
+		So(reqs[0].Form.Get("start"), ShouldEqual, "100")
+		So(reqs[0].Form.Get("end"), ShouldEqual, "120")
+		So(reqs[0].Form.Get("step"), ShouldEqual, "10")
+		So(reqs[0].Header.Get("X-Scope-OrgID"), ShouldEqual, "3")
+
+		So(res, ShouldHaveLength, 2)
+		So(res[0].Target, ShouldEqual, "worldping.example_com.probe1.http.total")
+		So(res[0].Datapoints, ShouldHaveLength, 3)
+		So(res[0].Datapoints[0][0].String(), ShouldEqual, "250.5")
+		So(res[0].Datapoints[0][1].String(), ShouldEqual, "100")
+		So(res[0].Datapoints[2][0].String(), ShouldEqual, "null")
+		So(res[1].Target, ShouldEqual, "worldping.example_com.probe2.http.total")
+		So(res[1].Datapoints[0][1].String(), ShouldEqual, "110")
+
+		Convey("the results should be evaluated like graphite results", func() {
+			state, err := evalMetricThreshold(res, &m.CheckMetricThreshold{
+				Metric:     "total",
+				Comparison: m.ComparisonGreater,
+				Value:      500,
+				NumProbes:  2,
+				Steps:      1,
+				State:      m.EvalResultCrit,
+			})
+			So(err, ShouldBeNil)
+			So(state, ShouldEqual, m.EvalResultCrit)
+
+			series, err := newPreviewSeries(res)
+			So(err, ShouldBeNil)
+			So(series, ShouldHaveLength, 2)
+		})
+
+		Convey("query errors should be returned", func() {
+			response = `{"status": "error", "errorType": "bad_data", "error": "parse error"}`
+			_, err := ds.Query(query)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "parse error")
+		})
+
+		Convey("invalid responses should be returned as errors", func() {
+			response = `not json`
+			_, err := ds.Query(query)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("When evaluating a check against prometheus", t, func() {
+		reqs = nil
+		response = `{"status": "success", "data": {"resultType": "matrix", "result": [
+			{"metric": {"endpoint": "example_com", "probe": "probe1"}, "values": [[100, "1"], [110, "1"], [120, "1"]]}
+		]}}`
+		defaultDatasource := getDatasource()
+		alertDatasource = NewPrometheusDatasource(server.URL + "/")
+		defer func() { alertDatasource = defaultDatasource }()
+
+		check := &m.CheckForAlertDTO{
+			Id:        1,
+			OrgId:     3,
+			Slug:      "example_com",
+			Type:      "http",
+			Frequency: 10,
+			HealthSettings: &m.CheckHealthSettings{
+				NumProbes: 1,
+				Steps:     2,
+			},
+		}
+		preview, err := Preview(check, time.Unix(120, 0), time.Unix(120, 0))
+		So(err, ShouldBeNil)
+		So(reqs, ShouldHaveLength, 1)
+		So(reqs[0].Form.Get("query"), ShouldEqual, `worldping_http_error_state{endpoint="example_com"}`)
+		So(preview.Timeline, ShouldHaveLength, 1)
+		So(preview.Timeline[0].State, ShouldEqual, m.EvalResultCrit)
+	})
+}
@@ -0,0 +1,143 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raintank/met/helper"
+	m "github.com/raintank/worldping-api/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func escalationTestCheck(stateChange, escalated time.Time, policy *m.CheckEscalationPolicy) m.CheckForEscalationDTO {
+	return m.CheckForEscalationDTO{
+		CheckForAlertDTO: m.CheckForAlertDTO{
+			Id:          1,
+			OrgId:       1,
+			EndpointId:  1,
+			State:       m.EvalResultCrit,
+			StateChange: stateChange,
+			HealthSettings: &m.CheckHealthSettings{
+				NumProbes: 1,
+				Steps:     1,
+				Notifications: m.CheckNotificationSetting{
+					Enabled:    true,
+					Escalation: policy,
+				},
+			},
+		},
+		Escalated: escalated,
+	}
+}
+
+func TestEscalationDue(t *testing.T) {
+	now := time.Now()
+	policy := &m.CheckEscalationPolicy{After: 10, Repeat: 30, Addresses: "oncall@example.com"}
+
+	Convey("When a check has been critical for less than the escalation delay", t, func() {
+		check := escalationTestCheck(now.Add(-5*time.Minute), time.Time{}, policy)
+		_, due := escalationDue(&check, now)
+		So(due, ShouldBeFalse)
+	})
+	Convey("When a check has been critical for longer than the escalation delay", t, func() {
+		check := escalationTestCheck(now.Add(-15*time.Minute), time.Time{}, policy)
+		prev, due := escalationDue(&check, now)
+		So(due, ShouldBeTrue)
+		So(prev, ShouldResemble, check.StateChange)
+
+		Convey("it should not escalate again before the repeat interval", func() {
+			check.Escalated = now.Add(-5 * time.Minute)
+			_, due := escalationDue(&check, now)
+			So(due, ShouldBeFalse)
+		})
+		Convey("it should escalate again after the repeat interval", func() {
+			check.StateChange = now.Add(-time.Hour)
+			check.Escalated = now.Add(-31 * time.Minute)
+			prev, due := escalationDue(&check, now)
+			So(due, ShouldBeTrue)
+			So(prev, ShouldResemble, check.Escalated.Add(time.Second))
+		})
+		Convey("it should not repeat when repeat is not set", func() {
+			check.HealthSettings.Notifications.Escalation = &m.CheckEscalationPolicy{After: 10, Addresses: "oncall@example.com"}
+			check.Escalated = now.Add(-time.Hour)
+			check.StateChange = now.Add(-2 * time.Hour)
+			_, due := escalationDue(&check, now)
+			So(due, ShouldBeFalse)
+		})
+		Convey("it should escalate a new incident even if a previous one was escalated", func() {
+			check.Escalated = now.Add(-time.Hour)
+			check.StateChange = now.Add(-20 * time.Minute)
+			check.HealthSettings.Notifications.Escalation = &m.CheckEscalationPolicy{After: 10, Addresses: "oncall@example.com"}
+			_, due := escalationDue(&check, now)
+			So(due, ShouldBeTrue)
+		})
+		Convey("it should not escalate when notifications are disabled", func() {
+			check.HealthSettings.Notifications.Enabled = false
+			_, due := escalationDue(&check, now)
+			So(due, ShouldBeFalse)
+		})
+	})
+}
+
+func TestEscalator(t *testing.T) {
+	metrics, _ := helper.New(false, "", "standard", "worldping-api", "test")
+	Init(metrics, &mockPublisher{})
+	now := time.Now()
+	policy := &m.CheckEscalationPolicy{After: 10, Addresses: "oncall@example.com"}
+
+	Convey("When running the escalator", t, func() {
+		checks := []m.CheckForEscalationDTO{
+			escalationTestCheck(now.Add(-15*time.Minute), time.Time{}, policy),
+		}
+		claimed := true
+		var window *m.MaintenanceWindow
+		notified := make([]*m.AlertingJob, 0)
+		e := &escalator{
+			checks: func() ([]m.CheckForEscalationDTO, error) { return checks, nil },
+			mark: func(checkId int64, prev, ts time.Time) (bool, error) {
+				return claimed, nil
+			},
+			maintenance: func(orgId, endpointId int64, t time.Time) (*m.MaintenanceWindow, error) {
+				return window, nil
+			},
+			notify: func(job *m.AlertingJob) { notified = append(notified, job) },
+		}
+
+		Convey("it should notify the escalation targets", func() {
+			e.run(now)
+			So(notified, ShouldHaveLength, 1)
+			So(notified[0].Escalated, ShouldBeTrue)
+			So(notified[0].NewState, ShouldEqual, m.EvalResultCrit)
+			So(notified[0].TimeExec, ShouldResemble, now)
+		})
+		Convey("it should not notify if another scheduler claimed the escalation", func() {
+			claimed = false
+			e.run(now)
+			So(notified, ShouldHaveLength, 0)
+		})
+		Convey("it should not notify during a maintenance window", func() {
+			window = &m.MaintenanceWindow{Name: "upgrade"}
+			e.run(now)
+			So(notified, ShouldHaveLength, 0)
+		})
+	})
+}
+
+func TestEscalationPayload(t *testing.T) {
+	Convey("When building the payload of an escalation", t, func() {
+		now := time.Now()
+		check := escalationTestCheck(now.Add(-45*time.Minute), time.Time{}, nil)
+		check.Name = "example.com"
+		check.Type = "http"
+		job := &m.AlertingJob{
+			CheckForAlertDTO: &check.CheckForAlertDTO,
+			NewState:         m.EvalResultCrit,
+			TimeExec:         now,
+			Escalated:        true,
+		}
+		p := newNotificationPayload(job)
+		So(p.Escalated, ShouldBeTrue)
+		So(p.StateChange, ShouldResemble, check.StateChange)
+		So(p.Summary(), ShouldEqual, "http for example.com has been Critical for 45m0s")
+	})
+}
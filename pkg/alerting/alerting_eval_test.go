@@ -145,3 +145,237 @@ func TestAlertingEval(t *testing.T) {
 		), ShouldEqual, m.EvalResultCrit)
 	})
 }
+
+func checkCertExpiry(series []graphite.Series, numProbes int, settings map[string]interface{}) m.CheckEvalResult {
+	res := graphite.Response(series)
+	healthSettings := m.CheckHealthSettings{
+		NumProbes: numProbes,
+		Steps:     3,
+	}
+	result, err := evalCertExpiry(res, &healthSettings, settings)
+	So(err, ShouldBeNil)
+	return result
+}
+
+func TestAlertingEvalCertExpiry(t *testing.T) {
+	Convey("check cert expiry with default thresholds", t, func() {
+		settings := map[string]interface{}{"host": "example.com"}
+		So(checkCertExpiry([]graphite.Series{getSeries([]int{60, 59, 58})}, 1, settings), ShouldEqual, m.EvalResultOK)
+		So(checkCertExpiry([]graphite.Series{getSeries([]int{31, 30, 30})}, 1, settings), ShouldEqual, m.EvalResultWarn)
+		So(checkCertExpiry([]graphite.Series{getSeries([]int{8, 7, 7})}, 1, settings), ShouldEqual, m.EvalResultCrit)
+		So(checkCertExpiry([]graphite.Series{getSeries([]int{})}, 1, settings), ShouldEqual, m.EvalResultUnknown)
+	})
+	Convey("check cert expiry with custom thresholds and numProbes=2", t, func() {
+		settings := map[string]interface{}{"host": "example.com", "warnDays": 10.0, "critDays": 2.0}
+		So(checkCertExpiry([]graphite.Series{
+			getSeries([]int{20, 20, 20}),
+			getSeries([]int{9, 9, 9}),
+		}, 2, settings), ShouldEqual, m.EvalResultOK)
+		So(checkCertExpiry([]graphite.Series{
+			getSeries([]int{9, 9, 9}),
+			getSeries([]int{1, 1, 1}),
+		}, 2, settings), ShouldEqual, m.EvalResultWarn)
+		So(checkCertExpiry([]graphite.Series{
+			getSeries([]int{2, 2, 2}),
+			getSeries([]int{1, 1, 1}),
+		}, 2, settings), ShouldEqual, m.EvalResultCrit)
+	})
+}
+
+func checkWithWarning(series []graphite.Series, steps, numProbes, warnSteps, warnProbes int) m.CheckEvalResult {
+	res := graphite.Response(series)
+	healthSettings := m.CheckHealthSettings{
+		NumProbes: numProbes,
+		Steps:     steps,
+		Warning: &m.CheckHealthThreshold{
+			NumProbes: warnProbes,
+			Steps:     warnSteps,
+		},
+	}
+	result, err := eval(res, &healthSettings)
+	So(err, ShouldBeNil)
+	return result
+}
+
+func TestAlertingEvalWarning(t *testing.T) {
+	Convey("check steps=3, numProbes=2, warning steps=2, numProbes=1", t, func() {
+		So(checkWithWarning(
+			[]graphite.Series{
+				getSeries([]int{0, 0, 1}),
+				getSeries([]int{0, 0, 0}),
+			},
+			3, 2, 2, 1,
+		), ShouldEqual, m.EvalResultOK)
+
+		So(checkWithWarning(
+			[]graphite.Series{
+				getSeries([]int{0, 1, 1}),
+				getSeries([]int{0, 0, 0}),
+			},
+			3, 2, 2, 1,
+		), ShouldEqual, m.EvalResultWarn)
+
+		So(checkWithWarning(
+			[]graphite.Series{
+				getSeries([]int{1, 1, 1}),
+				getSeries([]int{0, 0, 0}),
+			},
+			3, 2, 2, 1,
+		), ShouldEqual, m.EvalResultWarn)
+
+		So(checkWithWarning(
+			[]graphite.Series{
+				getSeries([]int{1, 1, 1}),
+				getSeries([]int{1, 1, 1}),
+			},
+			3, 2, 2, 1,
+		), ShouldEqual, m.EvalResultCrit)
+	})
+}
+
+func getProbeSeries(probeSlug string, vals []int) graphite.Series {
+	s := getSeries(vals)
+	s.Target = fmt.Sprintf("worldping.example_com.%s.http.error_state", probeSlug)
+	return s
+}
+
+func TestAlertingEvalProbeConditions(t *testing.T) {
+	probes := map[string]*m.ProbeDTO{
+		"amsterdam": {Id: 1, Slug: "amsterdam", Tags: []string{"europe"}},
+		"london":    {Id: 2, Slug: "london", Tags: []string{"europe"}},
+		"frankfurt": {Id: 3, Slug: "frankfurt", Tags: []string{"europe"}},
+		"newyork":   {Id: 4, Slug: "newyork", Tags: []string{"america"}},
+		"dallas":    {Id: 5, Slug: "dallas", Tags: []string{"america"}},
+	}
+	evalConditions := func(series []graphite.Series, conditions ...m.CheckProbeCondition) m.CheckEvalResult {
+		healthSettings := &m.CheckHealthSettings{
+			NumProbes:  3,
+			Steps:      3,
+			Conditions: conditions,
+		}
+		result, err := evalWithConditions(graphite.Response(series), healthSettings, probes)
+		So(err, ShouldBeNil)
+		return result
+	}
+	twoEuropeFailing := []graphite.Series{
+		getProbeSeries("amsterdam", []int{1, 1, 1}),
+		getProbeSeries("london", []int{1, 1, 1}),
+		getProbeSeries("frankfurt", []int{0, 0, 0}),
+		getProbeSeries("newyork", []int{0, 0, 0}),
+		getProbeSeries("dallas", []int{0, 0, 0}),
+	}
+
+	Convey("When probes fail but the check threshold is not met", t, func() {
+		So(evalConditions(twoEuropeFailing), ShouldEqual, m.EvalResultOK)
+
+		Convey("a probe tag condition should make the check critical", func() {
+			So(evalConditions(twoEuropeFailing, m.CheckProbeCondition{ProbeTags: []string{"europe"}, NumProbes: 2}), ShouldEqual, m.EvalResultCrit)
+			So(evalConditions(twoEuropeFailing, m.CheckProbeCondition{ProbeTags: []string{"america"}, NumProbes: 1}), ShouldEqual, m.EvalResultOK)
+			So(evalConditions(twoEuropeFailing, m.CheckProbeCondition{ProbeTags: []string{"europe"}, NumProbes: 3}), ShouldEqual, m.EvalResultOK)
+		})
+		Convey("a probe id condition should make the check critical", func() {
+			So(evalConditions(twoEuropeFailing, m.CheckProbeCondition{ProbeIds: []int64{2}, NumProbes: 1}), ShouldEqual, m.EvalResultCrit)
+			So(evalConditions(twoEuropeFailing, m.CheckProbeCondition{ProbeIds: []int64{3, 4}, NumProbes: 1}), ShouldEqual, m.EvalResultOK)
+		})
+		Convey("any condition being met should make the check critical", func() {
+			So(evalConditions(twoEuropeFailing,
+				m.CheckProbeCondition{ProbeTags: []string{"america"}, NumProbes: 1},
+				m.CheckProbeCondition{ProbeIds: []int64{1}, NumProbes: 1},
+			), ShouldEqual, m.EvalResultCrit)
+		})
+		Convey("condition steps should be respected", func() {
+			series := []graphite.Series{
+				getProbeSeries("amsterdam", []int{0, 1, 1}),
+				getProbeSeries("newyork", []int{0, 0, 0}),
+			}
+			So(evalConditions(series, m.CheckProbeCondition{ProbeIds: []int64{1}, NumProbes: 1}), ShouldEqual, m.EvalResultOK)
+			So(evalConditions(series, m.CheckProbeCondition{ProbeIds: []int64{1}, NumProbes: 1, Steps: 2}), ShouldEqual, m.EvalResultCrit)
+		})
+		Convey("series of unknown probes should be ignored", func() {
+			series := []graphite.Series{
+				getProbeSeries("tokyo", []int{1, 1, 1}),
+				getProbeSeries("newyork", []int{0, 0, 0}),
+			}
+			So(evalConditions(series, m.CheckProbeCondition{ProbeTags: []string{"europe"}, NumProbes: 1}), ShouldEqual, m.EvalResultOK)
+		})
+	})
+
+	Convey("When validating probe conditions", t, func() {
+		settings := m.CheckHealthSettings{NumProbes: 1, Steps: 3}
+		settings.Conditions = []m.CheckProbeCondition{{NumProbes: 1}}
+		So(settings.Validate(), ShouldNotBeNil)
+		settings.Conditions = []m.CheckProbeCondition{{ProbeIds: []int64{1}}}
+		So(settings.Validate(), ShouldNotBeNil)
+		settings.Conditions = []m.CheckProbeCondition{{ProbeIds: []int64{1}, NumProbes: 1, Steps: 4}}
+		So(settings.Validate(), ShouldNotBeNil)
+		settings.Conditions = []m.CheckProbeCondition{{ProbeTags: []string{"europe"}, NumProbes: 1, Steps: 2}}
+		So(settings.Validate(), ShouldBeNil)
+	})
+}
+
+func checkMetricThreshold(series []graphite.Series, threshold m.CheckMetricThreshold) m.CheckEvalResult {
+	result, err := evalMetricThreshold(graphite.Response(series), &threshold)
+	So(err, ShouldBeNil)
+	return result
+}
+
+func TestAlertingEvalMetricThreshold(t *testing.T) {
+	Convey("check total > 500, steps=2, numProbes=1", t, func() {
+		threshold := m.CheckMetricThreshold{
+			Metric:     "total",
+			Comparison: m.ComparisonGreater,
+			Value:      500,
+			NumProbes:  1,
+			Steps:      2,
+			State:      m.EvalResultCrit,
+		}
+		So(checkMetricThreshold([]graphite.Series{getSeries([]int{100, 200, 300})}, threshold), ShouldEqual, m.EvalResultOK)
+		So(checkMetricThreshold([]graphite.Series{getSeries([]int{600, 200, 600})}, threshold), ShouldEqual, m.EvalResultOK)
+		So(checkMetricThreshold([]graphite.Series{getSeries([]int{100, 500, 600})}, threshold), ShouldEqual, m.EvalResultOK)
+		So(checkMetricThreshold([]graphite.Series{getSeries([]int{100, 501, 600})}, threshold), ShouldEqual, m.EvalResultCrit)
+		So(checkMetricThreshold([]graphite.Series{getSeries([]int{})}, threshold), ShouldEqual, m.EvalResultUnknown)
+
+		Convey("with a warning state", func() {
+			threshold.State = m.EvalResultWarn
+			So(checkMetricThreshold([]graphite.Series{getSeries([]int{600, 600, 600})}, threshold), ShouldEqual, m.EvalResultWarn)
+		})
+		Convey("with the gte comparison", func() {
+			threshold.Comparison = m.ComparisonGreaterOrEqual
+			So(checkMetricThreshold([]graphite.Series{getSeries([]int{100, 500, 600})}, threshold), ShouldEqual, m.EvalResultCrit)
+		})
+	})
+	Convey("check loss < 10, steps=1, numProbes=2", t, func() {
+		threshold := m.CheckMetricThreshold{
+			Metric:     "loss",
+			Comparison: m.ComparisonLess,
+			Value:      10,
+			NumProbes:  2,
+			Steps:      1,
+			State:      m.EvalResultCrit,
+		}
+		So(checkMetricThreshold([]graphite.Series{
+			getSeries([]int{5, 20}),
+			getSeries([]int{20, 20}),
+		}, threshold), ShouldEqual, m.EvalResultOK)
+		So(checkMetricThreshold([]graphite.Series{
+			getSeries([]int{5, 20}),
+			getSeries([]int{20, 5}),
+		}, threshold), ShouldEqual, m.EvalResultCrit)
+	})
+
+	Convey("When validating metric thresholds", t, func() {
+		threshold := m.CheckMetricThreshold{Metric: "total", Comparison: m.ComparisonGreater, Value: 500, NumProbes: 1, Steps: 1}
+		So(threshold.Validate(m.HTTP_CHECK), ShouldBeNil)
+		So(threshold.State, ShouldEqual, m.EvalResultCrit)
+		So(threshold.Validate(m.PING_CHECK), ShouldNotBeNil)
+		So(threshold.Validate(m.CERT_CHECK), ShouldNotBeNil)
+		threshold.Comparison = "eq"
+		So(threshold.Validate(m.HTTP_CHECK), ShouldNotBeNil)
+		threshold.Comparison = m.ComparisonLessOrEqual
+		threshold.Steps = 0
+		So(threshold.Validate(m.HTTP_CHECK), ShouldNotBeNil)
+		threshold.Steps = 1
+		threshold.State = m.EvalResultUnknown
+		So(threshold.Validate(m.HTTP_CHECK), ShouldNotBeNil)
+	})
+}
@@ -1,6 +1,7 @@
 package alerting
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -122,3 +123,122 @@ func TestExecutor(t *testing.T) {
 		So(count, ShouldEqual, 3)
 	})
 }
+
+// metricDatasource returns the same series for every query of a metric.
+type metricDatasource map[string]string
+
+func (d metricDatasource) Query(q *SeriesQuery) (graphite.Response, error) {
+	res := make(graphite.Response, 0)
+	body, ok := d[q.Metric]
+	if !ok {
+		return res, nil
+	}
+	err := json.Unmarshal([]byte(body), &res)
+	return res, err
+}
+
+func TestExecutorMetricThreshold(t *testing.T) {
+	ResultQueue = make(chan *m.AlertingJob, 1000)
+	defaultDatasource := getDatasource()
+	defer func() { alertDatasource = defaultDatasource }()
+
+	Convey("When executing a check with a metric threshold", t, func() {
+		cache, err := lru.New(1000)
+		So(err, ShouldBeNil)
+		job := &m.AlertingJob{
+			CheckForAlertDTO: &m.CheckForAlertDTO{
+				Id: 1,
+				HealthSettings: &m.CheckHealthSettings{
+					NumProbes: 1,
+					Steps:     3,
+					MetricThreshold: &m.CheckMetricThreshold{
+						Metric:     "total",
+						Comparison: m.ComparisonGreater,
+						Value:      100,
+						NumProbes:  1,
+						Steps:      2,
+						State:      m.EvalResultCrit,
+					},
+				},
+				Slug:      "test",
+				Type:      "http",
+				Frequency: 10,
+			},
+			LastPointTs: time.Unix(30, 0),
+			GeneratedAt: time.Now(),
+		}
+		latency := `[{"target": "probe1", "datapoints": [[200, 10], [200, 20], [200, 30]]}]`
+
+		Convey("a breached threshold should set the state", func() {
+			alertDatasource = metricDatasource{
+				"error_state": `[{"target": "probe1", "datapoints": [[0, 10], [0, 20], [0, 30]]}]`,
+				"total":       latency,
+			}
+			execute(job, cache)
+			So(job.NewState, ShouldEqual, m.EvalResultCrit)
+			So(job.TimeExec, ShouldHappenAfter, job.LastPointTs)
+		})
+		Convey("a backfilled job should be recorded at the time of its data", func() {
+			alertDatasource = metricDatasource{
+				"error_state": `[{"target": "probe1", "datapoints": [[0, 10], [0, 20], [0, 30]]}]`,
+				"total":       latency,
+			}
+			job.Backfill = true
+			execute(job, cache)
+			So(job.NewState, ShouldEqual, m.EvalResultCrit)
+			So(job.TimeExec.Unix(), ShouldEqual, job.LastPointTs.Unix())
+		})
+		Convey("without error_state data the state should be unknown", func() {
+			alertDatasource = metricDatasource{
+				"error_state": `[{"target": "probe1", "datapoints": [[null, 10], [null, 20], [null, 30]]}]`,
+				"total":       latency,
+			}
+			execute(job, cache)
+			So(job.NewState, ShouldEqual, m.EvalResultUnknown)
+		})
+	})
+}
+
+func TestExecutorCertExpiry(t *testing.T) {
+	ResultQueue = make(chan *m.AlertingJob, 1000)
+	defaultDatasource := getDatasource()
+	defer func() { alertDatasource = defaultDatasource }()
+
+	Convey("When executing a cert check", t, func() {
+		cache, err := lru.New(1000)
+		So(err, ShouldBeNil)
+		job := &m.AlertingJob{
+			CheckForAlertDTO: &m.CheckForAlertDTO{
+				Id: 1,
+				HealthSettings: &m.CheckHealthSettings{
+					NumProbes: 1,
+					Steps:     3,
+				},
+				Settings:  map[string]interface{}{"host": "example.com"},
+				Slug:      "test",
+				Type:      "cert",
+				Frequency: 10,
+			},
+			LastPointTs: time.Unix(30, 0),
+			GeneratedAt: time.Now(),
+		}
+		expiry := `[{"target": "probe1", "datapoints": [[20, 10], [20, 20], [20, 30]]}]`
+
+		Convey("an expiring certificate should set the state", func() {
+			alertDatasource = metricDatasource{
+				"error_state":       `[{"target": "probe1", "datapoints": [[0, 10], [0, 20], [0, 30]]}]`,
+				"days_until_expiry": expiry,
+			}
+			execute(job, cache)
+			So(job.NewState, ShouldEqual, m.EvalResultWarn)
+		})
+		Convey("without error_state data the state should be unknown", func() {
+			alertDatasource = metricDatasource{
+				"error_state":       `[{"target": "probe1", "datapoints": [[null, 10], [null, 20], [null, 30]]}]`,
+				"days_until_expiry": expiry,
+			}
+			execute(job, cache)
+			So(job.NewState, ShouldEqual, m.EvalResultUnknown)
+		})
+	})
+}
@@ -0,0 +1,87 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFlapDetector(t *testing.T) {
+	setting.Alerting.FlapThreshold = 4
+	setting.Alerting.FlapWindow = time.Hour
+
+	Convey("When recording check state changes", t, func() {
+		saved := make(map[int64]*m.CheckFlapState)
+		d := newFlapDetector()
+		d.load = func(checkId int64) (*m.CheckFlapState, error) {
+			if s, ok := saved[checkId]; ok {
+				return &m.CheckFlapState{Flapping: s.Flapping, Transitions: append([]int64{}, s.Transitions...)}, nil
+			}
+			return &m.CheckFlapState{Transitions: make([]int64, 0)}, nil
+		}
+		d.save = func(checkId int64, state *m.CheckFlapState) error {
+			saved[checkId] = &m.CheckFlapState{Flapping: state.Flapping, Transitions: append([]int64{}, state.Transitions...)}
+			return nil
+		}
+		start := time.Now()
+		job := func(offset time.Duration) *m.AlertingJob {
+			return &m.AlertingJob{
+				CheckForAlertDTO: &m.CheckForAlertDTO{Id: 1, OrgId: 1},
+				TimeExec:         start.Add(offset),
+			}
+		}
+
+		for i := 0; i < 3; i++ {
+			event, isFlapping, err := d.record(job(time.Duration(i)*time.Minute), true)
+			So(err, ShouldBeNil)
+			So(event, ShouldEqual, m.FlapNone)
+			So(isFlapping, ShouldBeFalse)
+		}
+
+		Convey("it should start flapping once the threshold is reached", func() {
+			event, isFlapping, err := d.record(job(3*time.Minute), true)
+			So(err, ShouldBeNil)
+			So(event, ShouldEqual, m.FlapStarted)
+			So(isFlapping, ShouldBeTrue)
+			So(saved[1].Flapping, ShouldBeTrue)
+			So(saved[1].Transitions, ShouldHaveLength, 4)
+
+			Convey("further state changes should not start flapping again", func() {
+				event, isFlapping, err := d.record(job(4*time.Minute), true)
+				So(err, ShouldBeNil)
+				So(event, ShouldEqual, m.FlapNone)
+				So(isFlapping, ShouldBeTrue)
+			})
+
+			Convey("it should stop flapping once the transitions leave the window", func() {
+				event, isFlapping, err := d.record(job(time.Hour+90*time.Second), false)
+				So(err, ShouldBeNil)
+				So(event, ShouldEqual, m.FlapStopped)
+				So(isFlapping, ShouldBeFalse)
+				So(saved[1].Flapping, ShouldBeFalse)
+				So(saved[1].Transitions, ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("transitions outside the window should not count", func() {
+			event, isFlapping, err := d.record(job(time.Hour+90*time.Second), true)
+			So(err, ShouldBeNil)
+			So(event, ShouldEqual, m.FlapNone)
+			So(isFlapping, ShouldBeFalse)
+			So(saved[1].Transitions, ShouldHaveLength, 2)
+		})
+	})
+
+	Convey("When flap detection is disabled", t, func() {
+		setting.Alerting.FlapThreshold = 0
+		d := newFlapDetector()
+		event, isFlapping, err := d.record(&m.AlertingJob{CheckForAlertDTO: &m.CheckForAlertDTO{Id: 1}}, true)
+		So(err, ShouldBeNil)
+		So(event, ShouldEqual, m.FlapNone)
+		So(isFlapping, ShouldBeFalse)
+		setting.Alerting.FlapThreshold = 4
+	})
+}
@@ -0,0 +1,137 @@
+package alerting
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var errTest = errors.New("test error")
+
+// fakeLease is a lease shared by several leaderElectors.
+type fakeLease struct {
+	owner   string
+	expires time.Time
+	err     error
+}
+
+func (l *fakeLease) acquire(id, owner string, now time.Time, ttl time.Duration) (bool, error) {
+	if l.err != nil {
+		return false, l.err
+	}
+	if l.owner != owner && now.Before(l.expires) {
+		return false, nil
+	}
+	l.owner = owner
+	l.expires = now.Add(ttl)
+	return true, nil
+}
+
+func (l *fakeLease) release(id, owner string) error {
+	if l.owner == owner {
+		l.expires = time.Time{}
+	}
+	return nil
+}
+
+type testScheduler struct {
+	started int
+	stop    <-chan struct{}
+}
+
+func (s *testScheduler) start(stop <-chan struct{}) {
+	s.started++
+	s.stop = stop
+}
+
+func (s *testScheduler) running() bool {
+	if s.stop == nil {
+		return false
+	}
+	select {
+	case <-s.stop:
+		return false
+	default:
+		return true
+	}
+}
+
+func newTestElector(owner string, lease *fakeLease, s *testScheduler) *leaderElector {
+	return &leaderElector{
+		owner:    owner,
+		ttl:      30 * time.Second,
+		interval: 10 * time.Second,
+		acquire:  lease.acquire,
+		release:  lease.release,
+		start:    s.start,
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	Convey("When two schedulers are enabled", t, func() {
+		lease := &fakeLease{}
+		sa := &testScheduler{}
+		sb := &testScheduler{}
+		a := newTestElector("a", lease, sa)
+		b := newTestElector("b", lease, sb)
+		now := time.Now()
+
+		a.tick(now)
+		b.tick(now)
+		So(sa.running(), ShouldBeTrue)
+		So(sb.running(), ShouldBeFalse)
+
+		Convey("the leader should keep the lease while it renews it", func() {
+			for i := 1; i <= 10; i++ {
+				now = now.Add(a.interval)
+				a.tick(now)
+				b.tick(now)
+			}
+			So(sa.started, ShouldEqual, 1)
+			So(sa.running(), ShouldBeTrue)
+			So(sb.running(), ShouldBeFalse)
+		})
+
+		Convey("a standby should take over within the ttl after the leader dies", func() {
+			died := now
+			for !sb.running() {
+				now = now.Add(b.interval)
+				b.tick(now)
+			}
+			So(now.Sub(died), ShouldBeLessThanOrEqualTo, b.ttl+b.interval)
+
+			Convey("and the old leader should step down if it comes back", func() {
+				a.tick(now)
+				So(sa.running(), ShouldBeFalse)
+				So(sb.running(), ShouldBeTrue)
+			})
+		})
+
+		Convey("the leader should step down before its lease expires if it can not renew it", func() {
+			lease.err = errTest
+			now = now.Add(a.interval)
+			a.tick(now)
+			So(sa.running(), ShouldBeTrue)
+			now = now.Add(a.interval)
+			a.tick(now)
+			So(sa.running(), ShouldBeFalse)
+			So(now.Before(lease.expires), ShouldBeTrue)
+		})
+
+		Convey("a standby should take over straight away when the leader shuts down", func() {
+			shutdown := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				a.Run(shutdown)
+				close(done)
+			}()
+			close(shutdown)
+			<-done
+			So(sa.running(), ShouldBeFalse)
+			b.tick(now)
+			So(sb.running(), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,105 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/raintank/schema.v1"
+)
+
+func memoryResult(orgId int, name string, ts int64, val float64) *schema.MetricData {
+	return &schema.MetricData{OrgId: orgId, Name: name, Time: ts, Value: val}
+}
+
+func TestMemoryDatasource(t *testing.T) {
+	query := &SeriesQuery{
+		OrgId:     1,
+		Endpoint:  "example_com",
+		CheckType: "http",
+		Metric:    "error_state",
+		Step:      10 * time.Second,
+		From:      time.Unix(100, 0),
+		To:        time.Unix(130, 0),
+	}
+
+	Convey("When buffering results in memory", t, func() {
+		ds := NewMemoryDatasource(3, time.Hour)
+		ds.Add([]*schema.MetricData{
+			memoryResult(1, "worldping.example_com.probe1.http.error_state", 100, 0),
+			memoryResult(1, "worldping.example_com.probe1.http.error_state", 110, 1),
+			memoryResult(1, "worldping.example_com.probe2.http.error_state", 110, 0),
+			memoryResult(1, "worldping.example_com.probe1.http.total", 110, 250),
+			memoryResult(2, "worldping.example_com.probe1.http.error_state", 110, 1),
+			memoryResult(1, "health.example_com.http.ok_state", 110, 1),
+		})
+
+		Convey("only the series of the queried org and metric are returned", func() {
+			res, err := ds.Query(query)
+			So(err, ShouldBeNil)
+			So(res, ShouldHaveLength, 2)
+			So(res[0].Target, ShouldEqual, "worldping.example_com.probe1.http.error_state")
+			So(res[0].Datapoints, ShouldHaveLength, 1)
+			So(res[0].Datapoints[0][0].String(), ShouldEqual, "1")
+			So(res[0].Datapoints[0][1].String(), ShouldEqual, "110")
+			So(res[1].Target, ShouldEqual, "worldping.example_com.probe2.http.error_state")
+		})
+
+		Convey("only the most recent points are kept, in time order", func() {
+			ds.Add([]*schema.MetricData{
+				memoryResult(1, "worldping.example_com.probe1.http.error_state", 130, 1),
+				memoryResult(1, "worldping.example_com.probe1.http.error_state", 120, 0),
+			})
+			q := *query
+			q.From = time.Unix(0, 0)
+			res, err := ds.Query(&q)
+			So(err, ShouldBeNil)
+			So(res[0].Datapoints, ShouldHaveLength, 3)
+			So(res[0].Datapoints[0][1].String(), ShouldEqual, "110")
+			So(res[0].Datapoints[1][1].String(), ShouldEqual, "120")
+			So(res[0].Datapoints[2][1].String(), ShouldEqual, "130")
+		})
+
+		Convey("unknown series return no data", func() {
+			q := *query
+			q.Endpoint = "other_com"
+			res, err := ds.Query(&q)
+			So(err, ShouldBeNil)
+			So(res, ShouldHaveLength, 0)
+		})
+
+		Convey("series that are no longer reported are pruned", func() {
+			ds.prune(time.Now().Add(time.Minute))
+			So(ds.series, ShouldHaveLength, 0)
+		})
+	})
+
+	Convey("When evaluating a check against buffered results", t, func() {
+		defaultDatasource := getDatasource()
+		alertDatasource = NewMemoryDatasource(10, time.Hour)
+		defer func() { alertDatasource = defaultDatasource }()
+
+		BufferResults([]*schema.MetricData{
+			memoryResult(1, "worldping.example_com.probe1.http.error_state", 110, 1),
+			memoryResult(1, "worldping.example_com.probe1.http.error_state", 120, 1),
+			memoryResult(1, "worldping.example_com.probe2.http.error_state", 110, 0),
+			memoryResult(1, "worldping.example_com.probe2.http.error_state", 120, 0),
+		})
+		check := &m.CheckForAlertDTO{
+			Id:        1,
+			OrgId:     1,
+			Slug:      "example_com",
+			Type:      "http",
+			Frequency: 10,
+			HealthSettings: &m.CheckHealthSettings{
+				NumProbes: 1,
+				Steps:     2,
+			},
+		}
+		preview, err := Preview(check, time.Unix(120, 0), time.Unix(120, 0))
+		So(err, ShouldBeNil)
+		So(preview.Timeline, ShouldHaveLength, 1)
+		So(preview.Timeline[0].State, ShouldEqual, m.EvalResultCrit)
+	})
+}
@@ -0,0 +1,302 @@
+package alerting
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordedRequest struct {
+	Method string
+	Body   map[string]interface{}
+}
+
+// newNotificationServer returns a local http server that records the json
+// body of each request and fails the first `failures` requests it receives.
+func newNotificationServer(failures int) (*httptest.Server, chan recordedRequest) {
+	requests := make(chan recordedRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		raw, _ := ioutil.ReadAll(r.Body)
+		body := make(map[string]interface{})
+		json.Unmarshal(raw, &body)
+		requests <- recordedRequest{Method: r.Method, Body: body}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return server, requests
+}
+
+func notificationJob(state m.CheckEvalResult, channels ...m.NotificationChannel) *m.AlertingJob {
+	return &m.AlertingJob{
+		CheckForAlertDTO: &m.CheckForAlertDTO{
+			Id:         2,
+			OrgId:      1,
+			EndpointId: 3,
+			Slug:       "test_com",
+			Name:       "test.com",
+			Type:       "http",
+			HealthSettings: &m.CheckHealthSettings{
+				NumProbes: 1,
+				Steps:     3,
+				Notifications: m.CheckNotificationSetting{
+					Enabled:  true,
+					Channels: channels,
+				},
+			},
+		},
+		NewState: state,
+		TimeExec: time.Now(),
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	setting.Alerting.NotificationRetries = 2
+	setting.Alerting.NotificationRetryDelay = time.Millisecond
+	setting.Alerting.NotificationTimeout = time.Second
+
+	Convey("When sending webhook notification", t, func() {
+		server, requests := newNotificationServer(0)
+		defer server.Close()
+		job := notificationJob(m.EvalResultCrit, m.NotificationChannel{
+			Type:     m.WebhookChannel,
+			Settings: map[string]interface{}{"url": server.URL, "method": "put"},
+		})
+		notifiers := getNotifiers(job)
+		So(notifiers, ShouldHaveLength, 1)
+		So(deliver(notifiers[0], job), ShouldBeNil)
+		req := <-requests
+		So(req.Method, ShouldEqual, "PUT")
+		So(req.Body["state"], ShouldEqual, "Critical")
+		So(req.Body["endpointSlug"], ShouldEqual, "test_com")
+		So(req.Body["checkId"], ShouldEqual, 2)
+
+		Convey("degraded state should not be sent by default", func() {
+			job := notificationJob(m.EvalResultWarn, job.HealthSettings.Notifications.Channels...)
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			So(requests, ShouldHaveLength, 0)
+		})
+		Convey("degraded state should be sent when a critical check improves", func() {
+			job := notificationJob(m.EvalResultWarn, job.HealthSettings.Notifications.Channels...)
+			job.State = m.EvalResultCrit
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			req := <-requests
+			So(req.Body["state"], ShouldEqual, "Warning")
+		})
+		Convey("degraded state should be sent when notifyWarning is enabled", func() {
+			job := notificationJob(m.EvalResultWarn, m.NotificationChannel{
+				Type:     m.WebhookChannel,
+				Settings: map[string]interface{}{"url": server.URL, "notifyWarning": "true"},
+			})
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			req := <-requests
+			So(req.Body["state"], ShouldEqual, "Warning")
+		})
+	})
+
+	Convey("When sending slack notification", t, func() {
+		server, requests := newNotificationServer(0)
+		defer server.Close()
+		job := notificationJob(m.EvalResultOK, m.NotificationChannel{
+			Type:     m.SlackChannel,
+			Settings: map[string]interface{}{"url": server.URL, "channel": "#ops"},
+		})
+		notifiers := getNotifiers(job)
+		So(notifiers, ShouldHaveLength, 1)
+		So(deliver(notifiers[0], job), ShouldBeNil)
+		req := <-requests
+		So(req.Method, ShouldEqual, "POST")
+		So(req.Body["text"], ShouldEqual, "http for test.com is OK")
+		So(req.Body["channel"], ShouldEqual, "#ops")
+
+		Convey("degraded state should not be sent by default", func() {
+			job := notificationJob(m.EvalResultWarn, job.HealthSettings.Notifications.Channels...)
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			So(requests, ShouldHaveLength, 0)
+		})
+		Convey("degraded state should be sent when notifyWarning is enabled", func() {
+			job := notificationJob(m.EvalResultWarn, m.NotificationChannel{
+				Type:     m.SlackChannel,
+				Settings: map[string]interface{}{"url": server.URL, "notifyWarning": "true"},
+			})
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			req := <-requests
+			So(req.Body["text"], ShouldEqual, "http for test.com is Warning")
+		})
+	})
+
+	Convey("When sending pagerduty notification", t, func() {
+		server, requests := newNotificationServer(0)
+		defer server.Close()
+		channel := m.NotificationChannel{
+			Type:     m.PagerDutyChannel,
+			Settings: map[string]interface{}{"url": server.URL, "routingKey": "abc123"},
+		}
+		job := notificationJob(m.EvalResultCrit, channel)
+		So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+		req := <-requests
+		So(req.Body["routing_key"], ShouldEqual, "abc123")
+		So(req.Body["event_action"], ShouldEqual, "trigger")
+		So(req.Body["dedup_key"], ShouldEqual, "worldping-1-2")
+
+		Convey("degraded state should not page", func() {
+			job := notificationJob(m.EvalResultWarn, channel)
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			So(requests, ShouldHaveLength, 0)
+		})
+		Convey("degraded state should resolve a critical incident", func() {
+			job := notificationJob(m.EvalResultWarn, channel)
+			job.State = m.EvalResultCrit
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			req := <-requests
+			So(req.Body["event_action"], ShouldEqual, "resolve")
+		})
+		Convey("recovery should resolve the incident", func() {
+			job := notificationJob(m.EvalResultOK, channel)
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			req := <-requests
+			So(req.Body["event_action"], ShouldEqual, "resolve")
+			So(req.Body["dedup_key"], ShouldEqual, "worldping-1-2")
+		})
+		Convey("flapping should not page", func() {
+			job := notificationJob(m.EvalResultOK, channel)
+			job.State = m.EvalResultCrit
+			job.Flap = m.FlapStarted
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			So(requests, ShouldHaveLength, 0)
+
+			Convey("settling critical should trigger the incident", func() {
+				job := notificationJob(m.EvalResultCrit, channel)
+				job.State = m.EvalResultOK
+				job.Flap = m.FlapStopped
+				So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+				req := <-requests
+				So(req.Body["event_action"], ShouldEqual, "trigger")
+				So(req.Body["dedup_key"], ShouldEqual, "worldping-1-2")
+			})
+			Convey("settling ok should resolve the incident", func() {
+				job := notificationJob(m.EvalResultOK, channel)
+				job.State = m.EvalResultCrit
+				job.Flap = m.FlapStopped
+				So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+				req := <-requests
+				So(req.Body["event_action"], ShouldEqual, "resolve")
+			})
+			Convey("settling degraded should resolve the incident", func() {
+				job := notificationJob(m.EvalResultWarn, channel)
+				job.State = m.EvalResultOK
+				job.Flap = m.FlapStopped
+				So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+				req := <-requests
+				So(req.Body["event_action"], ShouldEqual, "resolve")
+			})
+		})
+	})
+
+	Convey("When sending flapping notification", t, func() {
+		server, requests := newNotificationServer(0)
+		defer server.Close()
+		channel := m.NotificationChannel{
+			Type:     m.SlackChannel,
+			Settings: map[string]interface{}{"url": server.URL},
+		}
+		job := notificationJob(m.EvalResultCrit, channel)
+		job.Flap = m.FlapStarted
+		So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+		req := <-requests
+		So(req.Body["text"], ShouldEqual, "http for test.com is flapping")
+
+		Convey("escalations should include how long the check has been critical", func() {
+			job := notificationJob(m.EvalResultCrit, channel)
+			job.Escalated = true
+			job.StateChange = job.TimeExec.Add(-95 * time.Second)
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			req := <-requests
+			So(req.Body["text"], ShouldEqual, "http for test.com has been Critical for 1m0s")
+		})
+		Convey("backfilled state changes should include when they happened", func() {
+			job := notificationJob(m.EvalResultCrit, channel)
+			job.Backfill = true
+			job.TimeExec = time.Unix(1500000000, 0)
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			req := <-requests
+			So(req.Body["text"], ShouldEqual, "http for test.com was Critical at 2017-07-14T02:40:00Z")
+		})
+		Convey("stopped flapping should include the current state", func() {
+			job := notificationJob(m.EvalResultOK, channel)
+			job.Flap = m.FlapStopped
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			req := <-requests
+			So(req.Body["text"], ShouldEqual, "http for test.com is no longer flapping and is OK")
+		})
+	})
+
+	Convey("When delivery fails", t, func() {
+		Convey("it should be retried", func() {
+			server, requests := newNotificationServer(2)
+			defer server.Close()
+			job := notificationJob(m.EvalResultCrit, m.NotificationChannel{
+				Type:     m.WebhookChannel,
+				Settings: map[string]interface{}{"url": server.URL},
+			})
+			So(deliver(getNotifiers(job)[0], job), ShouldBeNil)
+			So(requests, ShouldHaveLength, 1)
+		})
+		Convey("it should give up after the configured retries", func() {
+			server, requests := newNotificationServer(3)
+			defer server.Close()
+			job := notificationJob(m.EvalResultCrit, m.NotificationChannel{
+				Type:     m.WebhookChannel,
+				Settings: map[string]interface{}{"url": server.URL},
+			})
+			So(deliver(getNotifiers(job)[0], job), ShouldNotBeNil)
+			So(requests, ShouldHaveLength, 0)
+		})
+	})
+
+	Convey("When check has legacy email addresses", t, func() {
+		job := notificationJob(m.EvalResultCrit)
+		job.HealthSettings.Notifications.Addresses = "a@example.com, ,b@example.com"
+		notifiers := getNotifiers(job)
+		So(notifiers, ShouldHaveLength, 1)
+		So(notifiers[0].Type(), ShouldEqual, m.EmailChannel)
+		So(notifiers[0].(*emailNotifier).addresses, ShouldResemble, []string{"a@example.com", "b@example.com"})
+	})
+}
+
+func TestNotificationChannelValidate(t *testing.T) {
+	Convey("When validating notification channels", t, func() {
+		valid := []m.NotificationChannel{
+			{Type: m.EmailChannel, Settings: map[string]interface{}{"addresses": "a@example.com"}},
+			{Type: m.WebhookChannel, Settings: map[string]interface{}{"url": "https://example.com/hook", "method": "POST"}},
+			{Type: m.SlackChannel, Settings: map[string]interface{}{"url": "https://hooks.slack.com/services/x"}},
+			{Type: m.SlackChannel, Settings: map[string]interface{}{"url": "https://hooks.slack.com/services/x", "notifyWarning": "true"}},
+			{Type: m.PagerDutyChannel, Settings: map[string]interface{}{"routingKey": "abc"}},
+		}
+		for _, c := range valid {
+			So(c.Validate(), ShouldBeNil)
+		}
+		invalid := []m.NotificationChannel{
+			{Type: "sms", Settings: map[string]interface{}{}},
+			{Type: m.WebhookChannel},
+			{Type: m.WebhookChannel, Settings: map[string]interface{}{"url": "ftp://example.com"}},
+			{Type: m.WebhookChannel, Settings: map[string]interface{}{"url": "http://example.com", "method": "GET"}},
+			{Type: m.SlackChannel, Settings: map[string]interface{}{"url": 1.0}},
+			{Type: m.WebhookChannel, Settings: map[string]interface{}{"url": "http://example.com", "notifyWarning": "yes"}},
+			{Type: m.PagerDutyChannel, Settings: map[string]interface{}{"routingKey": ""}},
+		}
+		for _, c := range invalid {
+			So(c.Validate(), ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package alerting
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"bosun.org/graphite"
+	m "github.com/raintank/worldping-api/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type previewTransport struct {
+	targets []string
+}
+
+func (p *previewTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.ParseForm()
+	p.targets = append(p.targets, req.Form["target"]...)
+	response := &http.Response{
+		Header:     make(http.Header),
+		Request:    req,
+		StatusCode: http.StatusOK,
+	}
+	response.Header.Set("Content-Type", "application/json")
+	responseBody := `
+	[
+		{"target": "probe1", "datapoints": [[0,100],[0,110],[0,120],[0,130],[1,140],[1,150],[1,160],[0,170],[0,180],[0,190],[0,200]]},
+		{"target": "probe2", "datapoints": [[0,100],[0,110],[null,120],[0,130],[0,140],[0,150],[0,160],[0,170],[0,180],[0,190],[0,200]]}
+	]`
+	response.Body = ioutil.NopCloser(strings.NewReader(responseBody))
+	return response, nil
+}
+
+func TestAlertPreview(t *testing.T) {
+	transport := &previewTransport{}
+	defaultTransport := graphite.DefaultClient.Transport
+	graphite.DefaultClient.Transport = transport
+	defer func() { graphite.DefaultClient.Transport = defaultTransport }()
+
+	Convey("When previewing alerts for a check", t, func() {
+		check := &m.CheckForAlertDTO{
+			Id:        1,
+			OrgId:     1,
+			Slug:      "example_com",
+			Type:      "http",
+			Frequency: 10,
+			HealthSettings: &m.CheckHealthSettings{
+				NumProbes: 1,
+				Steps:     2,
+				Notifications: m.CheckNotificationSetting{
+					Enabled:   true,
+					Addresses: "oncall@example.com",
+				},
+			},
+		}
+		preview, err := Preview(check, time.Unix(120, 0), time.Unix(200, 0))
+		So(err, ShouldBeNil)
+		So(transport.targets[len(transport.targets)-1], ShouldEqual, "worldping.example_com.*.http.error_state")
+		So(preview.Evaluations, ShouldEqual, 9)
+		So(preview.Timeline, ShouldHaveLength, 3)
+		So(preview.Timeline[0].Timestamp.Unix(), ShouldEqual, 120)
+		So(preview.Timeline[0].State, ShouldEqual, m.EvalResultOK)
+		So(preview.Timeline[1].Timestamp.Unix(), ShouldEqual, 150)
+		So(preview.Timeline[1].State, ShouldEqual, m.EvalResultCrit)
+		So(preview.Timeline[2].Timestamp.Unix(), ShouldEqual, 170)
+		So(preview.Timeline[2].State, ShouldEqual, m.EvalResultOK)
+
+		So(preview.Notifications, ShouldHaveLength, 2)
+		So(preview.Notifications[0].PrevState, ShouldEqual, m.EvalResultOK)
+		So(preview.Notifications[0].State, ShouldEqual, m.EvalResultCrit)
+		So(preview.Notifications[0].Targets, ShouldResemble, []string{"email:oncall@example.com"})
+
+		Convey("more steps should not go critical", func() {
+			check.HealthSettings.Steps = 4
+			preview, err := Preview(check, time.Unix(120, 0), time.Unix(200, 0))
+			So(err, ShouldBeNil)
+			So(preview.Timeline, ShouldHaveLength, 1)
+			So(preview.Notifications, ShouldHaveLength, 0)
+		})
+		Convey("a metric threshold should be evaluated", func() {
+			check.HealthSettings.Steps = 4
+			check.HealthSettings.MetricThreshold = &m.CheckMetricThreshold{
+				Metric:     "total",
+				Comparison: m.ComparisonGreaterOrEqual,
+				Value:      1,
+				NumProbes:  1,
+				Steps:      2,
+				State:      m.EvalResultWarn,
+			}
+			preview, err := Preview(check, time.Unix(120, 0), time.Unix(200, 0))
+			So(err, ShouldBeNil)
+			So(transport.targets[len(transport.targets)-1], ShouldEqual, "worldping.example_com.*.http.total")
+			So(preview.Timeline, ShouldHaveLength, 3)
+			So(preview.Timeline[1].Timestamp.Unix(), ShouldEqual, 150)
+			So(preview.Timeline[1].State, ShouldEqual, m.EvalResultWarn)
+			So(preview.Timeline[2].State, ShouldEqual, m.EvalResultOK)
+		})
+		Convey("disabled notifications should not be sent", func() {
+			check.HealthSettings.Notifications.Enabled = false
+			preview, err := Preview(check, time.Unix(120, 0), time.Unix(200, 0))
+			So(err, ShouldBeNil)
+			So(preview.Timeline, ShouldHaveLength, 3)
+			So(preview.Notifications, ShouldHaveLength, 0)
+		})
+		Convey("too large a range should be rejected", func() {
+			_, err := Preview(check, time.Unix(0, 0), time.Unix(10*m.MaxAlertPreviewEvaluations, 0))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,80 @@
+package alerting
+
+import (
+	"time"
+
+	"github.com/raintank/worldping-api/pkg/log"
+	"github.com/raintank/worldping-api/pkg/setting"
+)
+
+// backfill tracks the replay of the seconds that were missed while no
+// scheduler was running.  Missed seconds are dispatched at most
+// setting.Alerting.BackfillRate per second, until the dispatcher has caught up.
+type backfill struct {
+	// live is the first timestamp that was not missed.
+	live    int64
+	active  bool
+	seconds int64
+	jobs    int64
+	started time.Time
+}
+
+// newBackfill returns the backfill for a dispatcher starting at live, and the
+// first timestamp to dispatch.  lastDispatched is the last timestamp
+// dispatched by any scheduler, or 0 if unknown.
+func newBackfill(live, lastDispatched int64) (*backfill, int64) {
+	b := &backfill{live: live}
+	if !setting.Alerting.Backfill || lastDispatched == 0 || lastDispatched+1 >= live {
+		return b, live
+	}
+	start := lastDispatched + 1
+	oldest := live - int64(setting.Alerting.BackfillMaxAge/time.Second)
+	if start < oldest {
+		log.Warn("Alerting: %d seconds were missed, only the last %d will be backfilled.", live-start, live-oldest)
+		start = oldest
+	}
+	if start < live {
+		log.Info("Alerting: backfilling %d missed seconds, from %d to %d.", live-start, start, live-1)
+		b.active = true
+		b.started = time.Now()
+	}
+	return b, start
+}
+
+// limit returns the last timestamp that may be dispatched in this tick, when
+// the dispatcher is at next and last is the latest timestamp due.
+func (b *backfill) limit(next, last int64) int64 {
+	if !b.active {
+		return last
+	}
+	if max := next + int64(setting.Alerting.BackfillRate) - 1; max < last {
+		return max
+	}
+	return last
+}
+
+// missed returns true if ts was missed while no scheduler was running.
+func (b *backfill) missed(ts int64) bool {
+	return ts < b.live
+}
+
+// dispatched records that jobs were dispatched for ts.
+func (b *backfill) dispatched(ts int64, jobs int) {
+	if !b.active || ts >= b.live {
+		return
+	}
+	b.seconds++
+	b.jobs += int64(jobs)
+	dispatcherBackfillSeconds.Inc(1)
+	dispatcherBackfillJobs.Inc(int64(jobs))
+}
+
+// caughtUp is called when the dispatcher has dispatched all the timestamps
+// due, and logs a summary of the backfill once it has completed.
+func (b *backfill) caughtUp() {
+	if !b.active {
+		return
+	}
+	b.active = false
+	log.Info("Alerting: backfill complete. %d jobs dispatched for %d missed seconds in %s.", b.jobs, b.seconds, time.Since(b.started))
+}
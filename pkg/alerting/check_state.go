@@ -1,12 +1,10 @@
 package alerting
 
 import (
-	"strings"
 	"time"
 
 	"github.com/raintank/worldping-api/pkg/log"
 	m "github.com/raintank/worldping-api/pkg/models"
-	"github.com/raintank/worldping-api/pkg/services/notifications"
 	"github.com/raintank/worldping-api/pkg/services/sqlstore"
 )
 
@@ -40,8 +38,32 @@ func storeResults(stateChanges chan *m.AlertingJob) {
 				break
 			}
 			log.Debug("updated state of %d checks in batch. %d resutled in stateChange.", len(buf), len(results))
+			changed := make(map[*m.AlertingJob]struct{}, len(results))
 			for _, job := range results {
-				stateChanges <- job
+				changed[job] = struct{}{}
+			}
+			for _, job := range buf {
+				_, stateChanged := changed[job]
+				event, isFlapping, err := flapping.record(job, stateChanged)
+				if err != nil {
+					log.Error(3, "failed to update flap state of check. OrgId: %d monitorId: %d. %s", job.OrgId, job.Id, err)
+				}
+				job.Flap = event
+				switch event {
+				case m.FlapStarted:
+					flapStarted.Inc(1)
+				case m.FlapStopped:
+					flapStopped.Inc(1)
+				}
+				if event == m.FlapNone && stateChanged && isFlapping {
+					// while flapping, individual state changes are not notified.
+					log.Debug("suppressing state change of flapping check. OrgId: %d monitorId: %d state: %s", job.OrgId, job.Id, job.NewState.String())
+					flapSuppressed.Inc(1)
+					continue
+				}
+				if stateChanged || event != m.FlapNone {
+					stateChanges <- job
+				}
 			}
 
 			buf = buf[:0]
@@ -57,44 +79,29 @@ func ProcessResult(job *m.AlertingJob) {
 
 func handleStateChange(c chan *m.AlertingJob) {
 	for job := range c {
-		log.Debug("state change: orgId=%d, monitorId=%d, endpointSlug=%s, state=%s", job.OrgId, job.Id, job.Slug, job.NewState.String())
-		if job.HealthSettings.Notifications.Enabled {
-			emails := strings.Split(job.HealthSettings.Notifications.Addresses, ",")
-			if len(emails) < 1 {
-				log.Debug("no email addresses provided. OrgId: %d monitorId: %d", job.OrgId, job.Id)
-			} else {
-				emailTo := make([]string, 0)
-				for _, email := range emails {
-					email := strings.TrimSpace(email)
-					if email == "" {
-						continue
-					}
-					log.Info("sending email. addr=%s, orgId=%d, monitorId=%d, endpointSlug=%s, state=%s", email, job.OrgId, job.Id, job.Slug, job.NewState.String())
-					emailTo = append(emailTo, email)
-				}
-				if len(emailTo) == 0 {
-					continue
-				}
-				sendCmd := m.SendEmailCommand{
-					To:       emailTo,
-					Template: "alerting_notification.html",
-					Data: map[string]interface{}{
-						"EndpointId":   job.EndpointId,
-						"EndpointName": job.Name,
-						"EndpointSlug": job.Slug,
-						"Settings":     job.Settings,
-						"CheckType":    job.Type,
-						"State":        job.NewState.String(),
-						"TimeLastData": job.LastPointTs, // timestamp of the most recent data used
-						"TimeExec":     job.TimeExec,    // when we executed the alerting rule and made the determination
-					},
-				}
-				go func(sendCmd *m.SendEmailCommand, job *m.AlertingJob) {
-					if err := notifications.SendEmail(sendCmd); err != nil {
-						log.Error(3, "failed to send email to %s. OrgId: %d monitorId: %d due to: %s", sendCmd.To, job.OrgId, job.Id, err)
-					}
-				}(&sendCmd, job)
+		window, err := sqlstore.GetActiveMaintenanceWindow(job.OrgId, job.EndpointId, job.TimeExec)
+		if err != nil {
+			log.Error(3, "failed to get maintenance windows. OrgId: %d monitorId: %d. %s", job.OrgId, job.Id, err)
+		}
+		job.MaintenanceWindow = window
+		if window != nil {
+			log.Info("state change during maintenance window %q: orgId=%d, monitorId=%d, endpointSlug=%s, state=%s, flap=%d", window.Name, job.OrgId, job.Id, job.Slug, job.NewState.String(), job.Flap)
+			if !window.Notify {
+				maintenanceSuppressed.Inc(1)
+				continue
 			}
+		} else {
+			log.Debug("state change: orgId=%d, monitorId=%d, endpointSlug=%s, state=%s, flap=%d", job.OrgId, job.Id, job.Slug, job.NewState.String(), job.Flap)
+		}
+		if !job.HealthSettings.Notifications.Enabled {
+			continue
+		}
+		for _, n := range getNotifiers(job) {
+			go func(n Notifier, job *m.AlertingJob) {
+				if err := deliver(n, job); err != nil {
+					log.Error(3, "failed to send %s notification. OrgId: %d monitorId: %d due to: %s", n.Type(), job.OrgId, job.Id, err)
+				}
+			}(n, job)
 		}
 	}
 }
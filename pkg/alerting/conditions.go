@@ -0,0 +1,91 @@
+package alerting
+
+import (
+	"strings"
+
+	"bosun.org/graphite"
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+)
+
+// getProbesBySlug returns the probes visible to the org, including their
+// org specific tags, keyed by slug.
+var getProbesBySlug = func(orgId int64) (map[string]*m.ProbeDTO, error) {
+	probes, err := sqlstore.GetProbes(&m.GetProbesQuery{OrgId: orgId})
+	if err != nil {
+		return nil, err
+	}
+	bySlug := make(map[string]*m.ProbeDTO, len(probes))
+	for i := range probes {
+		bySlug[probes[i].Slug] = &probes[i]
+	}
+	return bySlug, nil
+}
+
+// probeSlugFromTarget returns the probe slug of an error_state series, which
+// is named worldping.<endpoint slug>.<probe slug>.<check type>.error_state.
+func probeSlugFromTarget(target string) string {
+	parts := strings.Split(target, ".")
+	if len(parts) < 5 {
+		return ""
+	}
+	return parts[2]
+}
+
+// evalWithConditions evaluates the health settings, including any probe
+// conditions, against the error_state series of each probe.  probes are
+// only needed when there are conditions.
+func evalWithConditions(res graphite.Response, healthSettings *m.CheckHealthSettings, probes map[string]*m.ProbeDTO) (m.CheckEvalResult, error) {
+	state, err := eval(res, healthSettings)
+	if err != nil || state == m.EvalResultCrit || state == m.EvalResultUnknown {
+		return state, err
+	}
+	met, err := evalProbeConditions(res, healthSettings, probes)
+	if err != nil {
+		return m.EvalResultUnknown, err
+	}
+	if met {
+		return m.EvalResultCrit, nil
+	}
+	return state, nil
+}
+
+// evalProbeConditions returns true if any of the probe conditions of the
+// health settings is met.  Series from probes that are not known are
+// ignored.
+func evalProbeConditions(res graphite.Response, healthSettings *m.CheckHealthSettings, probes map[string]*m.ProbeDTO) (bool, error) {
+	if len(healthSettings.Conditions) == 0 {
+		return false, nil
+	}
+	// the failing streak of each known probe.
+	streaks := make(map[*m.ProbeDTO]int)
+	for _, ep := range res {
+		probe, ok := probes[probeSlugFromTarget(ep.Target)]
+		if !ok {
+			continue
+		}
+		streak, _, err := failingStreak(ep)
+		if err != nil {
+			return false, err
+		}
+		streaks[probe] = streak
+	}
+
+	for i := range healthSettings.Conditions {
+		c := &healthSettings.Conditions[i]
+		steps := c.Steps
+		if steps == 0 {
+			steps = healthSettings.Steps
+		}
+		failing := 0
+		for probe, streak := range streaks {
+			if c.Matches(probe) && streak >= steps {
+				failing++
+			}
+		}
+		if failing >= c.NumProbes {
+			return true, nil
+		}
+	}
+	return false, nil
+}
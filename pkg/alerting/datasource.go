@@ -0,0 +1,206 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bosun.org/graphite"
+	"github.com/raintank/worldping-api/pkg/log"
+	"github.com/raintank/worldping-api/pkg/setting"
+)
+
+// SeriesQuery describes the series of a metric reported by all probes for a
+// check of an endpoint.
+type SeriesQuery struct {
+	OrgId     int64
+	Endpoint  string // slug of the endpoint
+	CheckType string
+	Metric    string
+	Step      time.Duration // the frequency of the check
+	From      time.Time
+	To        time.Time
+}
+
+func (q *SeriesQuery) String() string {
+	return fmt.Sprintf("org=%d target=%s from=%d until=%d", q.OrgId, q.target("*"), q.From.Unix(), q.To.Unix())
+}
+
+// target returns the graphite name of the series reported by a probe.
+func (q *SeriesQuery) target(probe string) string {
+	return fmt.Sprintf("worldping.%s.%s.%s.%s", q.Endpoint, probe, strings.ToLower(q.CheckType), q.Metric)
+}
+
+// Datasource is a TSDB that alerts are evaluated against.
+type Datasource interface {
+	// Query returns a series for each probe, with the target of each series
+	// set to its graphite name, worldping.<endpoint>.<probe>.<checkType>.<metric>,
+	// and each point as [value, unix timestamp].
+	Query(q *SeriesQuery) (graphite.Response, error)
+}
+
+var (
+	alertDatasource Datasource
+	datasourceOnce  sync.Once
+)
+
+// getDatasource returns the datasource selected in the alerting settings.
+func getDatasource() Datasource {
+	datasourceOnce.Do(func() {
+		if alertDatasource == nil {
+			alertDatasource = NewDatasource()
+		}
+	})
+	return alertDatasource
+}
+
+func NewDatasource() Datasource {
+	switch setting.Alerting.Datasource {
+	case "prometheus":
+		return NewPrometheusDatasource(setting.Alerting.PrometheusUrl)
+	case "memory":
+		return NewMemoryDatasource(setting.Alerting.MemoryBufferSize, setting.Alerting.MemoryBufferRetention)
+	default:
+		return NewGraphiteDatasource(setting.Alerting.GraphiteUrl)
+	}
+}
+
+// GraphiteDatasource queries the render API of graphite.
+type GraphiteDatasource struct {
+	Url string
+}
+
+func NewGraphiteDatasource(url string) *GraphiteDatasource {
+	return &GraphiteDatasource{Url: url}
+}
+
+func (g *GraphiteDatasource) Query(q *SeriesQuery) (graphite.Response, error) {
+	headers := make(http.Header)
+	headers.Add("x-org-id", fmt.Sprintf("%d", q.OrgId))
+	req := graphite.Request{
+		Start:   &q.From,
+		End:     &q.To,
+		Targets: []string{q.target("*")},
+	}
+	log.Debug("Alerting: querying graphite with /render?target=%s&from=%d&until=%d", req.Targets[0], req.Start.Unix(), req.End.Unix())
+	return req.Query(g.Url+"render", headers)
+}
+
+// PrometheusDatasource queries the range query API of Prometheus, or of a
+// Prometheus compatible TSDB.  Metrics are expected to be named
+// worldping_<checkType>_<metric> with "endpoint" and "probe" labels holding
+// the slugs of the endpoint and probe.  The org id is sent in the
+// X-Scope-OrgID header used by multi-tenant implementations.
+type PrometheusDatasource struct {
+	Url    string
+	Client *http.Client
+}
+
+func NewPrometheusDatasource(url string) *PrometheusDatasource {
+	return &PrometheusDatasource{
+		Url:    url,
+		Client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+type prometheusResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string   `json:"metric"`
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+func (p *PrometheusDatasource) Query(q *SeriesQuery) (graphite.Response, error) {
+	step := q.Step
+	if step < time.Second {
+		step = time.Second
+	}
+	query := fmt.Sprintf("worldping_%s_%s{endpoint=%q}", strings.ToLower(q.CheckType), q.Metric, q.Endpoint)
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(q.From.Unix(), 10))
+	params.Set("end", strconv.FormatInt(q.To.Unix(), 10))
+	params.Set("step", strconv.FormatInt(int64(step/time.Second), 10))
+	log.Debug("Alerting: querying prometheus with /api/v1/query_range?%s", params.Encode())
+
+	req, err := http.NewRequest("GET", p.Url+"api/v1/query_range?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Scope-OrgID", fmt.Sprintf("%d", q.OrgId))
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result prometheusResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("prometheus returned invalid response. status %d: %s", resp.StatusCode, err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed. %s: %s", result.ErrorType, result.Error)
+	}
+	if result.Data.ResultType != "matrix" {
+		return nil, fmt.Errorf("prometheus returned unexpected result type %q", result.Data.ResultType)
+	}
+
+	res := make(graphite.Response, 0, len(result.Data.Result))
+	for _, r := range result.Data.Result {
+		serie := graphite.Series{
+			Target:     q.target(r.Metric["probe"]),
+			Datapoints: make([]graphite.DataPoint, 0, len(r.Values)),
+		}
+		for _, v := range r.Values {
+			dp, err := prometheusDataPoint(v)
+			if err != nil {
+				return nil, fmt.Errorf("prometheus returned invalid value in series %s. %s", serie.Target, err)
+			}
+			serie.Datapoints = append(serie.Datapoints, dp)
+		}
+		res = append(res, serie)
+	}
+	return res, nil
+}
+
+// prometheusDataPoint converts a [timestamp, "value"] pair returned by
+// prometheus to a graphite [value, timestamp] pair.  NaN values, which
+// prometheus uses for missing data, are converted to nulls.
+func prometheusDataPoint(v []json.RawMessage) (graphite.DataPoint, error) {
+	if len(v) != 2 {
+		return nil, fmt.Errorf("expected [timestamp, value] pair")
+	}
+	var ts float64
+	if err := json.Unmarshal(v[0], &ts); err != nil {
+		return nil, err
+	}
+	var val string
+	if err := json.Unmarshal(v[1], &val); err != nil {
+		return nil, err
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return nil, err
+	}
+	value := json.Number("null")
+	if !math.IsNaN(f) && !math.IsInf(f, 0) {
+		value = json.Number(strconv.FormatFloat(f, 'f', -1, 64))
+	}
+	return graphite.DataPoint{value, json.Number(strconv.FormatInt(int64(ts), 10))}, nil
+}
@@ -0,0 +1,121 @@
+package alerting
+
+import (
+	"time"
+
+	"github.com/raintank/worldping-api/pkg/log"
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+	"github.com/raintank/worldping-api/pkg/setting"
+)
+
+// escalator periodically notifies the escalation targets of checks that
+// have stayed critical.  All of its state is read from the database, so
+// escalations continue across restarts, and the time of each escalation is
+// claimed with a conditional update so that only one scheduler sends it.
+type escalator struct {
+	checks      func() ([]m.CheckForEscalationDTO, error)
+	mark        func(checkId int64, prev, ts time.Time) (bool, error)
+	maintenance func(orgId, endpointId int64, t time.Time) (*m.MaintenanceWindow, error)
+	notify      func(job *m.AlertingJob)
+}
+
+func newEscalator() *escalator {
+	return &escalator{
+		checks:      sqlstore.GetChecksForEscalation,
+		mark:        sqlstore.MarkCheckEscalated,
+		maintenance: sqlstore.GetActiveMaintenanceWindow,
+		notify:      notifyEscalation,
+	}
+}
+
+func escalateChecks(stop <-chan struct{}) {
+	e := newEscalator()
+	ticker := time.NewTicker(setting.Alerting.EscalationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			e.run(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (e *escalator) run(now time.Time) {
+	checks, err := e.checks()
+	if err != nil {
+		log.Error(3, "failed to get checks for escalation. %s", err)
+		return
+	}
+	for i := range checks {
+		check := &checks[i]
+		prev, due := escalationDue(check, now)
+		if !due {
+			continue
+		}
+		window, err := e.maintenance(check.OrgId, check.EndpointId, now)
+		if err != nil {
+			log.Error(3, "failed to get maintenance windows. OrgId: %d monitorId: %d. %s", check.OrgId, check.Id, err)
+		}
+		if window != nil && !window.Notify {
+			continue
+		}
+		ok, err := e.mark(check.Id, prev, now)
+		if err != nil {
+			log.Error(3, "failed to update escalation of check. OrgId: %d monitorId: %d. %s", check.OrgId, check.Id, err)
+			continue
+		}
+		if !ok {
+			// another scheduler has already escalated, or the check recovered.
+			continue
+		}
+		log.Info("escalating critical check: orgId=%d, monitorId=%d, endpointSlug=%s, critical since %s", check.OrgId, check.Id, check.Slug, check.StateChange)
+		escalationsSent.Inc(1)
+		e.notify(&m.AlertingJob{
+			CheckForAlertDTO:  &check.CheckForAlertDTO,
+			NewState:          m.EvalResultCrit,
+			TimeExec:          now,
+			LastPointTs:       check.StateCheck,
+			MaintenanceWindow: window,
+			Escalated:         true,
+		})
+	}
+}
+
+// escalationDue returns whether the check's escalation policy should notify
+// at now.  If so, it also returns the time the last escalation must be before
+// for the escalation to be claimed.
+func escalationDue(check *m.CheckForEscalationDTO, now time.Time) (time.Time, bool) {
+	if check.State != m.EvalResultCrit || check.HealthSettings == nil {
+		return time.Time{}, false
+	}
+	settings := check.HealthSettings.Notifications
+	policy := settings.Escalation
+	if !settings.Enabled || policy == nil {
+		return time.Time{}, false
+	}
+	if now.Before(check.StateChange.Add(time.Duration(policy.After) * time.Minute)) {
+		return time.Time{}, false
+	}
+	if check.Escalated.Before(check.StateChange) {
+		// not yet escalated since the check became critical.
+		return check.StateChange, true
+	}
+	if policy.Repeat > 0 && !now.Before(check.Escalated.Add(time.Duration(policy.Repeat)*time.Minute)) {
+		return check.Escalated.Add(time.Second), true
+	}
+	return time.Time{}, false
+}
+
+func notifyEscalation(job *m.AlertingJob) {
+	policy := job.HealthSettings.Notifications.Escalation
+	for _, n := range buildNotifiers(job, policy.Addresses, policy.Channels, policy.Notifiers) {
+		go func(n Notifier, job *m.AlertingJob) {
+			if err := deliver(n, job); err != nil {
+				log.Error(3, "failed to send %s escalation. OrgId: %d monitorId: %d due to: %s", n.Type(), job.OrgId, job.Id, err)
+			}
+		}(n, job)
+	}
+}
@@ -2,7 +2,6 @@ package alerting
 
 import (
 	"fmt"
-	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -54,16 +53,17 @@ func execute(job *m.AlertingJob, cache *lru.Cache) {
 	preExec := time.Now()
 	executorJobExecDelay.Value(preExec.Sub(job.LastPointTs))
 
-	headers := make(http.Header)
-	headers.Add("x-org-id", fmt.Sprintf("%d", job.OrgId))
 	start := job.LastPointTs.Add(time.Duration(int64(-1)*job.Frequency*int64(job.HealthSettings.Steps)) * time.Second)
-	req := graphite.Request{
-		Start:   &start,
-		End:     &job.LastPointTs,
-		Targets: []string{fmt.Sprintf("worldping.%s.*.%s.error_state", job.Slug, strings.ToLower(job.CheckForAlertDTO.Type))},
+	query := &SeriesQuery{
+		OrgId:     job.OrgId,
+		Endpoint:  job.Slug,
+		CheckType: job.CheckForAlertDTO.Type,
+		Metric:    "error_state",
+		Step:      time.Duration(job.Frequency) * time.Second,
+		From:      start,
+		To:        job.LastPointTs,
 	}
-	log.Debug("Alerting: querying graphite with /render?target=%s&from=%d&until=%d", req.Targets[0], req.Start.Unix(), req.End.Unix())
-	res, err := req.Query(setting.Alerting.GraphiteUrl+"render", headers)
+	res, err := getDatasource().Query(query)
 	durationExec := time.Since(preExec)
 	executorJobQueryGraphite.Value(durationExec)
 	log.Debug("Alerting: job results - job:%v err:%v res:%v", job, err, res)
@@ -74,14 +74,66 @@ func execute(job *m.AlertingJob, cache *lru.Cache) {
 		return
 	}
 
-	newState, err := eval(res, job.HealthSettings)
+	var probes map[string]*m.ProbeDTO
+	if len(job.HealthSettings.Conditions) > 0 {
+		probes, err = getProbesBySlug(job.OrgId)
+		if err != nil {
+			executorAlertOutcomesErr.Inc(1)
+			log.Error(3, "Alerting: failed to get probes for job %q : %s", job, err.Error())
+			return
+		}
+	}
+
+	newState, err := evalWithConditions(res, job.HealthSettings, probes)
 	if err != nil {
 		executorAlertOutcomesErr.Inc(1)
 		log.Error(3, "Alerting: eval failed for job %q : %s", job, err.Error())
 		return
 	}
+
+	// cert checks also go into a warning or critical state as the certificate
+	// approaches its expiry date.
+	if m.CheckType(job.Type) == m.CERT_CHECK && newState != m.EvalResultCrit && newState != m.EvalResultUnknown {
+		query.Metric = "days_until_expiry"
+		res, err := getDatasource().Query(query)
+		if err == nil {
+			var certState m.CheckEvalResult
+			certState, err = evalCertExpiry(res, job.HealthSettings, job.Settings)
+			if err == nil && certState > newState {
+				newState = certState
+			}
+		}
+		if err != nil {
+			executorAlertOutcomesErr.Inc(1)
+			log.Error(3, "Alerting: cert expiry eval failed for job %q : %s", job, err.Error())
+		}
+	}
+	// checks can also alert when a metric, such as latency, breaches a threshold.
+	// Without error_state data the state of the check is unknown, no matter
+	// what the other metrics say.
+	if t := job.HealthSettings.MetricThreshold; t != nil && newState != m.EvalResultCrit && newState != m.EvalResultUnknown {
+		thresholdQuery := *query
+		thresholdQuery.Metric = t.Metric
+		thresholdQuery.From = job.LastPointTs.Add(time.Duration(int64(-1)*job.Frequency*int64(t.Steps)) * time.Second)
+		res, err := getDatasource().Query(&thresholdQuery)
+		if err == nil {
+			var thresholdState m.CheckEvalResult
+			thresholdState, err = evalMetricThreshold(res, t)
+			if err == nil && thresholdState > newState {
+				newState = thresholdState
+			}
+		}
+		if err != nil {
+			executorAlertOutcomesErr.Inc(1)
+			log.Error(3, "Alerting: metric threshold eval failed for job %q : %s", job, err.Error())
+		}
+	}
 	job.NewState = newState
 	job.TimeExec = preExec
+	if job.Backfill {
+		// the state of a missed second is that of its data, not of now.
+		job.TimeExec = job.LastPointTs
+	}
 
 	// lets only update the stateCheck value every second check, which will half the load we place on the DB.
 	if job.State != job.NewState || job.TimeExec.Sub(job.StateCheck) > (time.Second*time.Duration(job.Frequency*2)) {
@@ -94,6 +146,8 @@ func execute(job *m.AlertingJob, cache *lru.Cache) {
 	switch newState {
 	case m.EvalResultOK:
 		executorAlertOutcomesOk.Inc(1)
+	case m.EvalResultWarn:
+		executorAlertOutcomesWarn.Inc(1)
 	case m.EvalResultCrit:
 		executorAlertOutcomesCrit.Inc(1)
 	case m.EvalResultUnknown:
@@ -107,50 +161,150 @@ func eval(res graphite.Response, healthSettings *m.CheckHealthSettings) (m.Check
 		return m.EvalResultUnknown, fmt.Errorf("fatal: no data returned for job")
 	}
 	badEndpoints := 0
+	warnEndpoints := 0
 	endpointsWithData := 0
 	for _, ep := range res {
-		curStreak := 0
-		maxStreak := 0
-		nonNullPoints := 0
+		maxStreak, nonNullPoints, err := failingStreak(ep)
+		if err != nil {
+			return m.EvalResultUnknown, err
+		}
+		if nonNullPoints > 0 {
+			endpointsWithData++
+		}
+
+		if maxStreak >= healthSettings.Steps {
+			badEndpoints++
+		}
+		if healthSettings.Warning != nil && maxStreak >= healthSettings.Warning.Steps {
+			warnEndpoints++
+		}
+	}
+
+	if endpointsWithData == 0 {
+		return m.EvalResultUnknown, nil
+	}
+
+	if badEndpoints >= healthSettings.NumProbes {
+		return m.EvalResultCrit, nil
+	}
+
+	if healthSettings.Warning != nil && warnEndpoints >= healthSettings.Warning.NumProbes {
+		return m.EvalResultWarn, nil
+	}
+
+	return m.EvalResultOK, nil
+}
+
+// failingStreak returns the longest run of consecutive failed points in the
+// error_state series of a probe, and the number of points with data.
+func failingStreak(ep graphite.Series) (int, int, error) {
+	return breachStreak(ep, func(val float64) bool { return val > 0.0 })
+}
+
+// breachStreak returns the longest run of consecutive points in the series
+// for which breached returns true, and the number of points with data.
+func breachStreak(ep graphite.Series, breached func(float64) bool) (int, int, error) {
+	curStreak := 0
+	maxStreak := 0
+	nonNullPoints := 0
+	for _, dp := range ep.Datapoints {
+		if dp[0].String() == "null" || dp[0].String() == "" {
+			continue
+		}
+		nonNullPoints++
+		val, err := dp[0].Float64()
+		if err != nil {
+			log.Error(3, "Alerting: failed to parse graphite response. value %s=[%s, %s] not a number. %s", ep.Target, dp[0].String(), dp[1].String(), err.Error())
+			return 0, 0, err
+		}
+		if breached(val) {
+			curStreak++
+		} else {
+			if curStreak > maxStreak {
+				maxStreak = curStreak
+			}
+			curStreak = 0
+		}
+	}
+	if curStreak > maxStreak {
+		maxStreak = curStreak
+	}
+	return maxStreak, nonNullPoints, nil
+}
+
+// evalCertExpiry evaluates the days_until_expiry series reported by probes
+// running a cert check.  The most recent value from each probe is compared
+// against the warnDays and critDays settings of the check, and the check is
+// in that state when at least NumProbes probes agree.
+func evalCertExpiry(res graphite.Response, healthSettings *m.CheckHealthSettings, settings map[string]interface{}) (m.CheckEvalResult, error) {
+	warnDays, critDays := m.CertExpiryThresholds(settings)
+	warnProbes := 0
+	critProbes := 0
+	probesWithData := 0
+	for _, ep := range res {
+		var lastVal *float64
 		for _, dp := range ep.Datapoints {
 			if dp[0].String() == "null" || dp[0].String() == "" {
 				continue
 			}
-			nonNullPoints++
 			val, err := dp[0].Float64()
 			if err != nil {
 				log.Error(3, "Alerting: failed to parse graphite response. value %s=[%s, %s] not a number. %s", ep.Target, dp[0].String(), dp[1].String(), err.Error())
 				return m.EvalResultUnknown, err
 			}
-			if val > 0.0 {
-				curStreak++
-			} else {
-				if curStreak > maxStreak {
-					maxStreak = curStreak
-				}
-				curStreak = 0
-			}
+			lastVal = &val
 		}
-		if nonNullPoints > 0 {
-			endpointsWithData++
+		if lastVal == nil {
+			continue
 		}
-		if curStreak > maxStreak {
-			maxStreak = curStreak
+		probesWithData++
+		if *lastVal <= critDays {
+			critProbes++
 		}
-
-		if maxStreak >= healthSettings.Steps {
-			badEndpoints++
+		if *lastVal <= warnDays {
+			warnProbes++
 		}
 	}
 
-	if endpointsWithData == 0 {
+	if probesWithData == 0 {
 		return m.EvalResultUnknown, nil
 	}
-
-	if badEndpoints >= healthSettings.NumProbes {
+	if critProbes >= healthSettings.NumProbes {
 		return m.EvalResultCrit, nil
 	}
+	if warnProbes >= healthSettings.NumProbes {
+		return m.EvalResultWarn, nil
+	}
+	return m.EvalResultOK, nil
+}
 
+// evalMetricThreshold evaluates the series of the metric named in the
+// MetricThreshold of a check.  The check is in the threshold's state when at
+// least NumProbes probes have breached the threshold for Steps consecutive
+// points.
+func evalMetricThreshold(res graphite.Response, threshold *m.CheckMetricThreshold) (m.CheckEvalResult, error) {
+	breachedProbes := 0
+	probesWithData := 0
+	for _, ep := range res {
+		streak, nonNullPoints, err := breachStreak(ep, func(val float64) bool {
+			return threshold.Comparison.Breached(val, threshold.Value)
+		})
+		if err != nil {
+			return m.EvalResultUnknown, err
+		}
+		if nonNullPoints > 0 {
+			probesWithData++
+		}
+		if streak >= threshold.Steps {
+			breachedProbes++
+		}
+	}
+	if probesWithData == 0 {
+		return m.EvalResultUnknown, nil
+	}
+	if breachedProbes >= threshold.NumProbes {
+		return threshold.State, nil
+	}
 	return m.EvalResultOK, nil
 }
 
@@ -0,0 +1,91 @@
+package alerting
+
+import (
+	"sync"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+	"github.com/raintank/worldping-api/pkg/setting"
+)
+
+// flapDetector tracks the recent state transitions of checks.  A check is
+// flapping once it has changed state setting.Alerting.FlapThreshold times
+// within setting.Alerting.FlapWindow, and stops flapping once the number of
+// transitions in the window has fallen to half of the threshold.
+//
+// The state is cached in memory and persisted with the check so that it
+// survives restarts and is shared by all alert executors.
+type flapDetector struct {
+	sync.Mutex
+	states map[int64]*m.CheckFlapState
+	load   func(checkId int64) (*m.CheckFlapState, error)
+	save   func(checkId int64, state *m.CheckFlapState) error
+}
+
+func newFlapDetector() *flapDetector {
+	return &flapDetector{
+		states: make(map[int64]*m.CheckFlapState),
+		load:   sqlstore.GetCheckFlapState,
+		save:   sqlstore.UpdateCheckFlapState,
+	}
+}
+
+var flapping = newFlapDetector()
+
+// record updates the flap state of the job's check.  stateChanged should be
+// true when the job resulted in the check changing state.  It returns the
+// change to the flapping status, and whether the check is now flapping.
+func (d *flapDetector) record(job *m.AlertingJob, stateChanged bool) (m.FlapEvent, bool, error) {
+	if setting.Alerting.FlapThreshold <= 0 {
+		return m.FlapNone, false, nil
+	}
+	d.Lock()
+	defer d.Unlock()
+
+	state, ok := d.states[job.Id]
+	if !ok || stateChanged {
+		// other executors may have recorded transitions for this check,
+		// so always start from the persisted state when the state changes.
+		s, err := d.load(job.Id)
+		if err != nil {
+			return m.FlapNone, false, err
+		}
+		state = s
+		d.states[job.Id] = state
+	}
+
+	modified := false
+	if stateChanged {
+		state.Transitions = append(state.Transitions, job.TimeExec.Unix())
+		modified = true
+	}
+
+	// drop transitions that are no longer in the window.
+	oldest := job.TimeExec.Add(-setting.Alerting.FlapWindow).Unix()
+	recent := make([]int64, 0, len(state.Transitions))
+	for _, ts := range state.Transitions {
+		if ts >= oldest {
+			recent = append(recent, ts)
+		}
+	}
+	if len(recent) != len(state.Transitions) {
+		modified = true
+	}
+	state.Transitions = recent
+
+	event := m.FlapNone
+	if !state.Flapping && len(recent) >= setting.Alerting.FlapThreshold {
+		state.Flapping = true
+		event = m.FlapStarted
+	} else if state.Flapping && len(recent) <= setting.Alerting.FlapThreshold/2 {
+		state.Flapping = false
+		event = m.FlapStopped
+	}
+
+	if modified || event != m.FlapNone {
+		if err := d.save(job.Id, state); err != nil {
+			return event, state.Flapping, err
+		}
+	}
+	return event, state.Flapping, nil
+}
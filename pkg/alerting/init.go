@@ -24,6 +24,8 @@ var dispatcherGetSchedules met.Timer
 var dispatcherNumGetSchedules met.Count
 var dispatcherJobSchedulesSeen met.Count
 var dispatcherJobsScheduled met.Count
+var dispatcherBackfillSeconds met.Count
+var dispatcherBackfillJobs met.Count
 
 var executorNum met.Gauge
 
@@ -32,6 +34,7 @@ var executorNumAlreadyDone met.Count
 var executorNumOriginalTodo met.Count
 var executorAlertOutcomesErr met.Count
 var executorAlertOutcomesOk met.Count
+var executorAlertOutcomesWarn met.Count
 var executorAlertOutcomesCrit met.Count
 var executorAlertOutcomesUnkn met.Count
 var executorGraphiteEmptyResponse met.Count
@@ -41,6 +44,21 @@ var executorJobQueryGraphite met.Timer
 var executorJobParseAndEval met.Timer
 var executorGraphiteMissingVals met.Meter
 
+var notifierDeliveriesOk met.Count
+var notifierDeliveriesFailed met.Count
+var notifierRetries met.Count
+var notifierDeliveryDuration met.Timer
+
+var flapStarted met.Count
+var flapStopped met.Count
+var flapSuppressed met.Count
+
+var maintenanceSuppressed met.Count
+var escalationsSent met.Count
+
+var schedulerLeader met.Gauge
+var schedulerLeaderChanges met.Count
+
 var metricsPublisher services.MetricsPublisher
 
 // Init initalizes all metrics
@@ -58,6 +76,8 @@ func Init(metrics met.Backend, publisher services.MetricsPublisher) {
 	dispatcherNumGetSchedules = metrics.NewCount("alert-dispatcher.num-getschedules")
 	dispatcherJobSchedulesSeen = metrics.NewCount("alert-dispatcher.job-schedules-seen")
 	dispatcherJobsScheduled = metrics.NewCount("alert-dispatcher.jobs-scheduled")
+	dispatcherBackfillSeconds = metrics.NewCount("alert-dispatcher.backfill.seconds")
+	dispatcherBackfillJobs = metrics.NewCount("alert-dispatcher.backfill.jobs")
 
 	executorNum = metrics.NewGauge("alert-executor.num", 0)
 
@@ -66,6 +86,7 @@ func Init(metrics met.Backend, publisher services.MetricsPublisher) {
 	executorNumOriginalTodo = metrics.NewCount("alert-executor.original-todo")
 	executorAlertOutcomesErr = metrics.NewCount("alert-executor.alert-outcomes.error")
 	executorAlertOutcomesOk = metrics.NewCount("alert-executor.alert-outcomes.ok")
+	executorAlertOutcomesWarn = metrics.NewCount("alert-executor.alert-outcomes.warning")
 	executorAlertOutcomesCrit = metrics.NewCount("alert-executor.alert-outcomes.critical")
 	executorAlertOutcomesUnkn = metrics.NewCount("alert-executor.alert-outcomes.unknown")
 	executorGraphiteEmptyResponse = metrics.NewCount("alert-executor.graphite-emptyresponse")
@@ -74,10 +95,27 @@ func Init(metrics met.Backend, publisher services.MetricsPublisher) {
 	executorJobQueryGraphite = metrics.NewTimer("alert-executor.job_query_graphite", 0)
 	executorGraphiteMissingVals = metrics.NewMeter("alert-executor.graphite-missingVals", 0)
 
+	notifierDeliveriesOk = metrics.NewCount("alert-notifier.deliveries.ok")
+	notifierDeliveriesFailed = metrics.NewCount("alert-notifier.deliveries.failed")
+	notifierRetries = metrics.NewCount("alert-notifier.retries")
+	notifierDeliveryDuration = metrics.NewTimer("alert-notifier.delivery-duration", 0)
+
+	flapStarted = metrics.NewCount("alert-flapping.started")
+	flapStopped = metrics.NewCount("alert-flapping.stopped")
+	flapSuppressed = metrics.NewCount("alert-flapping.suppressed")
+
+	maintenanceSuppressed = metrics.NewCount("alert-maintenance.suppressed")
+	escalationsSent = metrics.NewCount("alert-escalation.sent")
+
+	schedulerLeader = metrics.NewGauge("alert-scheduler.leader", 0)
+	schedulerLeaderChanges = metrics.NewCount("alert-scheduler.leader-changes")
+
+	jobqueue.InitMetrics(metrics)
+
 	metricsPublisher = publisher
 }
 
-func Construct() {
+func Construct(shutdown <-chan struct{}) {
 	cache, err := lru.New(setting.Alerting.ExecutorLRUSize)
 	if err != nil {
 		panic(fmt.Sprintf("Can't create LRU: %s", err.Error()))
@@ -95,8 +133,13 @@ func Construct() {
 
 	// create jobs
 	if setting.Alerting.EnableScheduler {
-		log.Info("Alerting starting job Dispatcher")
-		go dispatchJobs(jobQ)
+		// only the scheduler leader dispatches jobs and escalations.
+		elector := newLeaderElector(func(stop <-chan struct{}) {
+			log.Info("Alerting starting job Dispatcher")
+			go dispatchJobs(jobQ, stop)
+			go escalateChecks(stop)
+		})
+		go elector.Run(shutdown)
 	}
 
 	//worker to execute the checks.
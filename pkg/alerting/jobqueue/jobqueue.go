@@ -5,10 +5,27 @@ import (
 	"github.com/raintank/worldping-api/pkg/setting"
 )
 
+// PubSub is a transport that distributes jobs between the scheduler and
+// workers when alerting is distributed.  Jobs read from the pub channel are
+// published, and jobs received are written to the sub channel.
+type PubSub interface {
+	Run()
+	Close()
+}
+
 type JobQueue struct {
 	jobsIn  chan *m.AlertingJob
 	jobsOut chan *m.AlertingJob
-	pubSub  *KafkaPubSub
+	pubSub  PubSub
+}
+
+func newPubSub(pub <-chan *m.AlertingJob, sub chan<- *m.AlertingJob) PubSub {
+	switch setting.Alerting.Transport {
+	case "redis":
+		return NewRedisPubSub(setting.Alerting.RedisAddr, setting.Alerting.RedisPassword, setting.Alerting.RedisDb, setting.Alerting.Topic, setting.Alerting.RedisShards, pub, sub)
+	default:
+		return NewKafkaPubSub(setting.Kafka.Brokers, setting.Alerting.Topic, pub, sub)
+	}
 }
 
 func NewJobQueue() *JobQueue {
@@ -16,7 +33,7 @@ func NewJobQueue() *JobQueue {
 	if setting.Alerting.Distributed {
 		in := make(chan *m.AlertingJob, setting.Alerting.InternalJobQueueSize)
 		out := make(chan *m.AlertingJob, setting.Alerting.InternalJobQueueSize)
-		pubSub := NewKafkaPubSub(setting.Kafka.Brokers, setting.Alerting.Topic, in, out)
+		pubSub := newPubSub(in, out)
 		pubSub.Run()
 		q.pubSub = pubSub
 		q.jobsIn = in
@@ -2,7 +2,7 @@ package jobqueue
 
 import (
 	"encoding/json"
-	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -36,6 +36,9 @@ func NewKafkaPubSub(brokersStr, topic string, pub <-chan *m.AlertingJob, sub cha
 	config.Producer.RequiredAcks = sarama.WaitForLocal // Wait for all in-sync replicas to ack the message
 	config.Producer.Retry.Max = 10                     // Retry up to 10 times to produce the message
 	config.Producer.Compression = sarama.CompressionSnappy
+	// all jobs for a check go to the same partition, so each check is
+	// always executed by the worker that has claimed its partition.
+	config.Producer.Partitioner = newCheckPartitioner
 	config.Producer.Return.Successes = true
 	err := config.Validate()
 	if err != nil {
@@ -90,23 +93,42 @@ func (ps *KafkaPubSub) consume(sub chan<- *m.AlertingJob) {
 				continue
 			}
 			log.Debug("JobQueue: kafka consumer received message: Topic %s, Partition: %d, Offset: %d, Key: %s", msg.Topic, msg.Partition, msg.Offset, msg.Key)
+			if !subscribed(ps.consumer.Subscriptions(), msg.Topic, msg.Partition) {
+				// the partition was released in a rebalance and its jobs
+				// are executed by its next owner.
+				log.Debug("JobQueue: kafka consumer skipping message of released partition %d", msg.Partition)
+				continue
+			}
 			job := new(m.AlertingJob)
 			err := json.Unmarshal(msg.Value, job)
 			if err != nil {
 				log.Error(3, "JobQueue: kafka consumer failed to unmarshal job. %s", err)
 			} else {
-				sub <- job
+				select {
+				case sub <- job:
+				case <-ps.shutdown:
+					// the job was not delivered, so its offset is not
+					// marked and the next owner of the partition runs it.
+					ps.consumer.Close()
+					log.Info("JobQueue: kafka consumer for %s", ps.topic)
+					return
+				}
 			}
+			// offsets are only marked once the job is delivered, so jobs
+			// are not lost if we die, and are committed straight away.  A
+			// rebalance waits Consumer.MaxProcessingTime for the messages
+			// being processed before releasing partitions, and their next
+			// owner waits twice that before fetching the committed offsets,
+			// so it starts after the last job we delivered.
 			ps.consumer.MarkOffset(msg, "")
+			if err := ps.consumer.CommitOffsets(); err != nil {
+				log.Error(3, "JobQueue: kafka consumer failed to commit offset %d of partition %d. %s", msg.Offset, msg.Partition, err)
+			}
 		case notification, ok := <-ps.consumer.Notifications():
 			if !ok {
 				continue
 			}
-			claimed := ""
-			for topic, partitions := range notification.Current {
-				claimed += fmt.Sprintf("%s:%v ", topic, partitions)
-			}
-			log.Info("JobQueue: kafka consumer rebalancing. claimed partitions: %s", claimed)
+			reportAssignment("kafka consumer", notification.Current[ps.topic])
 		case <-ps.shutdown:
 			ps.consumer.Close()
 			log.Info("JobQueue: kafka consumer for %s", ps.topic)
@@ -115,6 +137,16 @@ func (ps *KafkaPubSub) consume(sub chan<- *m.AlertingJob) {
 	}
 }
 
+// subscribed returns true if partition of topic is in subs.
+func subscribed(subs map[string][]int32, topic string, partition int32) bool {
+	for _, p := range subs[topic] {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
 func (ps *KafkaPubSub) produce(pub <-chan *m.AlertingJob) {
 	ps.wg.Add(1)
 	defer ps.wg.Done()
@@ -139,7 +171,7 @@ func (ps *KafkaPubSub) produce(pub <-chan *m.AlertingJob) {
 			pm := &sarama.ProducerMessage{
 				Topic: ps.topic,
 				Value: sarama.ByteEncoder(data),
-				Key:   sarama.StringEncoder(fmt.Sprintf("%d-%s", job.Id, job.LastPointTs.String())),
+				Key:   sarama.StringEncoder(strconv.FormatInt(job.Id, 10)),
 			}
 			go ps.sendMessage(pm)
 		case <-ps.shutdown:
@@ -73,3 +73,13 @@ func TestPublish(t *testing.T) {
 
 	pubSub.Close()
 }
+
+func TestSubscribed(t *testing.T) {
+	Convey("when checking if a partition is subscribed", t, func() {
+		subs := map[string][]int32{"jq": {0, 2}}
+		So(subscribed(subs, "jq", 2), ShouldBeTrue)
+		So(subscribed(subs, "jq", 1), ShouldBeFalse)
+		So(subscribed(subs, "other", 0), ShouldBeFalse)
+		So(subscribed(map[string][]int32{}, "jq", 0), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,575 @@
+package jobqueue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/raintank/worldping-api/pkg/log"
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/setting"
+)
+
+const (
+	redisConsumerGroup = "worldping-alerts"
+	// each stream is trimmed to roughly this many jobs.  Jobs are only
+	// executed within a few minutes of being queued, so older jobs are of
+	// no use.
+	redisStreamMaxLen = 100000
+	redisReadCount    = 100
+	redisReadBlock    = time.Second
+	redisTimeout      = 5 * time.Second
+	redisHeartbeat    = 5 * time.Second
+)
+
+// errRedisClosed is returned when the pubSub is closed while delivering jobs.
+var errRedisClosed = errors.New("redis pubSub closed")
+
+// redisMinVersion is the oldest redis that supports all the stream commands
+// used, XAUTOCLAIM being added in 6.2.
+var redisMinVersion = [3]int{6, 2, 0}
+
+// RedisPubSub distributes jobs to workers through redis streams.  Jobs are
+// sharded by check id over a stream per shard, and the shards are spread
+// over the live workers, so each check is always executed by the same
+// worker.  Workers announce themselves with a heartbeat in the
+// <topic>.workers hash, and rebalance when workers join or leave.  All
+// workers read from the streams as members of the same consumer group, so
+// each job is delivered to a single worker.  A job is acknowledged once it
+// has been handed to the worker.  Jobs left pending by a worker that went
+// away are claimed by the worker owning their shard once they have been
+// idle for as long as it takes to expire a worker, so they are executed
+// late, or in rare cases twice, but never lost.
+type RedisPubSub struct {
+	addr      string
+	password  string
+	db        int
+	consumer  string
+	topic     string
+	shards    int32
+	consume   bool
+	heartbeat time.Duration
+	producer  redis.Conn
+	pub       <-chan *m.AlertingJob
+	sub       chan<- *m.AlertingJob
+	wg        sync.WaitGroup
+	shutdown  chan struct{}
+
+	sync.RWMutex
+	owned []int32
+}
+
+func NewRedisPubSub(addr, password string, db int, topic string, shards int, pub <-chan *m.AlertingJob, sub chan<- *m.AlertingJob) *RedisPubSub {
+	if shards < 1 {
+		shards = 1
+	}
+	producer, err := dialRedis(addr, password, db)
+	if err != nil {
+		log.Fatal(4, "JobQueue: failed to connect to redis at %s: %s", addr, err)
+	}
+	if err := checkRedisVersion(producer); err != nil {
+		log.Fatal(4, "JobQueue: unsupported redis at %s: %s", addr, err)
+	}
+	ps := &RedisPubSub{
+		addr:      addr,
+		password:  password,
+		db:        db,
+		consumer:  setting.InstanceId,
+		topic:     topic,
+		shards:    int32(shards),
+		consume:   setting.Alerting.EnableWorker,
+		heartbeat: redisHeartbeat,
+		producer:  producer,
+		pub:       pub,
+		sub:       sub,
+		shutdown:  make(chan struct{}),
+		owned:     []int32{},
+	}
+	if ps.consume {
+		if err := ps.createGroups(producer); err != nil {
+			log.Fatal(4, "JobQueue: failed to create redis consumer group: %s", err)
+		}
+	}
+	return ps
+}
+
+func dialRedis(addr, password string, db int) (redis.Conn, error) {
+	return redis.Dial("tcp", addr,
+		redis.DialPassword(password),
+		redis.DialDatabase(db),
+		redis.DialConnectTimeout(redisTimeout),
+		redis.DialReadTimeout(redisTimeout),
+		redis.DialWriteTimeout(redisTimeout),
+	)
+}
+
+func (ps *RedisPubSub) dial() (redis.Conn, error) {
+	return dialRedis(ps.addr, ps.password, ps.db)
+}
+
+func (ps *RedisPubSub) stream(shard int32) string {
+	return fmt.Sprintf("%s.%d", ps.topic, shard)
+}
+
+func (ps *RedisPubSub) workersKey() string {
+	return ps.topic + ".workers"
+}
+
+// checkRedisVersion returns an error if the redis server is older than
+// redisMinVersion.
+func checkRedisVersion(conn redis.Conn) error {
+	info, err := redis.String(conn.Do("INFO", "server"))
+	if err != nil {
+		return err
+	}
+	version, err := parseRedisVersion(info)
+	if err != nil {
+		return err
+	}
+	for i := range version {
+		if version[i] != redisMinVersion[i] {
+			if version[i] < redisMinVersion[i] {
+				return fmt.Errorf("redis %d.%d.%d is too old, %d.%d.%d or later is required", version[0], version[1], version[2], redisMinVersion[0], redisMinVersion[1], redisMinVersion[2])
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// parseRedisVersion returns the major, minor and patch version of the
+// redis_version field in the reply to INFO.
+func parseRedisVersion(info string) ([3]int, error) {
+	var version [3]int
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "redis_version:") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, "redis_version:"), ".", 3)
+		for i, part := range parts {
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return version, fmt.Errorf("invalid redis_version %q", line)
+			}
+			version[i] = v
+		}
+		return version, nil
+	}
+	return version, fmt.Errorf("redis_version missing from INFO")
+}
+
+// createGroups creates the consumer group of each stream, and the streams
+// if they do not exist yet.  The groups start at the beginning of the
+// streams, so jobs queued before the first worker started are not lost.
+func (ps *RedisPubSub) createGroups(conn redis.Conn) error {
+	for shard := int32(0); shard < ps.shards; shard++ {
+		_, err := conn.Do("XGROUP", "CREATE", ps.stream(shard), redisConsumerGroup, "0", "MKSTREAM")
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+		// BUSYGROUP means the group already exists.
+	}
+	return nil
+}
+
+// Shards returns the shards currently owned by this worker.
+func (ps *RedisPubSub) Shards() []int32 {
+	ps.RLock()
+	defer ps.RUnlock()
+	return ps.owned
+}
+
+func (ps *RedisPubSub) Run() {
+	if ps.consume {
+		ps.wg.Add(2)
+		go ps.heartbeats()
+		go ps.consumeJobs()
+	}
+	ps.wg.Add(1)
+	go ps.produceJobs()
+}
+
+func (ps *RedisPubSub) Close() {
+	close(ps.shutdown)
+	ps.wg.Wait()
+}
+
+// heartbeats announces this worker in the workers hash, and rebalances the
+// shards whenever the live workers change.  On shutdown the worker removes
+// itself, so its shards are taken over at the next heartbeat of the others.
+func (ps *RedisPubSub) heartbeats() {
+	defer ps.wg.Done()
+	var conn redis.Conn
+	ticker := time.NewTicker(ps.heartbeat)
+	defer ticker.Stop()
+	for {
+		var err error
+		if conn == nil {
+			conn, err = ps.dial()
+		}
+		if err == nil {
+			err = ps.rebalance(conn)
+			if err != nil {
+				conn.Close()
+				conn = nil
+			}
+		}
+		if err != nil {
+			log.Error(3, "JobQueue: redis heartbeat failed. %s", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ps.shutdown:
+			if conn == nil {
+				conn, err = ps.dial()
+			}
+			if conn != nil {
+				if _, err = conn.Do("HDEL", ps.workersKey(), ps.consumer); err == nil {
+					ps.setShards([]int32{})
+				}
+				conn.Close()
+			}
+			if err != nil {
+				log.Error(3, "JobQueue: redis worker failed to leave. %s", err)
+			}
+			return
+		}
+	}
+}
+
+// rebalance records the heartbeat of this worker, and updates the shards it
+// owns from the list of workers that have sent a heartbeat recently.
+func (ps *RedisPubSub) rebalance(conn redis.Conn) error {
+	now := time.Now()
+	if _, err := conn.Do("HSET", ps.workersKey(), ps.consumer, now.Unix()); err != nil {
+		return err
+	}
+	heartbeats, err := redis.StringMap(conn.Do("HGETALL", ps.workersKey()))
+	if err != nil {
+		return err
+	}
+	expired := now.Add(-ps.expiry()).Unix()
+	workers := make([]string, 0)
+	for name, value := range heartbeats {
+		ts, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || ts < expired {
+			// the worker has gone away without leaving.
+			if _, err := conn.Do("HDEL", ps.workersKey(), name); err != nil {
+				return err
+			}
+			continue
+		}
+		workers = append(workers, name)
+	}
+	ps.setShards(assignShards(workers, ps.consumer, ps.shards))
+	return nil
+}
+
+// expiry is how long a worker may go without a heartbeat before its shards
+// are taken over.
+func (ps *RedisPubSub) expiry() time.Duration {
+	return 3 * ps.heartbeat
+}
+
+func (ps *RedisPubSub) setShards(owned []int32) {
+	ps.Lock()
+	changed := !reflect.DeepEqual(ps.owned, owned)
+	ps.owned = owned
+	ps.Unlock()
+	if changed {
+		reportAssignment("redis consumer", owned)
+	}
+}
+
+func (ps *RedisPubSub) consumeJobs() {
+	defer ps.wg.Done()
+	log.Info("JobQueue: consuming from redis streams %s.*", ps.topic)
+	var conn redis.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	var claimed []int32
+	var lastClaim time.Time
+	for {
+		select {
+		case <-ps.shutdown:
+			log.Info("JobQueue: redis consumer for %s closed", ps.topic)
+			return
+		default:
+		}
+		owned := ps.Shards()
+		if len(owned) == 0 {
+			ps.sleep(redisReadBlock)
+			continue
+		}
+		if conn == nil {
+			var err error
+			conn, err = ps.dial()
+			if err == nil {
+				// the streams may have been deleted since we started.
+				err = ps.createGroups(conn)
+			}
+			if err != nil {
+				log.Error(3, "JobQueue: redis consumer failed to connect. %s", err)
+				conn = nil
+				ps.sleep(time.Second)
+				continue
+			}
+		}
+
+		var err error
+		// jobs left pending by other workers are claimed when taking over
+		// a shard, and then once per heartbeat, as the jobs of a worker
+		// that just left may not have been idle for long enough yet.
+		if !reflect.DeepEqual(claimed, owned) || time.Since(lastClaim) >= ps.heartbeat {
+			for _, shard := range owned {
+				if err = ps.claimPending(conn, ps.stream(shard)); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				claimed = owned
+				lastClaim = time.Now()
+			}
+		}
+
+		var entries []redisStreamEntry
+		if err == nil {
+			args := redis.Args{"GROUP", redisConsumerGroup, ps.consumer,
+				"COUNT", redisReadCount, "BLOCK", int64(redisReadBlock / time.Millisecond),
+				"STREAMS"}
+			for _, shard := range owned {
+				args = args.Add(ps.stream(shard))
+			}
+			for range owned {
+				args = args.Add(">")
+			}
+			var reply interface{}
+			reply, err = redis.DoWithTimeout(conn, redisTimeout+redisReadBlock, "XREADGROUP", args...)
+			if err == nil {
+				entries, err = parseRedisStreams(reply)
+			}
+			if err == nil && !ps.deliver(conn, entries) {
+				err = errRedisClosed
+			}
+		}
+		if err == errRedisClosed {
+			log.Info("JobQueue: redis consumer for %s closed", ps.topic)
+			return
+		}
+		if err != nil {
+			log.Error(3, "JobQueue: redis consumer failed to read from %s. %s", ps.topic, err)
+			conn.Close()
+			conn = nil
+			ps.sleep(time.Second)
+		}
+	}
+}
+
+// claimPending takes over the jobs of a stream that were delivered to a
+// worker, but not acknowledged by it for longer than a worker can go
+// without a heartbeat, and delivers them.
+func (ps *RedisPubSub) claimPending(conn redis.Conn, stream string) error {
+	minIdle := int64(ps.expiry() / time.Millisecond)
+	start := "0-0"
+	for {
+		reply, err := conn.Do("XAUTOCLAIM", stream, redisConsumerGroup, ps.consumer, minIdle, start, "COUNT", redisReadCount)
+		if err != nil {
+			return err
+		}
+		next, entries, err := parseRedisClaim(stream, reply)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			log.Info("JobQueue: redis consumer claimed %d pending jobs from %s", len(entries), stream)
+			if !ps.deliver(conn, entries) {
+				return errRedisClosed
+			}
+		}
+		if next == "0-0" {
+			return nil
+		}
+		start = next
+	}
+}
+
+// deliver passes the jobs to the sub channel, acknowledging each once it
+// has been delivered.  It returns false if the pubSub was closed before all
+// jobs were delivered, leaving the remaining jobs pending.
+func (ps *RedisPubSub) deliver(conn redis.Conn, entries []redisStreamEntry) bool {
+	for _, entry := range entries {
+		log.Debug("JobQueue: redis consumer received message: Stream %s, Id: %s", entry.Stream, entry.Id)
+		data, ok := entry.Fields["job"]
+		if !ok {
+			// the entry was trimmed from the stream while pending.
+			log.Debug("JobQueue: redis consumer dropping deleted message: Stream %s, Id: %s", entry.Stream, entry.Id)
+		} else {
+			job := new(m.AlertingJob)
+			if err := json.Unmarshal(data, job); err != nil {
+				log.Error(3, "JobQueue: redis consumer failed to unmarshal job. %s", err)
+			} else {
+				select {
+				case ps.sub <- job:
+				case <-ps.shutdown:
+					return false
+				}
+			}
+		}
+		if _, err := conn.Do("XACK", entry.Stream, redisConsumerGroup, entry.Id); err != nil {
+			log.Error(3, "JobQueue: redis consumer failed to ack %s. %s", entry.Id, err)
+		}
+	}
+	return true
+}
+
+func (ps *RedisPubSub) produceJobs() {
+	defer ps.wg.Done()
+	defer func() {
+		if ps.producer != nil {
+			ps.producer.Close()
+		}
+	}()
+	for {
+		select {
+		case job, ok := <-ps.pub:
+			if !ok {
+				log.Info("jobQueue: pub channel has closed.")
+				return
+			}
+			data, err := json.Marshal(job)
+			if err != nil {
+				log.Error(3, "JobQueue: redis producer failed to marshal job to json. %s", err)
+				continue
+			}
+			ps.sendMessage(ps.stream(ShardForCheck(job.Id, ps.shards)), data)
+		case <-ps.shutdown:
+			return
+		}
+	}
+}
+
+// sendMessage adds a job to a stream, retrying until it succeeds or the
+// pubSub is closed.
+func (ps *RedisPubSub) sendMessage(stream string, data []byte) {
+	for {
+		var err error
+		if ps.producer == nil {
+			ps.producer, err = ps.dial()
+		}
+		if err == nil {
+			var id string
+			id, err = redis.String(ps.producer.Do("XADD", stream, "MAXLEN", "~", redisStreamMaxLen, "*", "job", data))
+			if err == nil {
+				log.Debug("jobQueue: message published to %s with id %s", stream, id)
+				return
+			}
+			ps.producer.Close()
+			ps.producer = nil
+		}
+		log.Error(3, "jobQueue: failed to publish message. %s", err)
+		if !ps.sleep(time.Second) {
+			return
+		}
+	}
+}
+
+// sleep waits for d, returning false if the pubSub was closed meanwhile.
+func (ps *RedisPubSub) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ps.shutdown:
+		return false
+	}
+}
+
+// redisStreamEntry is an entry read from a redis stream.
+type redisStreamEntry struct {
+	Stream string
+	Id     string
+	Fields map[string][]byte
+}
+
+// parseRedisStreams parses the reply of XREADGROUP.
+func parseRedisStreams(reply interface{}) ([]redisStreamEntry, error) {
+	if reply == nil {
+		// no new entries before the command timed out.
+		return nil, nil
+	}
+	streams, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]redisStreamEntry, 0)
+	for _, s := range streams {
+		stream, err := redis.Values(s, nil)
+		if err != nil || len(stream) != 2 {
+			return nil, errors.New("redis: unexpected XREADGROUP stream")
+		}
+		name, err := redis.String(stream[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		items, err := parseRedisEntries(name, stream[1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, items...)
+	}
+	return entries, nil
+}
+
+// parseRedisClaim parses the reply of XAUTOCLAIM, returning the id to
+// continue claiming from and the claimed entries.
+func parseRedisClaim(stream string, reply interface{}) (string, []redisStreamEntry, error) {
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	// redis 7 adds the ids of deleted entries as a third element.
+	if len(values) < 2 {
+		return "", nil, errors.New("redis: unexpected XAUTOCLAIM reply")
+	}
+	next, err := redis.String(values[0], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	entries, err := parseRedisEntries(stream, values[1])
+	return next, entries, err
+}
+
+func parseRedisEntries(stream string, reply interface{}) ([]redisStreamEntry, error) {
+	items, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]redisStreamEntry, 0, len(items))
+	for _, i := range items {
+		item, err := redis.Values(i, nil)
+		if err != nil || len(item) != 2 {
+			return nil, errors.New("redis: unexpected stream entry")
+		}
+		id, err := redis.String(item[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		entry := redisStreamEntry{Stream: stream, Id: id, Fields: make(map[string][]byte)}
+		// fields of entries that have been deleted are nil.
+		fields, _ := redis.ByteSlices(item[1], nil)
+		for f := 0; f+1 < len(fields); f += 2 {
+			entry.Fields[string(fields[f])] = fields[f+1]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
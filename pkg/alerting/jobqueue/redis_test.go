@@ -0,0 +1,601 @@
+package jobqueue
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeRedis is an in-process stand-in for redis that supports the stream
+// commands used by RedisPubSub.
+type fakeRedis struct {
+	sync.Mutex
+	listener net.Listener
+	conns    []net.Conn
+	streams  map[string]*fakeStream
+	hashes   map[string]map[string]string
+	seq      int
+	version  string
+}
+
+type fakeStream struct {
+	entries []redisStreamEntry
+	groups  map[string]int // index of the next entry to deliver to each group
+	pending map[string]*fakePending
+}
+
+// fakePending is an entry delivered to a consumer but not acked yet.
+type fakePending struct {
+	entry     redisStreamEntry
+	consumer  string
+	delivered time.Time
+}
+
+func newFakeStream() *fakeStream {
+	return &fakeStream{groups: make(map[string]int), pending: make(map[string]*fakePending)}
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{listener: l, streams: make(map[string]*fakeStream), hashes: make(map[string]map[string]string), version: "6.2.6"}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r.Lock()
+			r.conns = append(r.conns, conn)
+			r.Unlock()
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) setVersion(version string) {
+	r.Lock()
+	r.version = version
+	r.Unlock()
+}
+
+func (r *fakeRedis) Addr() string {
+	return r.listener.Addr().String()
+}
+
+func (r *fakeRedis) Close() {
+	r.listener.Close()
+	r.dropConns()
+}
+
+// dropConns closes all client connections.
+func (r *fakeRedis) dropConns() {
+	r.Lock()
+	defer r.Unlock()
+	for _, c := range r.conns {
+		c.Close()
+	}
+	r.conns = nil
+}
+
+func (r *fakeRedis) pendingCount(stream string) int {
+	r.Lock()
+	defer r.Unlock()
+	if s, ok := r.streams[stream]; ok {
+		return len(s.pending)
+	}
+	return 0
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readFakeCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write([]byte(r.handle(args))); err != nil {
+			return
+		}
+	}
+}
+
+// readFakeCommand reads a command sent by a client, which is an array of
+// bulk strings.
+func readFakeCommand(r *bufio.Reader) ([]string, error) {
+	readLine := func(prefix byte) (int, error) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		if len(line) < 3 || line[0] != prefix {
+			return 0, fmt.Errorf("unexpected line %q", line)
+		}
+		return strconv.Atoi(strings.TrimSpace(line[1:]))
+	}
+	n, err := readLine('*')
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		size, err := readLine('$')
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func fakeEntries(entries []redisStreamEntry) string {
+	reply := fmt.Sprintf("*%d\r\n", len(entries))
+	for _, e := range entries {
+		reply += fmt.Sprintf("*2\r\n%s*%d\r\n", bulk(e.Id), 2*len(e.Fields))
+		for f, v := range e.Fields {
+			reply += bulk(f) + bulk(string(v))
+		}
+	}
+	return reply
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func (r *fakeRedis) handle(args []string) string {
+	if len(args) == 0 {
+		return "-ERR empty command\r\n"
+	}
+	switch strings.ToUpper(args[0]) {
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "INFO":
+		r.Lock()
+		defer r.Unlock()
+		return bulk("# Server\r\nredis_version:" + r.version + "\r\nredis_mode:standalone\r\n")
+	case "XGROUP":
+		r.Lock()
+		defer r.Unlock()
+		s, ok := r.streams[args[2]]
+		if !ok {
+			s = newFakeStream()
+			r.streams[args[2]] = s
+		}
+		if _, ok := s.groups[args[3]]; ok {
+			return "-BUSYGROUP Consumer Group name already exists\r\n"
+		}
+		s.groups[args[3]] = 0
+		if args[4] == "$" {
+			s.groups[args[3]] = len(s.entries)
+		}
+		return "+OK\r\n"
+	case "XADD":
+		// XADD stream MAXLEN ~ n * field value ...
+		r.Lock()
+		defer r.Unlock()
+		s, ok := r.streams[args[1]]
+		if !ok {
+			s = newFakeStream()
+			r.streams[args[1]] = s
+		}
+		r.seq++
+		entry := redisStreamEntry{Id: fmt.Sprintf("%d-0", r.seq), Fields: make(map[string][]byte)}
+		for i := 6; i+1 < len(args); i += 2 {
+			entry.Fields[args[i]] = []byte(args[i+1])
+		}
+		s.entries = append(s.entries, entry)
+		return bulk(entry.Id)
+	case "XREADGROUP":
+		// XREADGROUP GROUP group consumer COUNT n BLOCK ms STREAMS stream... >...
+		count, _ := strconv.Atoi(args[5])
+		block, _ := strconv.Atoi(args[7])
+		names := args[9 : 9+(len(args)-9)/2]
+		deadline := time.Now().Add(time.Duration(block) * time.Millisecond)
+		for {
+			r.Lock()
+			reply := ""
+			found := 0
+			for _, name := range names {
+				s, ok := r.streams[name]
+				if !ok {
+					r.Unlock()
+					return "-NOGROUP No such key\r\n"
+				}
+				next := s.groups[args[2]]
+				if next >= len(s.entries) {
+					continue
+				}
+				end := next + count
+				if end > len(s.entries) {
+					end = len(s.entries)
+				}
+				found++
+				reply += "*2\r\n" + bulk(name) + fakeEntries(s.entries[next:end])
+				for _, e := range s.entries[next:end] {
+					s.pending[e.Id] = &fakePending{entry: e, consumer: args[3], delivered: time.Now()}
+				}
+				s.groups[args[2]] = end
+			}
+			r.Unlock()
+			if found > 0 {
+				return fmt.Sprintf("*%d\r\n", found) + reply
+			}
+			if time.Now().After(deadline) {
+				return "*-1\r\n"
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	case "HSET":
+		r.Lock()
+		defer r.Unlock()
+		h, ok := r.hashes[args[1]]
+		if !ok {
+			h = make(map[string]string)
+			r.hashes[args[1]] = h
+		}
+		h[args[2]] = args[3]
+		return ":1\r\n"
+	case "HGETALL":
+		r.Lock()
+		defer r.Unlock()
+		h := r.hashes[args[1]]
+		reply := fmt.Sprintf("*%d\r\n", 2*len(h))
+		for k, v := range h {
+			reply += bulk(k) + bulk(v)
+		}
+		return reply
+	case "HDEL":
+		r.Lock()
+		defer r.Unlock()
+		deleted := 0
+		if h, ok := r.hashes[args[1]]; ok {
+			for _, k := range args[2:] {
+				if _, ok := h[k]; ok {
+					delete(h, k)
+					deleted++
+				}
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "XACK":
+		r.Lock()
+		defer r.Unlock()
+		acked := 0
+		if s, ok := r.streams[args[1]]; ok {
+			for _, id := range args[3:] {
+				if _, ok := s.pending[id]; ok {
+					delete(s.pending, id)
+					acked++
+				}
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", acked)
+	case "XAUTOCLAIM":
+		// XAUTOCLAIM stream group consumer min-idle-time start COUNT n
+		r.Lock()
+		defer r.Unlock()
+		minIdle, _ := strconv.Atoi(args[4])
+		claimed := make([]redisStreamEntry, 0)
+		if s, ok := r.streams[args[1]]; ok {
+			for _, e := range s.entries {
+				p, ok := s.pending[e.Id]
+				if !ok || time.Since(p.delivered) < time.Duration(minIdle)*time.Millisecond {
+					continue
+				}
+				p.consumer = args[3]
+				p.delivered = time.Now()
+				claimed = append(claimed, e)
+			}
+		}
+		return "*3\r\n" + bulk("0-0") + fakeEntries(claimed) + "*0\r\n"
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+}
+
+func receiveJob(sub <-chan *m.AlertingJob) *m.AlertingJob {
+	select {
+	case job := <-sub:
+		return job
+	case <-time.After(5 * time.Second):
+		return nil
+	}
+}
+
+func TestRedisPubSub(t *testing.T) {
+	redis := newFakeRedis(t)
+	defer redis.Close()
+	setting.InstanceId = "test"
+	setting.Alerting.EnableWorker = true
+
+	pub := make(chan *m.AlertingJob, 10)
+	sub := make(chan *m.AlertingJob, 10)
+	pubSub := NewRedisPubSub(redis.Addr(), "secret", 1, "jq", 1, pub, sub)
+	pubSub.Run()
+	defer pubSub.Close()
+
+	Convey("When publishing jobs over redis", t, func() {
+		for i := int64(1); i <= 3; i++ {
+			pub <- &m.AlertingJob{
+				CheckForAlertDTO: &m.CheckForAlertDTO{
+					Id:   i,
+					Slug: "test",
+				},
+			}
+		}
+		for i := int64(1); i <= 3; i++ {
+			job := receiveJob(sub)
+			So(job, ShouldNotBeNil)
+			So(job.Id, ShouldEqual, i)
+			So(job.Slug, ShouldEqual, "test")
+		}
+		// jobs are acked after they are queued.
+		time.Sleep(100 * time.Millisecond)
+		So(redis.pendingCount("jq.0"), ShouldEqual, 0)
+	})
+
+	Convey("When another worker joins the consumer group", t, func() {
+		other := NewRedisPubSub(redis.Addr(), "", 0, "jq", 1, make(chan *m.AlertingJob), make(chan *m.AlertingJob))
+		So(other, ShouldNotBeNil)
+		other.Close()
+	})
+
+	Convey("When the connection to redis is lost", t, func() {
+		redis.dropConns()
+		pub <- &m.AlertingJob{
+			CheckForAlertDTO: &m.CheckForAlertDTO{
+				Id:   4,
+				Slug: "test",
+			},
+		}
+		job := receiveJob(sub)
+		So(job, ShouldNotBeNil)
+		So(job.Id, ShouldEqual, 4)
+	})
+}
+
+type int64s []int64
+
+func (s int64s) Len() int           { return len(s) }
+func (s int64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s int64s) Less(i, j int) bool { return s[i] < s[j] }
+
+func receiveJobIds(sub <-chan *m.AlertingJob, count int) []int64 {
+	ids := make([]int64, 0)
+	for i := 0; i < count; i++ {
+		job := receiveJob(sub)
+		if job == nil {
+			break
+		}
+		ids = append(ids, job.Id)
+	}
+	// jobs from different shards may be received in any order.
+	sort.Sort(int64s(ids))
+	return ids
+}
+
+func waitForShards(ps *RedisPubSub, shards []int32) []int32 {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		owned := ps.Shards()
+		if fmt.Sprint(owned) == fmt.Sprint(shards) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return ps.Shards()
+}
+
+func newTestRedisPubSub(addr, instance string, worker bool, pub <-chan *m.AlertingJob, sub chan<- *m.AlertingJob) *RedisPubSub {
+	setting.InstanceId = instance
+	setting.Alerting.EnableWorker = worker
+	ps := NewRedisPubSub(addr, "", 0, "sharded", 4, pub, sub)
+	ps.heartbeat = 50 * time.Millisecond
+	ps.Run()
+	return ps
+}
+
+func TestRedisPubSubSharding(t *testing.T) {
+	redis := newFakeRedis(t)
+	defer redis.Close()
+
+	pub := make(chan *m.AlertingJob, 10)
+	producer := newTestRedisPubSub(redis.Addr(), "scheduler", false, pub, nil)
+	defer producer.Close()
+	subA := make(chan *m.AlertingJob, 10)
+	workerA := newTestRedisPubSub(redis.Addr(), "a", true, nil, subA)
+	defer workerA.Close()
+	subB := make(chan *m.AlertingJob, 10)
+	workerB := newTestRedisPubSub(redis.Addr(), "b", true, nil, subB)
+
+	Convey("When two workers share the jobs", t, func() {
+		So(waitForShards(workerA, []int32{0, 2}), ShouldResemble, []int32{0, 2})
+		So(waitForShards(workerB, []int32{1, 3}), ShouldResemble, []int32{1, 3})
+		So(producer.Shards(), ShouldBeEmpty)
+
+		for i := int64(1); i <= 8; i++ {
+			pub <- &m.AlertingJob{CheckForAlertDTO: &m.CheckForAlertDTO{Id: i}}
+		}
+		So(receiveJobIds(subA, 4), ShouldResemble, []int64{2, 4, 6, 8})
+		So(receiveJobIds(subB, 4), ShouldResemble, []int64{1, 3, 5, 7})
+
+		Convey("the shards of a worker that leaves should be taken over", func() {
+			workerB.Close()
+			So(workerB.Shards(), ShouldBeEmpty)
+			So(waitForShards(workerA, []int32{0, 1, 2, 3}), ShouldResemble, []int32{0, 1, 2, 3})
+			for i := int64(1); i <= 4; i++ {
+				pub <- &m.AlertingJob{CheckForAlertDTO: &m.CheckForAlertDTO{Id: i}}
+			}
+			So(receiveJobIds(subA, 4), ShouldResemble, []int64{1, 2, 3, 4})
+		})
+	})
+}
+
+func TestRedisPubSubPending(t *testing.T) {
+	redis := newFakeRedis(t)
+	defer redis.Close()
+
+	pub := make(chan *m.AlertingJob, 10)
+	producer := newTestRedisPubSub(redis.Addr(), "scheduler", false, pub, nil)
+	defer producer.Close()
+
+	pending := func() int {
+		count := 0
+		for shard := 0; shard < 4; shard++ {
+			count += redis.pendingCount(fmt.Sprintf("sharded.%d", shard))
+		}
+		return count
+	}
+	waitForPending := func(done func(int) bool) int {
+		deadline := time.Now().Add(5 * time.Second)
+		for !done(pending()) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return pending()
+	}
+
+	Convey("When a worker leaves before delivering the jobs it read", t, func() {
+		// nothing reads from the sub channel of the worker.
+		stuck := make(chan *m.AlertingJob)
+		worker := newTestRedisPubSub(redis.Addr(), "stuck", true, nil, stuck)
+		So(waitForShards(worker, []int32{0, 1, 2, 3}), ShouldResemble, []int32{0, 1, 2, 3})
+		for i := int64(1); i <= 4; i++ {
+			pub <- &m.AlertingJob{CheckForAlertDTO: &m.CheckForAlertDTO{Id: i}}
+		}
+		So(waitForPending(func(n int) bool { return n > 0 }), ShouldBeGreaterThan, 0)
+
+		closed := make(chan struct{})
+		go func() {
+			worker.Close()
+			close(closed)
+		}()
+		returned := false
+		select {
+		case <-closed:
+			returned = true
+		case <-time.After(5 * time.Second):
+		}
+		So(returned, ShouldBeTrue)
+
+		Convey("the pending jobs should be claimed by the worker taking over", func() {
+			sub := make(chan *m.AlertingJob, 10)
+			other := newTestRedisPubSub(redis.Addr(), "other", true, nil, sub)
+			defer other.Close()
+			So(receiveJobIds(sub, 4), ShouldResemble, []int64{1, 2, 3, 4})
+			So(waitForPending(func(n int) bool { return n == 0 }), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestRedisPubSubBeforeWorkers(t *testing.T) {
+	redis := newFakeRedis(t)
+	defer redis.Close()
+
+	pub := make(chan *m.AlertingJob, 10)
+	producer := newTestRedisPubSub(redis.Addr(), "scheduler", false, pub, nil)
+	defer producer.Close()
+
+	Convey("When jobs are queued before any worker has started", t, func() {
+		for i := int64(1); i <= 4; i++ {
+			pub <- &m.AlertingJob{CheckForAlertDTO: &m.CheckForAlertDTO{Id: i}}
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			redis.Lock()
+			queued := 0
+			for _, s := range redis.streams {
+				queued += len(s.entries)
+			}
+			redis.Unlock()
+			if queued == 4 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		Convey("the first worker should execute them", func() {
+			sub := make(chan *m.AlertingJob, 10)
+			worker := newTestRedisPubSub(redis.Addr(), "worker", true, nil, sub)
+			defer worker.Close()
+			So(receiveJobIds(sub, 4), ShouldResemble, []int64{1, 2, 3, 4})
+		})
+	})
+}
+
+func TestRedisVersion(t *testing.T) {
+	redis := newFakeRedis(t)
+	defer redis.Close()
+
+	Convey("When checking the version of redis", t, func() {
+		redis.setVersion("6.2.6")
+		conn, err := dialRedis(redis.Addr(), "", 0)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		So(checkRedisVersion(conn), ShouldBeNil)
+
+		Convey("newer versions should be supported", func() {
+			redis.setVersion("7.0.11")
+			So(checkRedisVersion(conn), ShouldBeNil)
+		})
+		Convey("versions without XAUTOCLAIM should be rejected", func() {
+			redis.setVersion("6.0.16")
+			So(checkRedisVersion(conn), ShouldNotBeNil)
+			redis.setVersion("5.0.14")
+			So(checkRedisVersion(conn), ShouldNotBeNil)
+		})
+		Convey("a malformed version should be rejected", func() {
+			_, err := parseRedisVersion("redis_version:six\r\n")
+			So(err, ShouldNotBeNil)
+			_, err = parseRedisVersion("redis_mode:standalone\r\n")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestJobQueueRedisTransport(t *testing.T) {
+	redis := newFakeRedis(t)
+	defer redis.Close()
+	setting.InstanceId = "test"
+	setting.Alerting.Distributed = true
+	setting.Alerting.EnableWorker = true
+	setting.Alerting.Transport = "redis"
+	setting.Alerting.RedisAddr = redis.Addr()
+	setting.Alerting.InternalJobQueueSize = 10
+	defer func() {
+		setting.Alerting.Distributed = false
+		setting.Alerting.Transport = ""
+	}()
+
+	jobQ := NewJobQueue()
+	defer jobQ.Close()
+	Convey("When queuing a job with the redis transport", t, func() {
+		jobQ.QueueJob(&m.AlertingJob{
+			CheckForAlertDTO: &m.CheckForAlertDTO{
+				Id:   1,
+				Slug: "test",
+			},
+		})
+		job := receiveJob(jobQ.Jobs())
+		So(job, ShouldNotBeNil)
+		So(job.Id, ShouldEqual, 1)
+	})
+}
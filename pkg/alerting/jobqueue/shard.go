@@ -0,0 +1,90 @@
+package jobqueue
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/Shopify/sarama"
+	"github.com/raintank/met"
+	"github.com/raintank/worldping-api/pkg/log"
+)
+
+var (
+	shardsOwned met.Gauge
+	rebalances  met.Count
+)
+
+// InitMetrics creates the metrics of the job queue.
+func InitMetrics(metrics met.Backend) {
+	shardsOwned = metrics.NewGauge("alert-jobqueue.shards-owned", 0)
+	rebalances = metrics.NewCount("alert-jobqueue.rebalances")
+}
+
+// ShardForCheck returns the shard that the jobs of a check are queued to.
+// Jobs are sharded by check id, so that each check is always executed by the
+// worker that owns its shard.
+func ShardForCheck(checkId int64, shards int32) int32 {
+	if shards < 1 {
+		return 0
+	}
+	shard := int32(checkId % int64(shards))
+	if shard < 0 {
+		shard += shards
+	}
+	return shard
+}
+
+// checkPartitioner is a kafka partitioner that sends the jobs of a check to
+// the partition given by ShardForCheck.  Message keys must be the check id.
+type checkPartitioner struct{}
+
+func newCheckPartitioner(topic string) sarama.Partitioner {
+	return &checkPartitioner{}
+}
+
+func (p *checkPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if msg.Key == nil {
+		return 0, fmt.Errorf("job message has no key")
+	}
+	key, err := msg.Key.Encode()
+	if err != nil {
+		return 0, err
+	}
+	checkId, err := strconv.ParseInt(string(key), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid job message key %q. %s", key, err)
+	}
+	return ShardForCheck(checkId, numPartitions), nil
+}
+
+func (p *checkPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+// assignShards returns the shards owned by worker when shards are spread
+// evenly over the live workers.  Every worker computes the same assignment
+// from the same list of workers.
+func assignShards(workers []string, worker string, shards int32) []int32 {
+	sorted := make([]string, len(workers))
+	copy(sorted, workers)
+	sort.Strings(sorted)
+	pos := sort.SearchStrings(sorted, worker)
+	if pos == len(sorted) || sorted[pos] != worker {
+		return []int32{}
+	}
+	owned := make([]int32, 0)
+	for shard := int32(0); shard < shards; shard++ {
+		if int(shard)%len(sorted) == pos {
+			owned = append(owned, shard)
+		}
+	}
+	return owned
+}
+
+// reportAssignment records the shards owned by this worker after a rebalance.
+func reportAssignment(transport string, shards []int32) {
+	shardsOwned.Value(int64(len(shards)))
+	rebalances.Inc(1)
+	log.Info("JobQueue: %s rebalanced. %d shards owned: %v", transport, len(shards), shards)
+}
@@ -0,0 +1,58 @@
+package jobqueue
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/raintank/met/helper"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() {
+	metrics, _ := helper.New(false, "", "standard", "worldping-api", "test")
+	InitMetrics(metrics)
+}
+
+func TestSharding(t *testing.T) {
+	Convey("When sharding jobs by check id", t, func() {
+		So(ShardForCheck(1, 4), ShouldEqual, 1)
+		So(ShardForCheck(4, 4), ShouldEqual, 0)
+		So(ShardForCheck(7, 4), ShouldEqual, 3)
+		So(ShardForCheck(7, 1), ShouldEqual, 0)
+		So(ShardForCheck(7, 0), ShouldEqual, 0)
+	})
+
+	Convey("When partitioning kafka messages", t, func() {
+		p := newCheckPartitioner("jq")
+		So(p.RequiresConsistency(), ShouldBeTrue)
+		partition, err := p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("7")}, 4)
+		So(err, ShouldBeNil)
+		So(partition, ShouldEqual, 3)
+		_, err = p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("7-2017")}, 4)
+		So(err, ShouldNotBeNil)
+		_, err = p.Partition(&sarama.ProducerMessage{}, 4)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("When assigning shards to workers", t, func() {
+		workers := []string{"c", "a", "b"}
+		So(assignShards(workers, "a", 7), ShouldResemble, []int32{0, 3, 6})
+		So(assignShards(workers, "b", 7), ShouldResemble, []int32{1, 4})
+		So(assignShards(workers, "c", 7), ShouldResemble, []int32{2, 5})
+		So(assignShards(workers, "d", 7), ShouldBeEmpty)
+		So(assignShards([]string{"a"}, "a", 2), ShouldResemble, []int32{0, 1})
+
+		Convey("every shard should be owned by exactly one worker", func() {
+			owners := make(map[int32]int)
+			for _, w := range workers {
+				for _, shard := range assignShards(workers, w, 16) {
+					owners[shard]++
+				}
+			}
+			So(owners, ShouldHaveLength, 16)
+			for _, count := range owners {
+				So(count, ShouldEqual, 1)
+			}
+		})
+	})
+}
@@ -0,0 +1,108 @@
+package alerting
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/raintank/worldping-api/pkg/log"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+	"github.com/raintank/worldping-api/pkg/setting"
+)
+
+const schedulerLeaseId = "scheduler"
+
+// leaderElector runs the scheduler on only one instance at a time.  The
+// instance holding the scheduler lease in the database is the leader, and
+// renews the lease every ttl/3.  Standby instances try to acquire the lease
+// at the same interval, so when the leader dies another instance takes over
+// within ttl + ttl/3.  Leaders step down if they can not renew the lease
+// before it expires.
+type leaderElector struct {
+	owner    string
+	ttl      time.Duration
+	interval time.Duration
+
+	acquire func(id, owner string, now time.Time, ttl time.Duration) (bool, error)
+	release func(id, owner string) error
+
+	// start is called when this instance becomes the leader, and closes its
+	// argument when it stops being the leader.
+	start func(stop <-chan struct{})
+
+	leader  bool
+	renewed time.Time
+	stop    chan struct{}
+}
+
+func newLeaderElector(start func(stop <-chan struct{})) *leaderElector {
+	hostname, _ := os.Hostname()
+	ttl := setting.Alerting.SchedulerLeaseTTL
+	return &leaderElector{
+		owner:    fmt.Sprintf("%s-%s-%d", setting.InstanceId, hostname, os.Getpid()),
+		ttl:      ttl,
+		interval: ttl / 3,
+		acquire:  sqlstore.AcquireAlertSchedulerLease,
+		release:  sqlstore.ReleaseAlertSchedulerLease,
+		start:    start,
+	}
+}
+
+func (l *leaderElector) Run(shutdown <-chan struct{}) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	l.tick(time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			l.tick(now)
+		case <-shutdown:
+			if l.leader {
+				l.stepDown()
+				if err := l.release(schedulerLeaseId, l.owner); err != nil {
+					log.Error(3, "Alerting: failed to release scheduler lease. %s", err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// tick tries to acquire or renew the lease, and starts or stops the
+// scheduler when leadership changes.
+func (l *leaderElector) tick(now time.Time) {
+	acquired, err := l.acquire(schedulerLeaseId, l.owner, now, l.ttl)
+	if err != nil {
+		log.Error(3, "Alerting: failed to acquire scheduler lease. %s", err)
+		// the lease may expire before we get another chance to renew it.
+		if l.leader && now.Add(l.interval).Sub(l.renewed) >= l.ttl {
+			log.Warn("Alerting: scheduler lease could not be renewed.")
+			l.stepDown()
+		}
+		return
+	}
+	if !acquired {
+		if l.leader {
+			log.Warn("Alerting: scheduler lease has been taken over by another instance.")
+			l.stepDown()
+		}
+		return
+	}
+	l.renewed = now
+	if !l.leader {
+		log.Info("Alerting: %s is now the scheduler leader.", l.owner)
+		l.leader = true
+		l.stop = make(chan struct{})
+		schedulerLeader.Value(1)
+		schedulerLeaderChanges.Inc(1)
+		l.start(l.stop)
+	}
+}
+
+func (l *leaderElector) stepDown() {
+	log.Info("Alerting: %s is no longer the scheduler leader.", l.owner)
+	close(l.stop)
+	l.leader = false
+	schedulerLeader.Value(0)
+	schedulerLeaderChanges.Inc(1)
+}
@@ -0,0 +1,193 @@
+package alerting
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bosun.org/graphite"
+	"gopkg.in/raintank/schema.v1"
+)
+
+// BufferResults adds the results received from probes to the in-memory
+// datasource, if it is the datasource used for alerting.
+func BufferResults(metrics []*schema.MetricData) {
+	if ds, ok := getDatasource().(*MemoryDatasource); ok {
+		ds.Add(metrics)
+	}
+}
+
+// MemoryDatasource keeps the most recent points of each series reported by
+// probes in memory, so that alerting can run without an external TSDB.  It
+// is fed directly with the results received from probes, so it can only be
+// used when the alert executor runs in the same process as the probe
+// sockets.
+type MemoryDatasource struct {
+	sync.RWMutex
+	size      int
+	retention time.Duration
+	series    map[memorySeriesKey]map[string]*memoryRing
+	lastPrune time.Time
+}
+
+// memorySeriesKey identifies the series of a metric for a check of an
+// endpoint.  Each has a ring per probe.
+type memorySeriesKey struct {
+	orgId     int64
+	endpoint  string
+	checkType string
+	metric    string
+}
+
+// NewMemoryDatasource returns a MemoryDatasource that keeps up to size
+// points per series.  Series that have not been updated in the last
+// retention are removed.
+func NewMemoryDatasource(size int, retention time.Duration) *MemoryDatasource {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryDatasource{
+		size:      size,
+		retention: retention,
+		series:    make(map[memorySeriesKey]map[string]*memoryRing),
+		lastPrune: time.Now(),
+	}
+}
+
+// Add stores the points of metrics named
+// worldping.<endpoint>.<probe>.<checkType>.<metric>.  Other metrics are ignored.
+func (d *MemoryDatasource) Add(metrics []*schema.MetricData) {
+	now := time.Now()
+	d.Lock()
+	defer d.Unlock()
+	for _, metric := range metrics {
+		parts := strings.Split(metric.Name, ".")
+		if len(parts) != 5 || parts[0] != "worldping" {
+			continue
+		}
+		key := memorySeriesKey{
+			orgId:     int64(metric.OrgId),
+			endpoint:  parts[1],
+			checkType: parts[3],
+			metric:    parts[4],
+		}
+		probes, ok := d.series[key]
+		if !ok {
+			probes = make(map[string]*memoryRing)
+			d.series[key] = probes
+		}
+		ring, ok := probes[parts[2]]
+		if !ok {
+			ring = newMemoryRing(d.size)
+			probes[parts[2]] = ring
+		}
+		ring.add(metric.Time, metric.Value, now)
+	}
+	if d.retention > 0 && now.Sub(d.lastPrune) > d.retention {
+		d.prune(now.Add(-d.retention))
+		d.lastPrune = now
+	}
+}
+
+// prune removes the series that have not been updated since before.
+func (d *MemoryDatasource) prune(before time.Time) {
+	for key, probes := range d.series {
+		for probe, ring := range probes {
+			if ring.updated.Before(before) {
+				delete(probes, probe)
+			}
+		}
+		if len(probes) == 0 {
+			delete(d.series, key)
+		}
+	}
+}
+
+func (d *MemoryDatasource) Query(q *SeriesQuery) (graphite.Response, error) {
+	key := memorySeriesKey{
+		orgId:     q.OrgId,
+		endpoint:  q.Endpoint,
+		checkType: strings.ToLower(q.CheckType),
+		metric:    q.Metric,
+	}
+	from := q.From.Unix()
+	to := q.To.Unix()
+
+	d.RLock()
+	defer d.RUnlock()
+	probes := d.series[key]
+	res := make(graphite.Response, 0, len(probes))
+	for probe, ring := range probes {
+		serie := graphite.Series{
+			Target:     q.target(probe),
+			Datapoints: make([]graphite.DataPoint, 0),
+		}
+		for _, p := range ring.points(from, to) {
+			serie.Datapoints = append(serie.Datapoints, graphite.DataPoint{
+				json.Number(strconv.FormatFloat(p.val, 'f', -1, 64)),
+				json.Number(strconv.FormatInt(p.ts, 10)),
+			})
+		}
+		res = append(res, serie)
+	}
+	sort.Sort(seriesByTarget(res))
+	return res, nil
+}
+
+type seriesByTarget graphite.Response
+
+func (s seriesByTarget) Len() int           { return len(s) }
+func (s seriesByTarget) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s seriesByTarget) Less(i, j int) bool { return s[i].Target < s[j].Target }
+
+type memoryPoint struct {
+	ts  int64
+	val float64
+}
+
+// memoryRing is a fixed size ring buffer of the points of a series.
+type memoryRing struct {
+	buf     []memoryPoint
+	next    int
+	full    bool
+	updated time.Time
+}
+
+func newMemoryRing(size int) *memoryRing {
+	return &memoryRing{buf: make([]memoryPoint, size)}
+}
+
+func (r *memoryRing) add(ts int64, val float64, now time.Time) {
+	r.buf[r.next] = memoryPoint{ts: ts, val: val}
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+	r.updated = now
+}
+
+// points returns the points with from < ts <= to, sorted by timestamp.
+func (r *memoryRing) points(from, to int64) []memoryPoint {
+	count := r.next
+	if r.full {
+		count = len(r.buf)
+	}
+	points := make([]memoryPoint, 0, count)
+	for i := 0; i < count; i++ {
+		p := r.buf[(r.next-count+i+len(r.buf))%len(r.buf)]
+		if p.ts > from && p.ts <= to {
+			points = append(points, p)
+		}
+	}
+	sort.Stable(pointsByTs(points))
+	return points
+}
+
+type pointsByTs []memoryPoint
+
+func (p pointsByTs) Len() int           { return len(p) }
+func (p pointsByTs) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p pointsByTs) Less(i, j int) bool { return p[i].ts < p[j].ts }
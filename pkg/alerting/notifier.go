@@ -0,0 +1,434 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/raintank/worldping-api/pkg/log"
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/services/notifications"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+	"github.com/raintank/worldping-api/pkg/setting"
+)
+
+const defaultPagerDutyUrl = "https://events.pagerduty.com/v2/enqueue"
+
+// Notifier delivers check state changes to a single notification channel.
+type Notifier interface {
+	Type() m.NotificationChannelType
+	Notify(job *m.AlertingJob) error
+}
+
+// NewNotifier returns the Notifier implementation for the channel type.
+func NewNotifier(channel *m.NotificationChannel) (Notifier, error) {
+	switch channel.Type {
+	case m.EmailChannel:
+		return newEmailNotifier(channel.Setting("addresses")), nil
+	case m.WebhookChannel:
+		return &webhookNotifier{
+			url:      channel.Setting("url"),
+			method:   channel.Setting("method"),
+			username: channel.Setting("username"),
+			password: channel.Setting("password"),
+			warnings: channel.Setting("notifyWarning") == "true",
+		}, nil
+	case m.SlackChannel:
+		return &slackNotifier{
+			url:      channel.Setting("url"),
+			channel:  channel.Setting("channel"),
+			username: channel.Setting("username"),
+			warnings: channel.Setting("notifyWarning") == "true",
+		}, nil
+	case m.PagerDutyChannel:
+		url := channel.Setting("url")
+		if url == "" {
+			url = defaultPagerDutyUrl
+		}
+		return &pagerDutyNotifier{
+			url:        url,
+			routingKey: channel.Setting("routingKey"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown notification channel type. %s", channel.Type)
+	}
+}
+
+// getNotifiers returns the notifiers configured for the job's check, including
+// any org level notifiers referenced by id.  The legacy comma separated
+// Addresses list is treated as an email channel.
+func getNotifiers(job *m.AlertingJob) []Notifier {
+	settings := job.HealthSettings.Notifications
+	return buildNotifiers(job, settings.Addresses, settings.Channels, settings.Notifiers)
+}
+
+func buildNotifiers(job *m.AlertingJob, addresses string, channels []m.NotificationChannel, notifierIds []int64) []Notifier {
+	notifiers := make([]Notifier, 0)
+	if strings.TrimSpace(addresses) != "" {
+		notifiers = append(notifiers, newEmailNotifier(addresses))
+	}
+	for i := range channels {
+		n, err := NewNotifier(&channels[i])
+		if err != nil {
+			log.Error(3, "invalid notification channel. OrgId: %d monitorId: %d. %s", job.OrgId, job.Id, err)
+			continue
+		}
+		notifiers = append(notifiers, n)
+	}
+	if len(notifierIds) > 0 {
+		targets, err := sqlstore.GetNotifiersByIds(job.OrgId, notifierIds)
+		if err != nil {
+			log.Error(3, "failed to get notifiers. OrgId: %d monitorId: %d. %s", job.OrgId, job.Id, err)
+			return notifiers
+		}
+		for i := range targets {
+			n, err := NewNotifier(targets[i].Channel())
+			if err != nil {
+				log.Error(3, "invalid notifier %d. OrgId: %d monitorId: %d. %s", targets[i].Id, job.OrgId, job.Id, err)
+				continue
+			}
+			notifiers = append(notifiers, n)
+		}
+	}
+	return notifiers
+}
+
+// deliver sends the notification, retrying failed attempts up to
+// setting.Alerting.NotificationRetries times.
+func deliver(n Notifier, job *m.AlertingJob) error {
+	var err error
+	for attempt := 0; attempt <= setting.Alerting.NotificationRetries; attempt++ {
+		if attempt > 0 {
+			notifierRetries.Inc(1)
+			time.Sleep(setting.Alerting.NotificationRetryDelay)
+		}
+		pre := time.Now()
+		err = n.Notify(job)
+		notifierDeliveryDuration.Value(time.Since(pre))
+		if err == nil {
+			notifierDeliveriesOk.Inc(1)
+			return nil
+		}
+		log.Warn("failed to send %s notification. OrgId: %d monitorId: %d attempt: %d. %s", n.Type(), job.OrgId, job.Id, attempt+1, err)
+	}
+	notifierDeliveriesFailed.Inc(1)
+	return err
+}
+
+// notificationPayload is the JSON document posted to webhooks, and the source
+// of the details included in slack and pagerduty messages.
+type notificationPayload struct {
+	OrgId        int64                  `json:"orgId"`
+	CheckId      int64                  `json:"checkId"`
+	EndpointId   int64                  `json:"endpointId"`
+	EndpointName string                 `json:"endpointName"`
+	EndpointSlug string                 `json:"endpointSlug"`
+	CheckType    string                 `json:"checkType"`
+	State        string                 `json:"state"`
+	Flapping     string                 `json:"flapping,omitempty"`
+	Maintenance  string                 `json:"maintenanceWindow,omitempty"`
+	Escalated    bool                   `json:"escalated,omitempty"`
+	Backfilled   bool                   `json:"backfilled,omitempty"`
+	StateChange  time.Time              `json:"stateChange"`
+	Settings     map[string]interface{} `json:"settings"`
+	TimeLastData time.Time              `json:"timeLastData"`
+	TimeExec     time.Time              `json:"timeExec"`
+}
+
+func newNotificationPayload(job *m.AlertingJob) *notificationPayload {
+	p := &notificationPayload{
+		OrgId:        job.OrgId,
+		CheckId:      job.Id,
+		EndpointId:   job.EndpointId,
+		EndpointName: job.Name,
+		EndpointSlug: job.Slug,
+		CheckType:    job.Type,
+		State:        job.NewState.String(),
+		Settings:     job.Settings,
+		Escalated:    job.Escalated,
+		Backfilled:   job.Backfill,
+		TimeLastData: job.LastPointTs,
+		TimeExec:     job.TimeExec,
+	}
+	if job.Escalated {
+		// the state of the job is the state the check has been in since
+		// StateChange, not a new state.
+		p.StateChange = job.StateChange
+	} else {
+		p.StateChange = job.TimeExec
+	}
+	if job.MaintenanceWindow != nil {
+		p.Maintenance = job.MaintenanceWindow.Name
+	}
+	switch job.Flap {
+	case m.FlapStarted:
+		p.Flapping = "started"
+	case m.FlapStopped:
+		p.Flapping = "stopped"
+	}
+	return p
+}
+
+func (p *notificationPayload) Summary() string {
+	switch p.Flapping {
+	case "started":
+		return fmt.Sprintf("%s for %s is flapping", p.CheckType, p.EndpointName)
+	case "stopped":
+		return fmt.Sprintf("%s for %s is no longer flapping and is %s", p.CheckType, p.EndpointName, p.State)
+	}
+	if p.Escalated {
+		return fmt.Sprintf("%s for %s has been %s for %s", p.CheckType, p.EndpointName, p.State, p.TimeExec.Sub(p.StateChange)/time.Minute*time.Minute)
+	}
+	if p.Backfilled {
+		return fmt.Sprintf("%s for %s was %s at %s", p.CheckType, p.EndpointName, p.State, p.StateChange.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s for %s is %s", p.CheckType, p.EndpointName, p.State)
+}
+
+type emailNotifier struct {
+	addresses []string
+}
+
+func newEmailNotifier(addresses string) *emailNotifier {
+	n := &emailNotifier{addresses: make([]string, 0)}
+	for _, email := range strings.Split(addresses, ",") {
+		email := strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+		n.addresses = append(n.addresses, email)
+	}
+	return n
+}
+
+func (n *emailNotifier) Type() m.NotificationChannelType {
+	return m.EmailChannel
+}
+
+func (n *emailNotifier) Notify(job *m.AlertingJob) error {
+	if len(n.addresses) == 0 {
+		log.Debug("no email addresses provided. OrgId: %d monitorId: %d", job.OrgId, job.Id)
+		return nil
+	}
+	log.Info("sending email. addr=%s, orgId=%d, monitorId=%d, endpointSlug=%s, state=%s", strings.Join(n.addresses, ","), job.OrgId, job.Id, job.Slug, job.NewState.String())
+	state := job.NewState.String()
+	if job.Flap == m.FlapStarted {
+		state = "Flapping"
+	}
+	maintenance := ""
+	if job.MaintenanceWindow != nil {
+		maintenance = job.MaintenanceWindow.Name
+	}
+	escalatedFor := ""
+	if job.Escalated {
+		escalatedFor = (job.TimeExec.Sub(job.StateChange) / time.Minute * time.Minute).String()
+	}
+	sendCmd := m.SendEmailCommand{
+		To:       n.addresses,
+		Template: "alerting_notification.html",
+		Data: map[string]interface{}{
+			"EndpointId":   job.EndpointId,
+			"EndpointName": job.Name,
+			"EndpointSlug": job.Slug,
+			"Settings":     job.Settings,
+			"CheckType":    job.Type,
+			"State":        state,
+			"FlapStopped":  job.Flap == m.FlapStopped,
+			"Maintenance":  maintenance,
+			"EscalatedFor": escalatedFor,
+			"Backfilled":   job.Backfill,
+			"TimeLastData": job.LastPointTs, // timestamp of the most recent data used
+			"TimeExec":     job.TimeExec,    // when we executed the alerting rule and made the determination
+		},
+	}
+	return notifications.SendEmail(&sendCmd)
+}
+
+type webhookNotifier struct {
+	url      string
+	method   string
+	username string
+	password string
+	warnings bool
+}
+
+func (n *webhookNotifier) Type() m.NotificationChannelType {
+	return m.WebhookChannel
+}
+
+func (n *webhookNotifier) Notify(job *m.AlertingJob) error {
+	if skipWarning(job, n.warnings) {
+		log.Debug("not sending webhook for warning state. OrgId: %d monitorId: %d", job.OrgId, job.Id)
+		return nil
+	}
+	body, err := json.Marshal(newNotificationPayload(job))
+	if err != nil {
+		return err
+	}
+	method := strings.ToUpper(n.method)
+	if method == "" {
+		method = "POST"
+	}
+	req, err := http.NewRequest(method, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if n.username != "" {
+		req.SetBasicAuth(n.username, n.password)
+	}
+	return sendNotificationRequest(req)
+}
+
+type slackNotifier struct {
+	url      string
+	channel  string
+	username string
+	warnings bool
+}
+
+func (n *slackNotifier) Type() m.NotificationChannelType {
+	return m.SlackChannel
+}
+
+func (n *slackNotifier) Notify(job *m.AlertingJob) error {
+	if skipWarning(job, n.warnings) {
+		log.Debug("not sending slack message for warning state. OrgId: %d monitorId: %d", job.OrgId, job.Id)
+		return nil
+	}
+	payload := newNotificationPayload(job)
+	color := "#666666"
+	switch job.NewState {
+	case m.EvalResultOK:
+		color = "#01A64F"
+	case m.EvalResultWarn:
+		color = "#FF9830"
+	case m.EvalResultCrit:
+		color = "#EC2128"
+	}
+	if job.Flap == m.FlapStarted {
+		color = "#A352CC"
+	}
+	msg := map[string]interface{}{
+		"text": payload.Summary(),
+		"attachments": []map[string]interface{}{
+			{
+				"color":    color,
+				"fallback": payload.Summary(),
+				"fields": []map[string]interface{}{
+					{"title": "Endpoint", "value": payload.EndpointName, "short": true},
+					{"title": "Check", "value": payload.CheckType, "short": true},
+					{"title": "State", "value": payload.State, "short": true},
+				},
+				"ts": payload.TimeExec.Unix(),
+			},
+		},
+	}
+	if n.channel != "" {
+		msg["channel"] = n.channel
+	}
+	if n.username != "" {
+		msg["username"] = n.username
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return sendNotificationRequest(req)
+}
+
+// skipWarning returns true if a check becoming degraded should not be sent
+// to a channel that only wants warnings when its notifyWarning setting is
+// enabled.  The channel is still told when a critical check improves, or
+// when flapping starts or stops, so it is not left showing a stale state.
+func skipWarning(job *m.AlertingJob, warnings bool) bool {
+	if warnings || job.NewState != m.EvalResultWarn || job.Flap != m.FlapNone {
+		return false
+	}
+	return job.State != m.EvalResultCrit
+}
+
+type pagerDutyNotifier struct {
+	url        string
+	routingKey string
+}
+
+func (n *pagerDutyNotifier) Type() m.NotificationChannelType {
+	return m.PagerDutyChannel
+}
+
+func (n *pagerDutyNotifier) Notify(job *m.AlertingJob) error {
+	if job.Flap == m.FlapStarted {
+		// flapping is informational, only critical state changes page anyone.
+		log.Debug("not sending pagerduty event for flapping check. OrgId: %d monitorId: %d", job.OrgId, job.Id)
+		return nil
+	}
+	payload := newNotificationPayload(job)
+	action := "trigger"
+	severity := "warning"
+	switch job.NewState {
+	case m.EvalResultOK:
+		action = "resolve"
+		severity = "info"
+	case m.EvalResultWarn:
+		// degraded checks dont page anyone. If the check was critical
+		// then the open incident is resolved.  State changes are not
+		// notified while flapping, so when flapping stops any incident
+		// that may still be open is resolved.
+		if job.State != m.EvalResultCrit && job.Flap != m.FlapStopped {
+			log.Debug("not sending pagerduty event for warning state. OrgId: %d monitorId: %d", job.OrgId, job.Id)
+			return nil
+		}
+		action = "resolve"
+		severity = "info"
+	case m.EvalResultCrit:
+		severity = "critical"
+	}
+	event := map[string]interface{}{
+		"routing_key":  n.routingKey,
+		"event_action": action,
+		// all events for the same check are grouped into a single incident.
+		"dedup_key": fmt.Sprintf("worldping-%d-%d", job.OrgId, job.Id),
+		"payload": map[string]interface{}{
+			"summary":        payload.Summary(),
+			"source":         payload.EndpointSlug,
+			"severity":       severity,
+			"timestamp":      payload.TimeExec.Format(time.RFC3339),
+			"custom_details": payload,
+		},
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return sendNotificationRequest(req)
+}
+
+func sendNotificationRequest(req *http.Request) error {
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: setting.Alerting.NotificationTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s returned %d: %s", req.Method, req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	// drain the body so the connection can be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
@@ -32,3 +32,26 @@ func setOffset(offset int) {
 		log.Error(3, "Could not persist offset: %q", err)
 	}
 }
+
+// loadLastDispatched returns the last timestamp that jobs were dispatched
+// for, or 0 if it is unknown.
+func loadLastDispatched() int64 {
+	value, err := sqlstore.GetAlertSchedulerValue("lastDispatched")
+	if err != nil {
+		log.Error(3, "failure querying for last dispatched timestamp: %q", err)
+		return 0
+	}
+	if value == "" {
+		return 0
+	}
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Error(3, "failure reading in last dispatched timestamp: %q. input value was: %q", err, value)
+		return 0
+	}
+	return ts
+}
+
+func saveLastDispatched(ts int64) error {
+	return sqlstore.UpdateAlertSchedulerValue("lastDispatched", strconv.FormatInt(ts, 10))
+}
@@ -0,0 +1,196 @@
+package alerting
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"bosun.org/graphite"
+	"github.com/raintank/worldping-api/pkg/log"
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+)
+
+// Preview replays the alerting rules of the check over its error_state
+// series between from and to, evaluating the check every Frequency seconds
+// as the executor would.  It returns the states the check would have been in
+// and the notifications that would have been sent.  Nothing is written to
+// the database, and flap detection, maintenance windows and escalations are
+// not taken into account.
+func Preview(check *m.CheckForAlertDTO, from, to time.Time) (*m.AlertPreview, error) {
+	if check.HealthSettings == nil {
+		return nil, m.NewValidationError("check has no healthSettings.")
+	}
+	if check.Frequency <= 0 {
+		return nil, m.NewValidationError("check frequency must be greater than 0.")
+	}
+	freq := time.Duration(check.Frequency) * time.Second
+	if int64(to.Sub(from)/freq) >= m.MaxAlertPreviewEvaluations {
+		return nil, m.NewValidationError(fmt.Sprintf("time range too large. At most %d evaluations can be previewed.", m.MaxAlertPreviewEvaluations))
+	}
+
+	window := freq * time.Duration(check.HealthSettings.Steps)
+	query := &SeriesQuery{
+		OrgId:     check.OrgId,
+		Endpoint:  check.Slug,
+		CheckType: check.Type,
+		Metric:    "error_state",
+		Step:      freq,
+		From:      from.Add(-window),
+		To:        to,
+	}
+	res, err := getDatasource().Query(query)
+	if err != nil {
+		return nil, err
+	}
+	series, err := newPreviewSeries(res)
+	if err != nil {
+		return nil, err
+	}
+
+	var thresholdSeries previewSeries
+	var thresholdWindow time.Duration
+	if t := check.HealthSettings.MetricThreshold; t != nil {
+		thresholdWindow = freq * time.Duration(t.Steps)
+		thresholdQuery := *query
+		thresholdQuery.Metric = t.Metric
+		thresholdQuery.From = from.Add(-thresholdWindow)
+		res, err := getDatasource().Query(&thresholdQuery)
+		if err != nil {
+			return nil, err
+		}
+		thresholdSeries, err = newPreviewSeries(res)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	preview := &m.AlertPreview{
+		CheckId:       check.Id,
+		EndpointId:    check.EndpointId,
+		CheckType:     check.Type,
+		From:          from,
+		To:            to,
+		Timeline:      make([]m.AlertPreviewState, 0),
+		Notifications: make([]m.AlertPreviewNotification, 0),
+	}
+	var targets []string
+	if check.HealthSettings.Notifications.Enabled {
+		targets = describeNotificationTargets(check.OrgId, check.HealthSettings.Notifications)
+	}
+
+	var probes map[string]*m.ProbeDTO
+	if len(check.HealthSettings.Conditions) > 0 {
+		probes, err = getProbesBySlug(check.OrgId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state := m.CheckEvalResult(m.EvalResultUnknown)
+	for t := from; !t.After(to); t = t.Add(freq) {
+		newState := m.CheckEvalResult(m.EvalResultUnknown)
+		if len(series) > 0 {
+			newState, err = evalWithConditions(series.window(t.Add(-window).Unix(), t.Unix()), check.HealthSettings, probes)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(thresholdSeries) > 0 && newState != m.EvalResultCrit && newState != m.EvalResultUnknown {
+			thresholdState, err := evalMetricThreshold(thresholdSeries.window(t.Add(-thresholdWindow).Unix(), t.Unix()), check.HealthSettings.MetricThreshold)
+			if err != nil {
+				return nil, err
+			}
+			if thresholdState > newState {
+				newState = thresholdState
+			}
+		}
+		preview.Evaluations++
+		if preview.Evaluations > 1 && newState == state {
+			continue
+		}
+		preview.Timeline = append(preview.Timeline, m.AlertPreviewState{Timestamp: t, State: newState})
+		// the state at the start of the range is not a change.
+		if preview.Evaluations > 1 && len(targets) > 0 {
+			preview.Notifications = append(preview.Notifications, m.AlertPreviewNotification{
+				Timestamp: t,
+				PrevState: state,
+				State:     newState,
+				Targets:   targets,
+			})
+		}
+		state = newState
+	}
+	return preview, nil
+}
+
+// previewSeries holds graphite series sorted by timestamp, so that the
+// points within each evaluation window can be sliced out of them.
+type previewSeries []previewSerie
+
+type previewSerie struct {
+	target     string
+	timestamps []int64
+	datapoints []graphite.DataPoint
+}
+
+func newPreviewSeries(res graphite.Response) (previewSeries, error) {
+	series := make(previewSeries, len(res))
+	for i, s := range res {
+		serie := previewSerie{
+			target:     s.Target,
+			timestamps: make([]int64, len(s.Datapoints)),
+			datapoints: s.Datapoints,
+		}
+		for j, dp := range s.Datapoints {
+			ts, err := dp[1].Int64()
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp %q in series %s. %s", dp[1].String(), s.Target, err)
+			}
+			serie.timestamps[j] = ts
+		}
+		series[i] = serie
+	}
+	return series, nil
+}
+
+// window returns the points of each series with from < ts <= to.
+func (series previewSeries) window(from, to int64) graphite.Response {
+	res := make(graphite.Response, len(series))
+	for i, s := range series {
+		lo := sort.Search(len(s.timestamps), func(j int) bool { return s.timestamps[j] > from })
+		hi := sort.Search(len(s.timestamps), func(j int) bool { return s.timestamps[j] > to })
+		res[i] = graphite.Series{
+			Target:     s.target,
+			Datapoints: s.datapoints[lo:hi],
+		}
+	}
+	return res
+}
+
+// describeNotificationTargets returns a description of each target that
+// the notification settings would notify.
+func describeNotificationTargets(orgId int64, settings m.CheckNotificationSetting) []string {
+	targets := make([]string, 0)
+	if strings.TrimSpace(settings.Addresses) != "" {
+		targets = append(targets, "email:"+settings.Addresses)
+	}
+	for _, c := range settings.Channels {
+		if c.Type == m.EmailChannel {
+			targets = append(targets, "email:"+c.Setting("addresses"))
+			continue
+		}
+		targets = append(targets, string(c.Type))
+	}
+	if len(settings.Notifiers) > 0 {
+		notifiers, err := sqlstore.GetNotifiersByIds(orgId, settings.Notifiers)
+		if err != nil {
+			log.Error(3, "failed to get notifiers. OrgId: %d. %s", orgId, err)
+		}
+		for _, n := range notifiers {
+			targets = append(targets, fmt.Sprintf("notifier:%s", n.Name))
+		}
+	}
+	return targets
+}
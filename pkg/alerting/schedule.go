@@ -31,17 +31,31 @@ func getJobs(lastPointAt int64) ([]*m.AlertingJob, error) {
 	return jobs, nil
 }
 
-func dispatchJobs(jobQ *jobqueue.JobQueue) {
+func dispatchJobs(jobQ *jobqueue.JobQueue, stop <-chan struct{}) {
 	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 	offsetTicker := time.NewTicker(time.Minute)
+	defer offsetTicker.Stop()
 	newOffsetChan := make(chan int)
 	offset := LoadOrSetOffset()
 	log.Info("Alerting using offset %d", offset)
-	next := time.Now().Unix() - int64(offset)
+	bf, next := newBackfill(time.Now().Unix()-int64(offset), loadLastDispatched())
 	for {
 		select {
 		case lastPointAt := <-ticker.C:
-			for next <= lastPointAt.Unix()-int64(offset) {
+			last := lastPointAt.Unix() - int64(offset)
+			limit := bf.limit(next, last)
+			// persist our progress before dispatching, so that a scheduler
+			// taking over after an outage knows which seconds were missed and
+			// never dispatches a second again.  If we die part way through
+			// the tick the rest of its seconds are missed instead.
+			if limit >= next {
+				if err := saveLastDispatched(limit); err != nil {
+					log.Error(3, "Could not persist last dispatched timestamp: %q", err)
+					break
+				}
+			}
+			for next <= limit {
 				pre := time.Now()
 				jobs, err := getJobs(next)
 				next++
@@ -57,21 +71,32 @@ func dispatchJobs(jobQ *jobqueue.JobQueue) {
 				for _, job := range jobs {
 					job.GeneratedAt = time.Now()
 					job.LastPointTs = time.Unix(next-1, 0)
+					job.Backfill = bf.missed(next - 1)
 					jobQ.QueueJob(job)
 					dispatcherJobsScheduled.Inc(1)
 				}
+				bf.dispatched(next-1, len(jobs))
+			}
+			if next > last {
+				bf.caughtUp()
 			}
 		case <-offsetTicker.C:
 			// run this in a separate goroutine so we dont block the scheduler.
 			go func() {
 				newOffset := LoadOrSetOffset()
 				if newOffset != offset {
-					newOffsetChan <- newOffset
+					select {
+					case newOffsetChan <- newOffset:
+					case <-stop:
+					}
 				}
 			}()
 		case newOffset := <-newOffsetChan:
 			log.Info("Alerting offset updated to %d", offset)
 			offset = newOffset
+		case <-stop:
+			log.Info("Alerting job Dispatcher stopped")
+			return
 		}
 	}
 }
@@ -47,9 +47,19 @@ func Register(r *macaron.Macaron) {
 			r.Delete("/:id", reqEditorRole, wrap(DeleteEndpoint))
 			r.Get("/discover", reqEditorRole, bind(m.DiscoverEndpointCmd{}), wrap(DiscoverEndpoint))
 			r.Get("/:id", wrap(GetEndpointById))
+			r.Get("/:id/history", bind(m.GetCheckStateHistoryQuery{}), wrap(GetEndpointHistory))
+			r.Get("/:id/sla", bind(m.GetSLAReportQuery{}), GetEndpointSLA)
 			r.Post("/disable", reqEditorRole, wrap(DisableEndpoints))
 		})
 
+		r.Group("/checks", func() {
+			r.Post("/preview", bind(m.PreviewAlertCmd{}), wrap(PreviewAlert))
+			r.Get("/:id/history", bind(m.GetCheckStateHistoryQuery{}), wrap(GetCheckHistory))
+			r.Get("/:id/sla", bind(m.GetSLAReportQuery{}), GetCheckSLA)
+			r.Post("/:id/ack", reqEditorRole, bind(m.AckCheckCmd{}), wrap(AckCheck))
+			r.Delete("/:id/ack", reqEditorRole, wrap(UnackCheck))
+		})
+
 		r.Group("/probes", func() {
 			r.Combo("/").
 				Get(bind(m.GetProbesQuery{}), wrap(GetProbes)).
@@ -58,10 +68,38 @@ func Register(r *macaron.Macaron) {
 			r.Delete("/:id", reqEditorRole, wrap(DeleteProbe))
 			r.Get("/locations", V1GetCollectorLocations)
 			r.Get("/:id", wrap(GetProbeById))
+			r.Combo("/:id/tokens").
+				Get(wrap(GetProbeTokens)).
+				Post(reqEditorRole, wrap(AddProbeToken))
+			r.Delete("/:id/tokens/:tokenId", reqEditorRole, wrap(DeleteProbeToken))
+		})
+
+		r.Group("/notifiers", func() {
+			r.Combo("/").
+				Get(bind(m.GetNotifiersQuery{}), wrap(GetNotifiers)).
+				Post(reqEditorRole, bind(m.Notifier{}), wrap(AddNotifier)).
+				Put(reqEditorRole, bind(m.Notifier{}), wrap(UpdateNotifier))
+			r.Delete("/:id", reqEditorRole, wrap(DeleteNotifier))
+			r.Get("/:id", wrap(GetNotifierById))
+		})
+
+		r.Group("/maintenance", func() {
+			r.Combo("/").
+				Get(bind(m.GetMaintenanceWindowsQuery{}), wrap(GetMaintenanceWindows)).
+				Post(reqEditorRole, bind(m.MaintenanceWindow{}), wrap(AddMaintenanceWindow)).
+				Put(reqEditorRole, bind(m.MaintenanceWindow{}), wrap(UpdateMaintenanceWindow))
+			r.Delete("/:id", reqEditorRole, wrap(DeleteMaintenanceWindow))
+			r.Get("/:id", wrap(GetMaintenanceWindowById))
 		})
 
 	}, middleware.Auth(setting.AdminKey))
 
+	// endpoints used by probes, which also accept probe tokens.
+	r.Group("/api/v2/probes", func() {
+		r.Get("/self/checks", GetSelfChecks)
+		r.Post("/:id/results", bind(m.ProbeResultsCmd{}), wrap(PushProbeResults))
+	}, middleware.ProbeAuth(setting.AdminKey))
+
 	r.Get("/_key", middleware.Auth(setting.AdminKey), wrap(GetApiKey))
 
 	// Old v1 api endpoint.
@@ -149,6 +149,8 @@ func checkTypeToId(t m.CheckType) int64 {
 		m.HTTPS_CHECK: 2,
 		m.PING_CHECK:  3,
 		m.DNS_CHECK:   4,
+		m.TCP_CHECK:   5,
+		m.CERT_CHECK:  6,
 	}
 	typeNum, exists := lookup[t]
 	if !exists {
@@ -81,7 +81,7 @@ func V1AddMonitor(c *middleware.Context, cmd m.AddMonitorCommand) {
 		c.JSON(400, "MonitorTypeId not set.")
 		return
 	}
-	if cmd.MonitorTypeId > 4 {
+	if cmd.MonitorTypeId > int64(len(m.MonitorTypeToCheckTypeMap)) {
 		c.JSON(400, "Invlaid MonitorTypeId.")
 		return
 	}
@@ -179,7 +179,7 @@ func V1UpdateMonitor(c *middleware.Context, cmd m.UpdateMonitorCommand) {
 		c.JSON(400, "MonitorTypeId not set.")
 		return
 	}
-	if cmd.MonitorTypeId > 4 {
+	if cmd.MonitorTypeId > int64(len(m.MonitorTypeToCheckTypeMap)) {
 		c.JSON(400, "Invlaid MonitorTypeId.")
 		return
 	}
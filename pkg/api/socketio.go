@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net"
+	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +17,7 @@ import (
 	"github.com/hashicorp/go-version"
 	"github.com/raintank/met"
 	"github.com/raintank/raintank-apps/pkg/auth"
+	"github.com/raintank/worldping-api/pkg/alerting"
 	"github.com/raintank/worldping-api/pkg/events"
 	"github.com/raintank/worldping-api/pkg/log"
 	"github.com/raintank/worldping-api/pkg/middleware"
@@ -33,9 +37,12 @@ var publisher services.MetricsEventsPublisher
 
 var (
 	metricsRecvd                  met.Count
+	resultsSkewRejected           met.Count
+	resultsSkewCorrected          met.Count
 	ProbesConnected               met.Gauge
 	ProbeSessionCreatedEventsSeen met.Count
 	ProbeSessionDeletedEventsSeen met.Count
+	ProbeSessionUpdatedEventsSeen met.Count
 	UpdatesSent                   met.Count
 	CreatesSent                   met.Count
 	RemovesSent                   met.Count
@@ -192,15 +199,24 @@ type CollectorContext struct {
 	Probe       *m.ProbeDTO
 	Socket      socketio.Socket
 	Session     *m.ProbeSession
-	closed      bool
 	LastRefresh time.Time
+	// done is closed when the probe disconnects.
+	done chan struct{}
+	// sessionLock guards changes to Session and saving it to the DB.
+	sessionLock sync.RWMutex
 }
 
-func authenticate(keyString string) (*auth.SignedInUser, error) {
-	if keyString != "" {
-		return auth.Auth(setting.AdminKey, keyString)
+// authenticate returns the user for an org API key or a probe token.  For
+// probe tokens it also returns the probe that the token was issued for.
+func authenticate(keyString string) (*auth.SignedInUser, *m.ProbeDTO, error) {
+	if keyString == "" {
+		return nil, nil, auth.ErrInvalidApiKey
 	}
-	return nil, auth.ErrInvalidApiKey
+	if m.IsProbeToken(keyString) {
+		return middleware.ProbeTokenAuth(keyString)
+	}
+	user, err := auth.Auth(setting.AdminKey, keyString)
+	return user, nil, err
 }
 
 func register(so socketio.Socket) (*CollectorContext, error) {
@@ -208,12 +224,19 @@ func register(so socketio.Socket) (*CollectorContext, error) {
 	req.ParseForm()
 	keyString := req.Form.Get("apiKey")
 
-	user, err := authenticate(keyString)
+	user, probe, err := authenticate(keyString)
 	if err != nil {
 		return nil, err
 	}
 
 	name := req.Form.Get("name")
+	if probe != nil {
+		// probes using a token can only connect as the probe it was issued for.
+		if name != "" && name != probe.Name {
+			return nil, errors.New("probe token was issued for another probe.")
+		}
+		name = probe.Name
+	}
 	if name == "" {
 		return nil, errors.New("probe name not provided.")
 	}
@@ -238,7 +261,9 @@ func register(so socketio.Socket) (*CollectorContext, error) {
 	log.Info("probe %s with version %s connected", name, v.String())
 
 	// lookup collector
-	probe, err := sqlstore.GetProbeByName(name, user.OrgId)
+	if probe == nil {
+		probe, err = sqlstore.GetProbeByName(name, user.OrgId)
+	}
 	if err == m.ErrProbeNotFound {
 		//check quotas
 		ctx := &middleware.Context{
@@ -293,6 +318,7 @@ func register(so socketio.Socket) (*CollectorContext, error) {
 		SignedInUser: user,
 		Probe:        probe,
 		Socket:       so,
+		done:         make(chan struct{}),
 		Session: &m.ProbeSession{
 			OrgId:      user.OrgId,
 			ProbeId:    probe.Id,
@@ -302,6 +328,11 @@ func register(so socketio.Socket) (*CollectorContext, error) {
 			RemoteIp:   remoteIp.String(),
 		},
 	}
+	// probes can send the time on their clock when connecting, which gives a
+	// first estimate of their clock skew until it is measured with clockSync.
+	if ts, err := strconv.ParseInt(req.Form.Get("ts"), 10, 64); err == nil && ts > 0 {
+		sess.Session.ClockSkew = float64(ts - time.Now().UnixNano()/int64(time.Millisecond))
+	}
 
 	log.Info("probe %s with probeId=%d owned by %d authenticated successfully from %s.", name, probe.Id, user.OrgId, remoteIp.String())
 	if lastSocketId != "" {
@@ -332,11 +363,14 @@ func InitCollectorController(metrics met.Backend, pub services.MetricsEventsPubl
 	events.Subscribe("Endpoint.updated", channel)
 	events.Subscribe("Endpoint.deleted", channel)
 	events.Subscribe("ProbeSession.created", channel)
+	events.Subscribe("ProbeSession.updated", channel)
 	events.Subscribe("ProbeSession.deleted", channel)
 	events.Subscribe("Probe.updated", channel)
 	go eventConsumer(channel)
 
 	metricsRecvd = metrics.NewCount("collector-ctrl.metrics-recv")
+	resultsSkewRejected = metrics.NewCount("collector-ctrl.results-skew-rejected")
+	resultsSkewCorrected = metrics.NewCount("collector-ctrl.results-skew-corrected")
 	ProbesConnected = metrics.NewGauge("collector-ctrl.probes-connected", 0)
 
 	UpdatesSent = metrics.NewCount("collector-ctrl.updates-sent")
@@ -351,6 +385,7 @@ func InitCollectorController(metrics met.Backend, pub services.MetricsEventsPubl
 
 	ProbeSessionCreatedEventsSeen = metrics.NewCount("collector-ctrl.probe-session-created-events")
 	ProbeSessionDeletedEventsSeen = metrics.NewCount("collector-ctrl.probe-session-deleted-events")
+	ProbeSessionUpdatedEventsSeen = metrics.NewCount("collector-ctrl.probe-session-updated-events")
 
 	// init GEOIP DB.
 	var err error
@@ -384,16 +419,21 @@ func InitCollectorController(metrics met.Backend, pub services.MetricsEventsPubl
 		log.Info("binding event handlers for probeId=%d", c.Probe.Id)
 		c.Socket.On("event", c.OnEvent)
 		c.Socket.On("results", c.OnResults)
+		c.Socket.On("health", c.OnHealth)
+		c.Socket.On("clockSync", c.OnClockSync)
 		c.Socket.On("disconnection", c.OnDisconnection)
 
 		log.Info("saving probe session to DB for probeId=%d", c.Probe.Id)
+		c.sessionLock.Lock()
 		err = sqlstore.AddProbeSession(c.Session)
+		c.sessionLock.Unlock()
 		if err != nil {
 			log.Error(3, "Failed to add probeSession to DB.", err)
 			so.Emit("error", fmt.Sprintf("internal server error. %s", err.Error()))
 			return
 		}
 		log.Info("saved session to DB for probeId=%d", c.Probe.Id)
+		go c.syncClock()
 		// adding the probeSession will emit an event that will trigger
 		// a refresh to be sent.
 	})
@@ -423,13 +463,15 @@ func (c *CollectorContext) EmitReady() error {
 
 func (c *CollectorContext) Remove() error {
 	log.Info("removing socket with Id %s for probeId=%d", c.Session.SocketId, c.Probe.Id)
+	c.sessionLock.RLock()
 	err := sqlstore.DeleteProbeSession(c.Session)
+	c.sessionLock.RUnlock()
 	log.Info("probe session deleted from db for probeId=%d", c.Probe.Id)
 	return err
 }
 
 func (c *CollectorContext) OnDisconnection() {
-	c.closed = true
+	close(c.done)
 	log.Info("%s disconnected", c.Probe.Name)
 	contextCache.Remove(c.Session.SocketId)
 	if err := c.Remove(); err != nil {
@@ -439,19 +481,134 @@ func (c *CollectorContext) OnDisconnection() {
 
 func (c *CollectorContext) OnEvent(msg *schema.ProbeEvent) {
 	log.Debug("received event from probeId%", c.Probe.Id)
-	if !c.Probe.Public {
-		msg.OrgId = c.OrgId
-	}
+	rewriteEvent(c.Probe, msg)
 	publisher.AddEvent(msg)
 }
 
+// OnHealth stores the health report sent by the probe.  When the check types
+// that the probe supports change, its checks are re-routed, here and on the
+// instances that other sessions of the probe are connected to.  The rest of
+// the report does not affect routing, so other instances are not told about
+// it.
+func (c *CollectorContext) OnHealth(health *m.ProbeHealth) {
+	log.Debug("received health report from probeId=%d", c.Probe.Id)
+	health.Updated = time.Now()
+	c.sessionLock.Lock()
+	last := c.Session.Health
+	c.Session.Health = health
+	err := sqlstore.UpdateProbeSessionHealth(c.Session)
+	session := *c.Session
+	c.sessionLock.Unlock()
+	if err != nil {
+		log.Error(3, "failed to save health report for probeId=%d. %s", c.Probe.Id, err)
+		return
+	}
+	if last == nil || !reflect.DeepEqual(last.CheckTypes, health.CheckTypes) {
+		// checks are routed over all sessions of the probe, including those
+		// connected to other instances.
+		contextCache.Refresh(c.Probe.Id)
+		events.Publish(&events.ProbeSessionUpdated{
+			Ts:      health.Updated,
+			Payload: &session,
+		}, 0)
+	}
+}
+
+// syncClock periodically asks the probe for the time on its clock, to measure
+// its clock skew, until the probe disconnects.
+func (c *CollectorContext) syncClock() {
+	if setting.Probes.ClockSyncInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(setting.Probes.ClockSyncInterval)
+	defer ticker.Stop()
+	for !c.isClosed() {
+		c.Socket.Emit("clockSync", &m.ProbeClockSync{Ts: time.Now().UnixNano() / int64(time.Millisecond)})
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// isClosed returns true once the probe has disconnected.
+func (c *CollectorContext) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// OnClockSync records the clock skew measured from a clockSync reply, and
+// publishes it as a metric of the probe.
+func (c *CollectorContext) OnClockSync(sync *m.ProbeClockSync) {
+	now := time.Now()
+	if sync.Ts == 0 || sync.ProbeTs == 0 || sync.Ts > now.UnixNano()/int64(time.Millisecond) {
+		log.Debug("invalid clockSync reply from probeId=%d", c.Probe.Id)
+		return
+	}
+	skew := sync.ClockSkew(now)
+	c.sessionLock.Lock()
+	c.Session.ClockSkew = skew
+	err := sqlstore.UpdateProbeSessionClockSkew(c.Session)
+	c.sessionLock.Unlock()
+	if err != nil {
+		log.Error(3, "failed to save clock skew for probeId=%d. %s", c.Probe.Id, err)
+	}
+	if limit := setting.Probes.MaxClockSkew; limit > 0 && math.Abs(skew) > float64(limit/time.Millisecond) {
+		log.Warn("clock of probeId=%d is off by %.0fms. results will be %sed.", c.Probe.Id, skew, setting.Probes.ClockSkewAction)
+	}
+
+	metric := &schema.MetricData{
+		OrgId:    int(c.Probe.OrgId),
+		Name:     fmt.Sprintf("worldping.probes.%s.clock_skew", c.Probe.Slug),
+		Metric:   "worldping.probes.clock_skew",
+		Interval: int(setting.Probes.ClockSyncInterval / time.Second),
+		Value:    skew,
+		Unit:     "ms",
+		Time:     now.Unix(),
+		Mtype:    "gauge",
+		Tags:     []string{fmt.Sprintf("probe:%s", c.Probe.Slug)},
+	}
+	metric.SetId()
+	publisher.Add([]*schema.MetricData{metric})
+}
+
+func (c *CollectorContext) clockSkew() float64 {
+	c.sessionLock.RLock()
+	defer c.sessionLock.RUnlock()
+	return c.Session.ClockSkew
+}
+
+// applyClockSkew enforces setting.Probes.MaxClockSkew on results from a probe
+// whose clock is off by skew milliseconds.  Results are either corrected by
+// the skew, or rejected in which case false is returned.
+func applyClockSkew(skew float64, metrics []*schema.MetricData) bool {
+	limit := setting.Probes.MaxClockSkew
+	if limit == 0 || math.Abs(skew) <= float64(limit/time.Millisecond) {
+		return true
+	}
+	if setting.Probes.ClockSkewAction == "correct" {
+		offset := int64(math.Floor(skew/1000 + 0.5))
+		for _, metric := range metrics {
+			metric.Time -= offset
+		}
+		resultsSkewCorrected.Inc(int64(len(metrics)))
+		return true
+	}
+	resultsSkewRejected.Inc(int64(len(metrics)))
+	return false
+}
+
 func (c *CollectorContext) OnResults(results []*schemaV0.MetricData) {
-	metricsRecvd.Inc(int64(len(results)))
 	metrics := make([]*schema.MetricData, len(results))
 	for i, m := range results {
 		metrics[i] = &schema.MetricData{
-			Name:     strings.Replace(m.Name, "litmus.", "worldping.", 1),
-			Metric:   strings.Replace(m.Metric, "litmus.", "worldping.", 1),
+			Name:     m.Name,
+			Metric:   m.Metric,
 			Interval: m.Interval,
 			OrgId:    m.OrgId,
 			Value:    m.Value,
@@ -460,17 +617,45 @@ func (c *CollectorContext) OnResults(results []*schemaV0.MetricData) {
 			Mtype:    m.TargetType,
 			Tags:     m.Tags,
 		}
-		metrics[i].SetId()
+	}
+	if !applyClockSkew(c.clockSkew(), metrics) {
+		log.Debug("dropping %d results from probeId=%d due to clock skew", len(metrics), c.Probe.Id)
+		return
+	}
+	rewriteResults(c.Probe, metrics)
+	publishResults(metrics)
+}
 
-		if !c.Probe.Public {
-			metrics[i].OrgId = int(c.OrgId)
+// rewriteEvent sets the org of an event received from a probe.  Events from
+// private probes always belong to the org that owns the probe.
+func rewriteEvent(probe *m.ProbeDTO, event *schema.ProbeEvent) {
+	if !probe.Public {
+		event.OrgId = probe.OrgId
+	}
+}
+
+// rewriteResults renames the legacy litmus.* series received from a probe to
+// worldping.*, and sets their org.  Metrics from private probes always belong
+// to the org that owns the probe.
+func rewriteResults(probe *m.ProbeDTO, metrics []*schema.MetricData) {
+	for _, metric := range metrics {
+		metric.Name = strings.Replace(metric.Name, "litmus.", "worldping.", 1)
+		metric.Metric = strings.Replace(metric.Metric, "litmus.", "worldping.", 1)
+		if !probe.Public {
+			metric.OrgId = int(probe.OrgId)
 		}
+		metric.SetId()
 	}
+}
+
+func publishResults(metrics []*schema.MetricData) {
+	metricsRecvd.Inc(int64(len(metrics)))
 	publisher.Add(metrics)
+	alerting.BufferResults(metrics)
 }
 
 func (c *CollectorContext) Refresh() {
-	if c.closed {
+	if c.isClosed() {
 		log.Info("Refresh called on closed session.")
 		return
 	}
@@ -487,7 +672,7 @@ func (c *CollectorContext) Refresh() {
 	totalSessions := int64(len(sessions))
 	log.Debug("probeId=%d has %d sessions", c.Probe.Id, totalSessions)
 	//step 2. for each session
-	for pos, sess := range sessions {
+	for _, sess := range sessions {
 		//we only need to refresh the 1 socket.
 		if sess.SocketId != c.Session.SocketId {
 			continue
@@ -507,7 +692,7 @@ func (c *CollectorContext) Refresh() {
 			if !check.Enabled {
 				continue
 			}
-			if check.Check.Id%totalSessions == int64(pos) {
+			if s := m.SessionForCheck(sessions, check.Check.Id, check.Type); s != nil && s.SocketId == sess.SocketId {
 				if v.LessThan(newVer) {
 					monitors = append(monitors, m.MonitorDTOFromCheck(check.Check, check.Slug))
 				} else {
@@ -573,7 +758,7 @@ func HandleEndpointUpdated(event *events.EndpointUpdated) error {
 		for _, probe := range probeIds {
 			seenProbes[probe] = struct{}{}
 			log.Debug("notifying probeId=%d about updated %s check for %s", probe, check.Type, event.Payload.Current.Slug)
-			if err := EmitCheckEvent(probe, check.Id, "updated", m.CheckWithSlug{Check: check, Slug: event.Payload.Current.Slug}); err != nil {
+			if err := EmitCheckEvent(probe, "updated", m.CheckWithSlug{Check: check, Slug: event.Payload.Current.Slug}); err != nil {
 				return err
 			}
 		}
@@ -585,7 +770,7 @@ func HandleEndpointUpdated(event *events.EndpointUpdated) error {
 		for _, probe := range oldProbes {
 			if _, ok := seenProbes[probe]; !ok {
 				log.Debug("%s check for %s should no longer be running on probeId=%d", check.Type, event.Payload.Current.Slug, probe)
-				if err := EmitCheckEvent(probe, check.Id, "removed", m.CheckWithSlug{Check: check, Slug: event.Payload.Last.Slug}); err != nil {
+				if err := EmitCheckEvent(probe, "removed", m.CheckWithSlug{Check: check, Slug: event.Payload.Last.Slug}); err != nil {
 					return err
 				}
 			}
@@ -599,7 +784,7 @@ func HandleEndpointUpdated(event *events.EndpointUpdated) error {
 		}
 		for _, probe := range probeIds {
 			log.Debug("notifying probeId=%d about new %s check for %s", probe, check.Type, event.Payload.Current.Slug)
-			if err := EmitCheckEvent(probe, check.Id, "created", m.CheckWithSlug{Check: check, Slug: event.Payload.Current.Slug}); err != nil {
+			if err := EmitCheckEvent(probe, "created", m.CheckWithSlug{Check: check, Slug: event.Payload.Current.Slug}); err != nil {
 				return err
 			}
 		}
@@ -613,7 +798,7 @@ func HandleEndpointUpdated(event *events.EndpointUpdated) error {
 			}
 			for _, probe := range oldProbes {
 				log.Debug("%s check for %s should no longer be running on probeId=%d", check.Type, event.Payload.Current.Slug, probe)
-				if err := EmitCheckEvent(probe, check.Id, "removed", m.CheckWithSlug{Check: check, Slug: event.Payload.Last.Slug}); err != nil {
+				if err := EmitCheckEvent(probe, "removed", m.CheckWithSlug{Check: check, Slug: event.Payload.Last.Slug}); err != nil {
 					return err
 				}
 			}
@@ -635,7 +820,7 @@ func HandleEndpointCreated(event *events.EndpointCreated) error {
 		}
 		for _, probe := range probeIds {
 			log.Debug("notifying probeId=%d about new %s check for %s", probe, check.Type, event.Payload.Slug)
-			if err := EmitCheckEvent(probe, check.Id, "created", m.CheckWithSlug{Check: check, Slug: event.Payload.Slug}); err != nil {
+			if err := EmitCheckEvent(probe, "created", m.CheckWithSlug{Check: check, Slug: event.Payload.Slug}); err != nil {
 				return err
 			}
 		}
@@ -656,7 +841,7 @@ func HandleEndpointDeleted(event *events.EndpointDeleted) error {
 		}
 		for _, probe := range probeIds {
 			log.Debug("notifying probeId=%d about deleted %s check for %s", probe, check.Type, event.Payload.Slug)
-			if err := EmitCheckEvent(probe, check.Id, "removed", m.CheckWithSlug{Check: check, Slug: event.Payload.Slug}); err != nil {
+			if err := EmitCheckEvent(probe, "removed", m.CheckWithSlug{Check: check, Slug: event.Payload.Slug}); err != nil {
 				return err
 			}
 		}
@@ -664,7 +849,9 @@ func HandleEndpointDeleted(event *events.EndpointDeleted) error {
 	return nil
 }
 
-func EmitCheckEvent(probeId int64, checkId int64, eventName string, event interface{}) error {
+// EmitCheckEvent sends the check event to the session of the probe that
+// executes the check, if it is connected to this instance.
+func EmitCheckEvent(probeId int64, eventName string, check m.CheckWithSlug) error {
 	sessions, err := sqlstore.GetProbeSessions(probeId, "")
 	if err != nil {
 		log.Error(3, "failed to get list of probeSessions.", err)
@@ -675,21 +862,21 @@ func EmitCheckEvent(probeId int64, checkId int64, eventName string, event interf
 		return nil
 	}
 
-	log.Info(fmt.Sprintf("emitting %s event for CheckId %d to probeId:%d totalSessions: %d", eventName, checkId, probeId, totalSessions))
-	pos := checkId % totalSessions
-	if sessions[pos].InstanceId == setting.InstanceId {
-		v, _ := version.NewVersion(sessions[pos].Version)
+	log.Info(fmt.Sprintf("emitting %s event for CheckId %d to probeId:%d totalSessions: %d", eventName, check.Id, probeId, totalSessions))
+	session := m.SessionForCheck(sessions, check.Id, check.Type)
+	if session == nil {
+		log.Debug("probeId:%d does not support %s checks.", probeId, check.Type)
+		return nil
+	}
+	if session.InstanceId == setting.InstanceId {
+		v, _ := version.NewVersion(session.Version)
 		newVer, _ := version.NewVersion("0.9.1")
 		if v.LessThan(newVer) {
-			if check, ok := event.(m.CheckWithSlug); ok {
-				monitor := m.MonitorDTOFromCheckWithSlug(check)
-				socketId := sessions[pos].SocketId
-				contextCache.Emit(socketId, eventName, monitor)
-				return nil
-			}
+			monitor := m.MonitorDTOFromCheckWithSlug(check)
+			contextCache.Emit(session.SocketId, eventName, monitor)
+			return nil
 		}
-		socketId := sessions[pos].SocketId
-		contextCache.Emit(socketId, eventName, event)
+		contextCache.Emit(session.SocketId, eventName, check)
 	}
 	return nil
 }
@@ -700,6 +887,18 @@ func HandleProbeSessionCreated(event *events.ProbeSessionCreated) error {
 	return nil
 }
 
+// HandleProbeSessionUpdated re-routes the checks of a probe whose session,
+// connected to another instance, changed the check types it supports.
+func HandleProbeSessionUpdated(event *events.ProbeSessionUpdated) error {
+	if event.Payload.InstanceId == setting.InstanceId {
+		// already refreshed when the health report was received.
+		return nil
+	}
+	log.Info("ProbeSessionUpdated on %s: ProbeId=%d", event.Payload.InstanceId, event.Payload.ProbeId)
+	contextCache.Refresh(event.Payload.ProbeId)
+	return nil
+}
+
 func HandleProbeSessionDeleted(event *events.ProbeSessionDeleted) error {
 	log.Info("ProbeSessionDeleted from %s: ProbeId=%d", event.Payload.InstanceId, event.Payload.ProbeId)
 	contextCache.Refresh(event.Payload.ProbeId)
@@ -777,6 +976,17 @@ func eventConsumer(channel chan events.RawEvent) {
 					log.Error(3, "failed to emit ProbeSessionCreated event.", err)
 				}
 				break
+			case "ProbeSession.updated":
+				event := events.ProbeSessionUpdated{}
+				if err := json.Unmarshal(e.Body, &event.Payload); err != nil {
+					log.Error(3, "unable to unmarshal payload into ProbeSessionUpdated event.", err)
+					break
+				}
+				ProbeSessionUpdatedEventsSeen.Inc(1)
+				if err := HandleProbeSessionUpdated(&event); err != nil {
+					log.Error(3, "failed to emit ProbeSessionUpdated event.", err)
+				}
+				break
 			case "ProbeSesssion.deleted":
 				event := events.ProbeSessionDeleted{}
 				if err := json.Unmarshal(e.Body, &event.Payload); err != nil {
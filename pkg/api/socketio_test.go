@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/googollee/go-socket.io"
 	"github.com/graarh/golang-socketio"
 	"github.com/graarh/golang-socketio/transport"
 	"github.com/raintank/met/helper"
@@ -32,6 +33,40 @@ func (m *mockPublisher) AddEvent(event *schema.ProbeEvent) {
 	return
 }
 
+// emitSocket is a socket.io socket that records the messages emitted to it.
+type emitSocket struct {
+	socketio.Socket
+	emitted  chan string
+	payloads chan interface{}
+}
+
+func newEmitSocket() *emitSocket {
+	return &emitSocket{emitted: make(chan string, 100), payloads: make(chan interface{}, 100)}
+}
+
+func (s *emitSocket) Emit(message string, args ...interface{}) error {
+	s.emitted <- message
+	s.payloads <- args
+	return nil
+}
+
+// waitFor returns the payload of the next message emitted with the given
+// name, or nil if none is emitted within 5 seconds.
+func (s *emitSocket) waitFor(message string) interface{} {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case emitted := <-s.emitted:
+			args := (<-s.payloads).([]interface{})
+			if emitted == message && len(args) > 0 {
+				return args[0]
+			}
+		case <-timeout:
+			return nil
+		}
+	}
+}
+
 func TestProbeController(t *testing.T) {
 	setting.AdminKey = "test"
 	InitTestDB(t)
@@ -196,7 +231,7 @@ func TestProbeController(t *testing.T) {
 			So(probe.Name, ShouldEqual, "test2")
 			So(probe.Online, ShouldEqual, true)
 			readyEvent := <-readyChan
-			So(len(readyEvent.MonitorTypes), ShouldEqual, 4)
+			So(len(readyEvent.MonitorTypes), ShouldEqual, 6)
 			So(readyEvent.Collector.Id, ShouldEqual, 1)
 			So(readyEvent.Collector.Name, ShouldEqual, "test2")
 			checkList := <-refresh
@@ -299,3 +334,148 @@ func TestProbeController(t *testing.T) {
 		})
 	})
 }
+
+func TestProbeClockSkew(t *testing.T) {
+	backend, _ := helper.New(false, "", "standard", "", "")
+	resultsSkewRejected = backend.NewCount("collector-ctrl.results-skew-rejected")
+	resultsSkewCorrected = backend.NewCount("collector-ctrl.results-skew-corrected")
+
+	Convey("When measuring clock skew", t, func() {
+		now := time.Now()
+		nowMs := now.UnixNano() / int64(time.Millisecond)
+		Convey("skew should account for the round trip time", func() {
+			sync := &m.ProbeClockSync{Ts: nowMs - 200, ProbeTs: nowMs + 5000}
+			So(sync.ClockSkew(now), ShouldEqual, 5100)
+		})
+		Convey("skew should be negative when the probe is behind", func() {
+			sync := &m.ProbeClockSync{Ts: nowMs, ProbeTs: nowMs - 3000}
+			So(sync.ClockSkew(now), ShouldEqual, -3000)
+		})
+	})
+
+	Convey("When applying the max clock skew", t, func() {
+		setting.Probes = setting.ProbeSettings{
+			MaxClockSkew:    2 * time.Second,
+			ClockSkewAction: "reject",
+		}
+		metrics := []*schema.MetricData{{Time: 1000}, {Time: 1010}}
+		Convey("results within the limit should be accepted unchanged", func() {
+			So(applyClockSkew(-1500, metrics), ShouldBeTrue)
+			So(metrics[0].Time, ShouldEqual, 1000)
+		})
+		Convey("results beyond the limit should be rejected", func() {
+			So(applyClockSkew(2500, metrics), ShouldBeFalse)
+		})
+		Convey("results beyond the limit should be corrected", func() {
+			setting.Probes.ClockSkewAction = "correct"
+			So(applyClockSkew(4600, metrics), ShouldBeTrue)
+			So(metrics[0].Time, ShouldEqual, 995)
+			So(metrics[1].Time, ShouldEqual, 1005)
+		})
+		Convey("results should be accepted when the limit is disabled", func() {
+			setting.Probes.MaxClockSkew = 0
+			So(applyClockSkew(60000, metrics), ShouldBeTrue)
+			So(metrics[0].Time, ShouldEqual, 1000)
+		})
+	})
+
+	Convey("When the probe disconnects", t, func() {
+		setting.Probes.ClockSyncInterval = 10 * time.Millisecond
+		socket := newEmitSocket()
+		c := &CollectorContext{
+			Probe:   &m.ProbeDTO{Id: 1},
+			Socket:  socket,
+			Session: &m.ProbeSession{},
+			done:    make(chan struct{}),
+		}
+		stopped := make(chan struct{})
+		go func() {
+			c.syncClock()
+			close(stopped)
+		}()
+		So(<-socket.emitted, ShouldEqual, "clockSync")
+		close(c.done)
+		returned := false
+		select {
+		case <-stopped:
+			returned = true
+		case <-time.After(time.Second):
+		}
+		So(returned, ShouldBeTrue)
+		So(c.isClosed(), ShouldBeTrue)
+	})
+	setting.Probes = setting.ProbeSettings{}
+}
+
+func TestProbeSessionUpdated(t *testing.T) {
+	InitTestDB(t)
+	populateCollectors(t)
+	populateEndpoints(t)
+	backend, _ := helper.New(false, "", "standard", "", "")
+	ProbesConnected = backend.NewGauge("collector-ctrl.probes-connected", 0)
+	RefreshDuration = backend.NewTimer("collector-ctrl.refresh-duration", 0)
+	contextCache = NewContextCache()
+	setting.InstanceId = "default"
+
+	Convey("When a session on another instance stops supporting a check type", t, func() {
+		probe, err := sqlstore.GetProbeById(1, 1)
+		So(err, ShouldBeNil)
+		local := &m.ProbeSession{
+			OrgId:      1,
+			ProbeId:    1,
+			SocketId:   "local",
+			Version:    "1.0.0",
+			InstanceId: "default",
+			RemoteIp:   "127.0.0.1",
+		}
+		remote := &m.ProbeSession{
+			OrgId:      1,
+			ProbeId:    1,
+			SocketId:   "remote",
+			Version:    "1.0.0",
+			InstanceId: "other",
+			RemoteIp:   "127.0.0.2",
+		}
+		So(sqlstore.AddProbeSession(local), ShouldBeNil)
+		So(sqlstore.AddProbeSession(remote), ShouldBeNil)
+		socket := newEmitSocket()
+		c := &CollectorContext{
+			Probe:   probe,
+			Socket:  socket,
+			Session: local,
+			done:    make(chan struct{}),
+		}
+		contextCache.Set(local.SocketId, c)
+		nonPing := func(checks []m.CheckWithSlug) int {
+			count := 0
+			for _, check := range checks {
+				if check.Enabled && check.Type != m.PING_CHECK {
+					count++
+				}
+			}
+			return count
+		}
+		all, err := sqlstore.GetProbeChecksWithEndpointSlug(probe)
+		So(err, ShouldBeNil)
+		c.Refresh()
+		before, ok := socket.waitFor("refresh").([]m.CheckWithSlug)
+		So(ok, ShouldBeTrue)
+		So(nonPing(before), ShouldBeLessThan, nonPing(all))
+
+		// the other instance saves the health report and publishes the change.
+		remote.Health = &m.ProbeHealth{CheckTypes: []m.CheckType{m.PING_CHECK}, Updated: time.Now()}
+		So(sqlstore.UpdateProbeSessionHealth(remote), ShouldBeNil)
+		So(HandleProbeSessionUpdated(&events.ProbeSessionUpdated{Ts: time.Now(), Payload: remote}), ShouldBeNil)
+
+		Convey("the checks it no longer supports should move to our session", func() {
+			after, ok := socket.waitFor("refresh").([]m.CheckWithSlug)
+			So(ok, ShouldBeTrue)
+			So(nonPing(after), ShouldEqual, nonPing(all))
+		})
+		Reset(func() {
+			contextCache.Remove(local.SocketId)
+			sqlstore.DeleteProbeSession(local)
+			sqlstore.DeleteProbeSession(remote)
+		})
+	})
+}
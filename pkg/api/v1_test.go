@@ -177,9 +177,9 @@ func TestMonitorTypesV1Api(t *testing.T) {
 				monitorTypes := make([]m.MonitorTypeDTO, 0)
 				err := json.Unmarshal(resp.Body.Bytes(), &monitorTypes)
 				So(err, ShouldBeNil)
-				So(len(monitorTypes), ShouldEqual, 4)
+				So(len(monitorTypes), ShouldEqual, 6)
 				for _, mType := range monitorTypes {
-					So(mType.Name, ShouldBeIn, "HTTP", "HTTPS", "Ping", "DNS")
+					So(mType.Name, ShouldBeIn, "HTTP", "HTTPS", "Ping", "DNS", "TCP", "Cert")
 					switch mType.Name {
 					case "HTTP":
 						So(len(mType.Settings), ShouldEqual, 7)
@@ -189,6 +189,10 @@ func TestMonitorTypesV1Api(t *testing.T) {
 						So(len(mType.Settings), ShouldEqual, 2)
 					case "DNS":
 						So(len(mType.Settings), ShouldEqual, 6)
+					case "TCP":
+						So(len(mType.Settings), ShouldEqual, 6)
+					case "Cert":
+						So(len(mType.Settings), ShouldEqual, 6)
 					}
 				}
 			})
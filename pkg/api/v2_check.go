@@ -0,0 +1,93 @@
+package api
+
+import (
+	"time"
+
+	"github.com/raintank/worldping-api/pkg/alerting"
+	"github.com/raintank/worldping-api/pkg/api/rbody"
+	"github.com/raintank/worldping-api/pkg/log"
+	"github.com/raintank/worldping-api/pkg/middleware"
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+)
+
+func AckCheck(c *middleware.Context, cmd m.AckCheckCmd) *rbody.ApiResponse {
+	id := c.ParamsInt64(":id")
+	ack := &m.CheckAck{
+		User:    cmd.User,
+		Time:    time.Now(),
+		Comment: cmd.Comment,
+	}
+	if ack.User == "" {
+		ack.User = c.Name
+	}
+
+	if err := sqlstore.AckCheck(c.OrgId, id, ack); err != nil {
+		return rbody.ErrResp(err)
+	}
+	log.Info("check acknowledged: orgId=%d, monitorId=%d, user=%s", c.OrgId, id, ack.User)
+
+	return rbody.OkResp("ack", ack)
+}
+
+func UnackCheck(c *middleware.Context) *rbody.ApiResponse {
+	id := c.ParamsInt64(":id")
+
+	if err := sqlstore.UnackCheck(c.OrgId, id); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("ack", nil)
+}
+
+// PreviewAlert replays the alerting rules of a check over its stored
+// results, without changing anything.
+func PreviewAlert(c *middleware.Context, cmd m.PreviewAlertCmd) *rbody.ApiResponse {
+	if err := cmd.Validate(); err != nil {
+		return rbody.ErrResp(err)
+	}
+	check := cmd.Check
+	if cmd.CheckId != 0 {
+		var err error
+		check, err = sqlstore.GetCheckById(c.OrgId, cmd.CheckId)
+		if err != nil {
+			return rbody.ErrResp(err)
+		}
+	}
+	endpoint, err := sqlstore.GetEndpointById(c.OrgId, check.EndpointId)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+	healthSettings := check.HealthSettings
+	if cmd.HealthSettings != nil {
+		healthSettings = cmd.HealthSettings
+	}
+	if healthSettings == nil {
+		return rbody.ErrResp(m.NewValidationError("healthSettings not set."))
+	}
+	if err := healthSettings.Validate(); err != nil {
+		return rbody.ErrResp(err)
+	}
+	if t := healthSettings.MetricThreshold; t != nil {
+		if err := t.Validate(check.Type); err != nil {
+			return rbody.ErrResp(err)
+		}
+	}
+
+	preview, err := alerting.Preview(&m.CheckForAlertDTO{
+		Id:             check.Id,
+		OrgId:          c.OrgId,
+		EndpointId:     endpoint.Id,
+		Slug:           endpoint.Slug,
+		Name:           endpoint.Name,
+		Type:           string(check.Type),
+		Frequency:      check.Frequency,
+		Settings:       check.Settings,
+		HealthSettings: healthSettings,
+	}, time.Unix(cmd.From, 0), time.Unix(cmd.To, 0))
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("alertPreview", preview)
+}
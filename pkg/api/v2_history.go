@@ -0,0 +1,47 @@
+package api
+
+import (
+	"github.com/raintank/worldping-api/pkg/api/rbody"
+	"github.com/raintank/worldping-api/pkg/middleware"
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+)
+
+func GetCheckHistory(c *middleware.Context, query m.GetCheckStateHistoryQuery) *rbody.ApiResponse {
+	query.OrgId = c.OrgId
+	query.CheckId = c.ParamsInt64(":id")
+	if err := query.Validate(); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	// make sure the check exists and belongs to the org.
+	if _, err := sqlstore.GetCheckById(c.OrgId, query.CheckId); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	history, err := sqlstore.GetCheckStateHistory(&query)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("checkStateHistory", history)
+}
+
+func GetEndpointHistory(c *middleware.Context, query m.GetCheckStateHistoryQuery) *rbody.ApiResponse {
+	query.OrgId = c.OrgId
+	query.EndpointId = c.ParamsInt64(":id")
+	if err := query.Validate(); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	if _, err := sqlstore.GetEndpointById(c.OrgId, query.EndpointId); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	history, err := sqlstore.GetCheckStateHistory(&query)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("checkStateHistory", history)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"github.com/raintank/worldping-api/pkg/api/rbody"
+	"github.com/raintank/worldping-api/pkg/middleware"
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+)
+
+func GetMaintenanceWindows(c *middleware.Context, query m.GetMaintenanceWindowsQuery) *rbody.ApiResponse {
+	query.OrgId = c.OrgId
+
+	windows, err := sqlstore.GetMaintenanceWindows(&query)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("maintenanceWindows", windows)
+}
+
+func GetMaintenanceWindowById(c *middleware.Context) *rbody.ApiResponse {
+	id := c.ParamsInt64(":id")
+
+	window, err := sqlstore.GetMaintenanceWindowById(c.OrgId, id)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("maintenanceWindow", window)
+}
+
+func DeleteMaintenanceWindow(c *middleware.Context) *rbody.ApiResponse {
+	id := c.ParamsInt64(":id")
+
+	err := sqlstore.DeleteMaintenanceWindow(c.OrgId, id)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("maintenanceWindow", nil)
+}
+
+func AddMaintenanceWindow(c *middleware.Context, window m.MaintenanceWindow) *rbody.ApiResponse {
+	window.OrgId = c.OrgId
+	if window.Id != 0 {
+		return rbody.ErrResp(m.NewValidationError("Id already set. Try update instead of create."))
+	}
+	if err := window.Validate(); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	if err := sqlstore.AddMaintenanceWindow(&window); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("maintenanceWindow", window)
+}
+
+func UpdateMaintenanceWindow(c *middleware.Context, window m.MaintenanceWindow) *rbody.ApiResponse {
+	window.OrgId = c.OrgId
+	if window.Id == 0 {
+		return rbody.ErrResp(m.NewValidationError("Maintenance window id not set."))
+	}
+	if err := window.Validate(); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	if err := sqlstore.UpdateMaintenanceWindow(&window); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("maintenanceWindow", window)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"github.com/raintank/worldping-api/pkg/api/rbody"
+	"github.com/raintank/worldping-api/pkg/middleware"
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+)
+
+func GetNotifiers(c *middleware.Context, query m.GetNotifiersQuery) *rbody.ApiResponse {
+	query.OrgId = c.OrgId
+
+	notifiers, err := sqlstore.GetNotifiers(&query)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("notifiers", notifiers)
+}
+
+func GetNotifierById(c *middleware.Context) *rbody.ApiResponse {
+	id := c.ParamsInt64(":id")
+
+	notifier, err := sqlstore.GetNotifierById(c.OrgId, id)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("notifier", notifier)
+}
+
+func DeleteNotifier(c *middleware.Context) *rbody.ApiResponse {
+	id := c.ParamsInt64(":id")
+
+	err := sqlstore.DeleteNotifier(c.OrgId, id)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("notifier", nil)
+}
+
+func AddNotifier(c *middleware.Context, notifier m.Notifier) *rbody.ApiResponse {
+	notifier.OrgId = c.OrgId
+	if notifier.Id != 0 {
+		return rbody.ErrResp(m.NewValidationError("Id already set. Try update instead of create."))
+	}
+	if err := notifier.Validate(); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	if err := sqlstore.AddNotifier(&notifier); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("notifier", notifier)
+}
+
+func UpdateNotifier(c *middleware.Context, notifier m.Notifier) *rbody.ApiResponse {
+	notifier.OrgId = c.OrgId
+	if notifier.Id == 0 {
+		return rbody.ErrResp(m.NewValidationError("Notifier id not set."))
+	}
+	if err := notifier.Validate(); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	if err := sqlstore.UpdateNotifier(&notifier); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("notifier", notifier)
+}
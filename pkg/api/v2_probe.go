@@ -1,10 +1,19 @@
 package api
 
 import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/raintank/worldping-api/pkg/api/rbody"
 	"github.com/raintank/worldping-api/pkg/middleware"
 	m "github.com/raintank/worldping-api/pkg/models"
 	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+	"github.com/raintank/worldping-api/pkg/setting"
 )
 
 func GetProbes(c *middleware.Context, query m.GetProbesQuery) *rbody.ApiResponse {
@@ -25,6 +34,18 @@ func GetProbeById(c *middleware.Context) *rbody.ApiResponse {
 	if err != nil {
 		return rbody.ErrResp(err)
 	}
+	sessions, err := sqlstore.GetProbeSessions(probe.Id, "")
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+	for _, sess := range sessions {
+		if sess.Health != nil {
+			probe.Health = append(probe.Health, sess.Health)
+		}
+		if math.Abs(sess.ClockSkew) > math.Abs(probe.ClockSkew) {
+			probe.ClockSkew = sess.ClockSkew
+		}
+	}
 
 	return rbody.OkResp("probe", probe)
 }
@@ -73,3 +94,199 @@ func UpdateProbe(c *middleware.Context, probe m.ProbeDTO) *rbody.ApiResponse {
 
 	return rbody.OkResp("probe", probe)
 }
+
+// probeClockSkew returns the offset of the clock of a probe pushing results,
+// in milliseconds, and whether it is known.  It is measured from the time on
+// the probe's clock sent as the ts parameter, in milliseconds, falling back
+// to the largest skew measured on the probe's socket.io sessions.
+func probeClockSkew(c *middleware.Context, probe *m.ProbeDTO) (float64, bool, error) {
+	if ts := c.QueryInt64("ts"); ts > 0 {
+		return float64(ts - time.Now().UnixNano()/int64(time.Millisecond)), true, nil
+	}
+	sessions, err := sqlstore.GetProbeSessions(probe.Id, "")
+	if err != nil {
+		return 0, false, err
+	}
+	skew := 0.0
+	for _, sess := range sessions {
+		if math.Abs(sess.ClockSkew) > math.Abs(skew) {
+			skew = sess.ClockSkew
+		}
+	}
+	return skew, len(sessions) > 0, nil
+}
+
+// PushProbeResults accepts a batch of metrics and events from a probe, as an
+// alternative to sending them over socket.io.  Probes can only push results
+// for their own org.  When max_clock_skew is set, results are rejected or
+// corrected in the same way as those sent over socket.io.
+func PushProbeResults(c *middleware.Context, cmd m.ProbeResultsCmd) *rbody.ApiResponse {
+	id := c.ParamsInt64(":id")
+
+	probe, err := sqlstore.GetProbeById(id, c.OrgId)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+	if probe.OrgId != c.OrgId || (c.Probe != nil && c.Probe.Id != probe.Id) {
+		return rbody.ErrResp(m.ErrProbeNotFound)
+	}
+
+	rewriteResults(probe, cmd.Metrics)
+	for i, metric := range cmd.Metrics {
+		if err := metric.Validate(); err != nil {
+			return rbody.ErrResp(m.NewValidationError(fmt.Sprintf("metric %d is invalid. %s", i, err)))
+		}
+	}
+	for i, event := range cmd.Events {
+		rewriteEvent(probe, event)
+		if err := event.Validate(); err != nil {
+			return rbody.ErrResp(m.NewValidationError(fmt.Sprintf("event %d is invalid. %s", i, err)))
+		}
+	}
+
+	if setting.Probes.MaxClockSkew > 0 && len(cmd.Metrics) > 0 {
+		skew, known, err := probeClockSkew(c, probe)
+		if err != nil {
+			return rbody.ErrResp(err)
+		}
+		if !known {
+			return rbody.ErrResp(m.NewValidationError("clock skew of probe is unknown. ts parameter not provided."))
+		}
+		if !applyClockSkew(skew, cmd.Metrics) {
+			return rbody.ErrResp(m.NewValidationError(fmt.Sprintf("clock of probe is off by %.0fms. results rejected.", skew)))
+		}
+	}
+
+	if len(cmd.Metrics) > 0 {
+		publishResults(cmd.Metrics)
+	}
+	for _, event := range cmd.Events {
+		publisher.AddEvent(event)
+	}
+
+	return rbody.OkResp("results", nil)
+}
+
+// selfProbe returns the probe making the request.  Probes using an org API
+// key identify themselves by name, in the same way as when connecting over
+// socket.io.
+func selfProbe(c *middleware.Context) (*m.ProbeDTO, error) {
+	if c.Probe != nil {
+		return c.Probe, nil
+	}
+	name := c.Query("name")
+	if name == "" {
+		return nil, m.NewValidationError("probe name not provided.")
+	}
+	return sqlstore.GetProbeByName(name, c.OrgId)
+}
+
+type checksById []m.CheckWithSlug
+
+func (c checksById) Len() int           { return len(c) }
+func (c checksById) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c checksById) Less(i, j int) bool { return c[i].Id < c[j].Id }
+
+// GetSelfChecks returns the checks that the probe making the request should
+// execute, for probes that poll for their checks instead of keeping a
+// socket.io connection open.  Checks of types that its sessions do not
+// support are left out.  The response has an ETag, so that probes can poll
+// with If-None-Match and get a 304 when their checks have not changed.
+func GetSelfChecks(c *middleware.Context) {
+	probe, err := selfProbe(c)
+	if err != nil {
+		c.JSON(200, rbody.ErrResp(err))
+		return
+	}
+	checks, err := sqlstore.GetProbeChecksWithEndpointSlug(probe)
+	if err != nil {
+		c.JSON(200, rbody.ErrResp(err))
+		return
+	}
+	// leave out the check types that the probe has not reported supporting
+	// in the health reports of its sessions.
+	sessions, err := sqlstore.GetProbeSessions(probe.Id, "")
+	if err != nil {
+		c.JSON(200, rbody.ErrResp(err))
+		return
+	}
+	if len(sessions) > 0 {
+		supported := make([]m.CheckWithSlug, 0, len(checks))
+		for _, check := range checks {
+			if m.SessionForCheck(sessions, check.Id, check.Type) != nil {
+				supported = append(supported, check)
+			}
+		}
+		checks = supported
+	}
+	sort.Sort(checksById(checks))
+	body, err := json.Marshal(checks)
+	if err != nil {
+		c.JSON(200, rbody.ErrResp(err))
+		return
+	}
+	etag := fmt.Sprintf("\"%x\"", sha1.Sum(body))
+	c.Resp.Header().Set("ETag", etag)
+	if etagMatches(c.Req.Header.Get("If-None-Match"), etag) {
+		c.Resp.WriteHeader(304)
+		return
+	}
+	c.JSON(200, rbody.OkResp("checks", checks))
+}
+
+// etagMatches returns true if the If-None-Match header matches etag.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func GetProbeTokens(c *middleware.Context) *rbody.ApiResponse {
+	id := c.ParamsInt64(":id")
+
+	probe, err := sqlstore.GetProbeById(id, c.OrgId)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+	if probe.OrgId != c.OrgId {
+		return rbody.ErrResp(m.ErrProbeNotFound)
+	}
+	tokens, err := sqlstore.GetProbeTokens(id, c.OrgId)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+	dtos := make([]m.ProbeTokenDTO, len(tokens))
+	for i := range tokens {
+		dtos[i] = tokens[i].ToDTO()
+	}
+
+	return rbody.OkResp("probeTokens", dtos)
+}
+
+// AddProbeToken issues a new token for a probe.  The token is only returned
+// in the response to this request.
+func AddProbeToken(c *middleware.Context) *rbody.ApiResponse {
+	id := c.ParamsInt64(":id")
+
+	token, err := sqlstore.AddProbeToken(id, c.OrgId)
+	if err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("probeToken", token)
+}
+
+func DeleteProbeToken(c *middleware.Context) *rbody.ApiResponse {
+	id := c.ParamsInt64(":id")
+	tokenId := c.ParamsInt64(":tokenId")
+
+	if err := sqlstore.DeleteProbeToken(tokenId, id, c.OrgId); err != nil {
+		return rbody.ErrResp(err)
+	}
+
+	return rbody.OkResp("probeToken", nil)
+}
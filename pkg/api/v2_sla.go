@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/raintank/worldping-api/pkg/api/rbody"
+	"github.com/raintank/worldping-api/pkg/log"
+	"github.com/raintank/worldping-api/pkg/middleware"
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
+)
+
+func GetCheckSLA(c *middleware.Context, query m.GetSLAReportQuery) {
+	query.OrgId = c.OrgId
+	query.CheckId = c.ParamsInt64(":id")
+	renderSLAReport(c, &query)
+}
+
+func GetEndpointSLA(c *middleware.Context, query m.GetSLAReportQuery) {
+	query.OrgId = c.OrgId
+	query.EndpointId = c.ParamsInt64(":id")
+	renderSLAReport(c, &query)
+}
+
+// renderSLAReport writes the report as CSV when requested, otherwise as a
+// regular json api response.
+func renderSLAReport(c *middleware.Context, query *m.GetSLAReportQuery) {
+	if err := query.Validate(); err != nil {
+		c.JSON(200, rbody.ErrResp(err))
+		return
+	}
+	report, err := sqlstore.GetSLAReport(query)
+	if err != nil {
+		c.JSON(200, rbody.ErrResp(err))
+		return
+	}
+	if query.Format != "csv" {
+		c.JSON(200, rbody.OkResp("slaReport", report))
+		return
+	}
+
+	c.Resp.Header().Set("Content-Type", "text/csv")
+	c.Resp.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"sla-%d-%d.csv\"", query.From, query.To))
+	c.Resp.WriteHeader(200)
+	w := csv.NewWriter(c.Resp)
+	w.Write([]string{"check_id", "endpoint_id", "check_type", "from", "to", "uptime", "incidents", "mttr", "downtime", "unknown"})
+	for _, sla := range report {
+		uptime := ""
+		if sla.Uptime != nil {
+			uptime = strconv.FormatFloat(*sla.Uptime, 'f', 4, 64)
+		}
+		w.Write([]string{
+			strconv.FormatInt(sla.CheckId, 10),
+			strconv.FormatInt(sla.EndpointId, 10),
+			string(sla.CheckType),
+			sla.From.UTC().Format(time.RFC3339),
+			sla.To.UTC().Format(time.RFC3339),
+			uptime,
+			strconv.Itoa(sla.Incidents),
+			strconv.FormatFloat(sla.MTTR, 'f', 0, 64),
+			strconv.FormatInt(sla.Downtime, 10),
+			strconv.FormatInt(sla.Unknown, 10),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Error(3, "failed to write SLA report. %s", err)
+	}
+}
@@ -9,12 +9,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/raintank/met/helper"
 	"github.com/raintank/worldping-api/pkg/api/rbody"
 	m "github.com/raintank/worldping-api/pkg/models"
 	"github.com/raintank/worldping-api/pkg/services/sqlstore"
 	"github.com/raintank/worldping-api/pkg/setting"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/macaron.v1"
+	"gopkg.in/raintank/schema.v1"
 )
 
 func TestQuotasV2Api(t *testing.T) {
@@ -775,3 +777,427 @@ func TestEndpointV2Api(t *testing.T) {
 		})
 	})
 }
+
+type recordingPublisher struct {
+	metrics []*schema.MetricData
+	events  []*schema.ProbeEvent
+}
+
+func (p *recordingPublisher) Add(metrics []*schema.MetricData) {
+	p.metrics = append(p.metrics, metrics...)
+}
+
+func (p *recordingPublisher) AddEvent(event *schema.ProbeEvent) {
+	p.events = append(p.events, event)
+}
+
+func TestProbeResultsV2Api(t *testing.T) {
+	InitTestDB(t)
+	r := macaron.Classic()
+	setting.AdminKey = "test"
+	Register(r)
+	populateCollectors(t)
+	backend, _ := helper.New(false, "", "standard", "", "")
+	metricsRecvd = backend.NewCount("collector-ctrl.metrics-recv")
+	resultsSkewRejected = backend.NewCount("collector-ctrl.results-skew-rejected")
+	resultsSkewCorrected = backend.NewCount("collector-ctrl.results-skew-corrected")
+
+	pushResults := func(probeId int64, query string, cmd m.ProbeResultsCmd) *rbody.ApiResponse {
+		body, err := json.Marshal(cmd)
+		So(err, ShouldBeNil)
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", fmt.Sprintf("/api/v2/probes/%d/results%s", probeId, query), bytes.NewReader(body))
+		So(err, ShouldBeNil)
+		addAuthHeader(req)
+		addContentTypeHeader(req)
+		r.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, 200)
+		response := &rbody.ApiResponse{}
+		So(json.Unmarshal(resp.Body.Bytes(), response), ShouldBeNil)
+		return response
+	}
+
+	Convey("Given POST request for /api/v2/probes/1/results", t, func() {
+		pub := &recordingPublisher{}
+		publisher = pub
+		now := time.Now().Unix()
+		cmd := m.ProbeResultsCmd{
+			Metrics: []*schema.MetricData{
+				{
+					OrgId:    5,
+					Name:     "litmus.example_com.test1.ping.mean",
+					Metric:   "litmus.ping.mean",
+					Interval: 60,
+					Value:    12.5,
+					Unit:     "ms",
+					Time:     now,
+					Mtype:    "gauge",
+					Tags:     []string{"endpoint:example_com", "probe:test1"},
+				},
+			},
+			Events: []*schema.ProbeEvent{
+				{
+					OrgId:     5,
+					EventType: "monitor_state",
+					Severity:  "ERROR",
+					Source:    "monitor_collector",
+					Timestamp: now * 1000,
+					Message:   "100% packet loss",
+				},
+			},
+		}
+
+		Convey("should publish the results in the org of the probe", func() {
+			resp := pushResults(1, "", cmd)
+			So(resp.Meta.Code, ShouldEqual, 200)
+			So(resp.Meta.Type, ShouldEqual, "results")
+			So(len(pub.metrics), ShouldEqual, 1)
+			So(pub.metrics[0].OrgId, ShouldEqual, 1)
+			So(pub.metrics[0].Name, ShouldEqual, "worldping.example_com.test1.ping.mean")
+			So(pub.metrics[0].Metric, ShouldEqual, "worldping.ping.mean")
+			So(pub.metrics[0].Id, ShouldNotBeEmpty)
+			So(len(pub.events), ShouldEqual, 1)
+			So(pub.events[0].OrgId, ShouldEqual, 1)
+		})
+		Convey("should reject invalid metrics", func() {
+			cmd.Metrics[0].Interval = 0
+			resp := pushResults(1, "", cmd)
+			So(resp.Meta.Code, ShouldEqual, 400)
+			So(len(pub.metrics), ShouldEqual, 0)
+			So(len(pub.events), ShouldEqual, 0)
+		})
+		Convey("should not accept results for probes of another org", func() {
+			resp := pushResults(4, "", cmd)
+			So(resp.Meta.Code, ShouldEqual, 404)
+			So(len(pub.metrics), ShouldEqual, 0)
+		})
+
+		Convey("when the clock skew of probes is limited", func() {
+			setting.Probes.MaxClockSkew = 2 * time.Second
+			setting.Probes.ClockSkewAction = "reject"
+			probeTs := func(skew time.Duration) string {
+				return fmt.Sprintf("?ts=%d", time.Now().Add(skew).UnixNano()/int64(time.Millisecond))
+			}
+			Convey("results should be rejected when the skew is unknown", func() {
+				resp := pushResults(1, "", cmd)
+				So(resp.Meta.Code, ShouldEqual, 400)
+				So(len(pub.metrics), ShouldEqual, 0)
+			})
+			Convey("results within the limit should be accepted", func() {
+				resp := pushResults(1, probeTs(0), cmd)
+				So(resp.Meta.Code, ShouldEqual, 200)
+				So(len(pub.metrics), ShouldEqual, 1)
+				So(pub.metrics[0].Time, ShouldEqual, now)
+			})
+			Convey("results beyond the limit should be rejected", func() {
+				resp := pushResults(1, probeTs(10*time.Second), cmd)
+				So(resp.Meta.Code, ShouldEqual, 400)
+				So(len(pub.metrics), ShouldEqual, 0)
+				So(len(pub.events), ShouldEqual, 0)
+			})
+			Convey("results beyond the limit should be corrected", func() {
+				setting.Probes.ClockSkewAction = "correct"
+				resp := pushResults(1, probeTs(10*time.Second), cmd)
+				So(resp.Meta.Code, ShouldEqual, 200)
+				So(len(pub.metrics), ShouldEqual, 1)
+				So(pub.metrics[0].Time, ShouldEqual, now-10)
+			})
+			Convey("the skew measured over socket.io should be used without ts", func() {
+				session := &m.ProbeSession{
+					OrgId:      1,
+					ProbeId:    1,
+					SocketId:   "skewed",
+					Version:    "1.0.0",
+					InstanceId: "default",
+					RemoteIp:   "127.0.0.1",
+					ClockSkew:  5000,
+				}
+				So(sqlstore.AddProbeSession(session), ShouldBeNil)
+				resp := pushResults(1, "", cmd)
+				So(resp.Meta.Code, ShouldEqual, 400)
+				So(len(pub.metrics), ShouldEqual, 0)
+				So(sqlstore.DeleteProbeSession(session), ShouldBeNil)
+			})
+			Reset(func() {
+				setting.Probes = setting.ProbeSettings{}
+			})
+		})
+	})
+}
+
+func TestProbeSelfChecksV2Api(t *testing.T) {
+	InitTestDB(t)
+	r := macaron.Classic()
+	setting.AdminKey = "test"
+	Register(r)
+	populateCollectors(t)
+	populateEndpoints(t)
+
+	getChecks := func(name, etag string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/api/v2/probes/self/checks?name="+name, nil)
+		So(err, ShouldBeNil)
+		addAuthHeader(req)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	Convey("Given GET request for /api/v2/probes/self/checks", t, func() {
+		resp := getChecks("test1", "")
+		So(resp.Code, ShouldEqual, 200)
+		etag := resp.Header().Get("ETag")
+		So(etag, ShouldNotBeEmpty)
+
+		Convey("should return the checks of the probe", func() {
+			response := rbody.ApiResponse{}
+			So(json.Unmarshal(resp.Body.Bytes(), &response), ShouldBeNil)
+			So(response.Meta.Code, ShouldEqual, 200)
+			So(response.Meta.Type, ShouldEqual, "checks")
+			checks := make([]m.CheckWithSlug, 0)
+			So(json.Unmarshal(response.Body, &checks), ShouldBeNil)
+			So(len(checks), ShouldEqual, 9)
+			for i, check := range checks {
+				So(check.Slug, ShouldEndWith, "google_com")
+				if i > 0 {
+					So(check.Id, ShouldBeGreaterThan, checks[i-1].Id)
+				}
+			}
+		})
+		Convey("should return 304 when the checks have not changed", func() {
+			resp := getChecks("test1", etag)
+			So(resp.Code, ShouldEqual, 304)
+			So(resp.Body.Len(), ShouldEqual, 0)
+		})
+		Convey("should return a different ETag for another probe", func() {
+			resp := getChecks("test3", etag)
+			So(resp.Code, ShouldEqual, 200)
+			So(resp.Header().Get("ETag"), ShouldNotEqual, etag)
+		})
+		Convey("should return an error for unknown probes", func() {
+			resp := getChecks("unknown", "")
+			response := rbody.ApiResponse{}
+			So(json.Unmarshal(resp.Body.Bytes(), &response), ShouldBeNil)
+			So(response.Meta.Code, ShouldEqual, 404)
+		})
+	})
+
+	Convey("Given the probe only supports http checks", t, func() {
+		err := sqlstore.AddProbeSession(&m.ProbeSession{
+			OrgId:      1,
+			ProbeId:    1,
+			SocketId:   "sid1",
+			Version:    "1.0.0",
+			InstanceId: "default",
+			RemoteIp:   "127.0.0.1",
+			Health: &m.ProbeHealth{
+				CheckTypes: []m.CheckType{m.HTTP_CHECK},
+				Updated:    time.Now(),
+			},
+		})
+		So(err, ShouldBeNil)
+		resp := getChecks("test1", "")
+		response := rbody.ApiResponse{}
+		So(json.Unmarshal(resp.Body.Bytes(), &response), ShouldBeNil)
+		So(response.Meta.Code, ShouldEqual, 200)
+		checks := make([]m.CheckWithSlug, 0)
+		So(json.Unmarshal(response.Body, &checks), ShouldBeNil)
+		So(len(checks), ShouldBeGreaterThan, 0)
+		So(len(checks), ShouldBeLessThan, 9)
+		for _, check := range checks {
+			So(check.Type, ShouldEqual, m.HTTP_CHECK)
+		}
+	})
+}
+
+func TestProbeTokensV2Api(t *testing.T) {
+	InitTestDB(t)
+	r := macaron.Classic()
+	setting.AdminKey = "test"
+	Register(r)
+	populateCollectors(t)
+	populateEndpoints(t)
+	backend, _ := helper.New(false, "", "standard", "", "")
+	metricsRecvd = backend.NewCount("collector-ctrl.metrics-recv")
+	publisher = &recordingPublisher{}
+
+	request := func(method, url, key string, payload interface{}) *httptest.ResponseRecorder {
+		var body []byte
+		if payload != nil {
+			var err error
+			body, err = json.Marshal(payload)
+			So(err, ShouldBeNil)
+		}
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		So(err, ShouldBeNil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", key))
+		if payload != nil {
+			addContentTypeHeader(req)
+		}
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+	apiResponse := func(resp *httptest.ResponseRecorder) *rbody.ApiResponse {
+		So(resp.Code, ShouldEqual, 200)
+		response := &rbody.ApiResponse{}
+		So(json.Unmarshal(resp.Body.Bytes(), response), ShouldBeNil)
+		return response
+	}
+
+	Convey("Given POST request for /api/v2/probes/1/tokens", t, func() {
+		response := apiResponse(request("POST", "/api/v2/probes/1/tokens", setting.AdminKey, nil))
+		So(response.Meta.Code, ShouldEqual, 200)
+		So(response.Meta.Type, ShouldEqual, "probeToken")
+		token := m.ProbeTokenDTO{}
+		So(json.Unmarshal(response.Body, &token), ShouldBeNil)
+		So(token.ProbeId, ShouldEqual, 1)
+		So(token.Token, ShouldStartWith, m.ProbeTokenPrefix)
+
+		Convey("listing tokens should not return the token", func() {
+			response := apiResponse(request("GET", "/api/v2/probes/1/tokens", setting.AdminKey, nil))
+			So(response.Meta.Type, ShouldEqual, "probeTokens")
+			tokens := make([]m.ProbeTokenDTO, 0)
+			So(json.Unmarshal(response.Body, &tokens), ShouldBeNil)
+			So(len(tokens), ShouldBeGreaterThan, 0)
+			for _, t := range tokens {
+				So(t.Token, ShouldBeEmpty)
+			}
+		})
+		Convey("the token should fetch the checks of its probe", func() {
+			resp := request("GET", "/api/v2/probes/self/checks", token.Token, nil)
+			response := apiResponse(resp)
+			So(response.Meta.Code, ShouldEqual, 200)
+			checks := make([]m.CheckWithSlug, 0)
+			So(json.Unmarshal(response.Body, &checks), ShouldBeNil)
+			So(len(checks), ShouldEqual, 9)
+		})
+		Convey("the token should submit results for its probe", func() {
+			cmd := m.ProbeResultsCmd{Metrics: []*schema.MetricData{{
+				Name:     "worldping.www1_google_com.test1.ping.mean",
+				Metric:   "worldping.ping.mean",
+				Interval: 60,
+				Time:     time.Now().Unix(),
+				Mtype:    "gauge",
+			}}}
+			response := apiResponse(request("POST", "/api/v2/probes/1/results", token.Token, cmd))
+			So(response.Meta.Code, ShouldEqual, 200)
+
+			Convey("but not for other probes", func() {
+				response := apiResponse(request("POST", "/api/v2/probes/2/results", token.Token, cmd))
+				So(response.Meta.Code, ShouldEqual, 404)
+			})
+		})
+		Convey("the token should not be accepted by other endpoints", func() {
+			resp := request("GET", "/api/v2/endpoints", token.Token, nil)
+			So(resp.Code, ShouldEqual, 403)
+			resp = request("POST", "/api/v2/probes/1/tokens", token.Token, nil)
+			So(resp.Code, ShouldEqual, 403)
+		})
+		Convey("when revoked the token should no longer be accepted", func() {
+			response := apiResponse(request("DELETE", fmt.Sprintf("/api/v2/probes/1/tokens/%d", token.Id), setting.AdminKey, nil))
+			So(response.Meta.Code, ShouldEqual, 200)
+			resp := request("GET", "/api/v2/probes/self/checks", token.Token, nil)
+			So(resp.Code, ShouldEqual, 401)
+		})
+	})
+}
+
+func TestProbeHealthV2Api(t *testing.T) {
+	InitTestDB(t)
+	r := macaron.Classic()
+	setting.AdminKey = "test"
+	Register(r)
+	populateCollectors(t)
+	err := sqlstore.AddProbeSession(&m.ProbeSession{
+		OrgId:      1,
+		ProbeId:    1,
+		SocketId:   "sid1",
+		Version:    "1.0.0",
+		InstanceId: "default",
+		RemoteIp:   "127.0.0.1",
+		Health: &m.ProbeHealth{
+			QueueDepth: 4,
+			CheckTypes: []m.CheckType{m.HTTP_CHECK},
+			Updated:    time.Now(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Given GET request for /api/v2/probes/1", t, func() {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/api/v2/probes/1", nil)
+		So(err, ShouldBeNil)
+		addAuthHeader(req)
+		r.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, 200)
+
+		Convey("should include the health reports of the probe sessions", func() {
+			response := rbody.ApiResponse{}
+			So(json.Unmarshal(resp.Body.Bytes(), &response), ShouldBeNil)
+			So(response.Meta.Code, ShouldEqual, 200)
+			probe := m.ProbeDTO{}
+			So(json.Unmarshal(response.Body, &probe), ShouldBeNil)
+			So(len(probe.Health), ShouldEqual, 1)
+			So(probe.Health[0].QueueDepth, ShouldEqual, 4)
+			So(probe.Health[0].CheckTypes, ShouldResemble, []m.CheckType{m.HTTP_CHECK})
+		})
+	})
+}
+
+func TestAlertPreviewV2Api(t *testing.T) {
+	InitTestDB(t)
+	r := macaron.Classic()
+	setting.AdminKey = "test"
+	Register(r)
+	populateCollectors(t)
+	populateEndpoints(t)
+
+	preview := func(threshold *m.CheckMetricThreshold) rbody.ApiResponse {
+		payload, err := json.Marshal(&m.PreviewAlertCmd{
+			CheckId: 1,
+			HealthSettings: &m.CheckHealthSettings{
+				NumProbes:       1,
+				Steps:           3,
+				MetricThreshold: threshold,
+			},
+		})
+		So(err, ShouldBeNil)
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/api/v2/checks/preview", bytes.NewReader(payload))
+		So(err, ShouldBeNil)
+		req.Header.Set("Content-Type", "application/json")
+		addAuthHeader(req)
+		r.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, 200)
+		response := rbody.ApiResponse{}
+		So(json.Unmarshal(resp.Body.Bytes(), &response), ShouldBeNil)
+		return response
+	}
+
+	Convey("Given POST request to preview alerts with a metric threshold", t, func() {
+		Convey("unknown metrics should be rejected", func() {
+			response := preview(&m.CheckMetricThreshold{
+				Metric:     "total; drop",
+				Comparison: m.ComparisonGreater,
+				Value:      100,
+				NumProbes:  1,
+				Steps:      3,
+			})
+			So(response.Meta.Code, ShouldEqual, 400)
+		})
+		Convey("steps of 0 should be rejected", func() {
+			response := preview(&m.CheckMetricThreshold{
+				Metric:     "total",
+				Comparison: m.ComparisonGreater,
+				Value:      100,
+				NumProbes:  1,
+			})
+			So(response.Meta.Code, ShouldEqual, 400)
+		})
+	})
+}
@@ -234,6 +234,16 @@ func TestEventTypes(t *testing.T) {
 		So(r.Type, ShouldEqual, "ProbeSession.created")
 	})
 
+	Convey("When converting ProbeSessionUpdated event to RawEvent", t, func() {
+		r, err := NewRawEventFromEvent(&ProbeSessionUpdated{
+			Ts:      time.Now(),
+			Payload: &m.ProbeSession{SocketId: "test"},
+		})
+		So(err, ShouldBeNil)
+		So(r, ShouldNotBeNil)
+		So(r.Type, ShouldEqual, "ProbeSession.updated")
+	})
+
 	Convey("When converting ProbeSessionDeleted event to RawEvent", t, func() {
 		r, err := NewRawEventFromEvent(&ProbeSessionDeleted{
 			Ts:      time.Now(),
@@ -137,6 +137,29 @@ func (a *ProbeSessionCreated) Body() ([]byte, error) {
 	return json.Marshal(a.Payload)
 }
 
+// ProbeSessionUpdated is published when the check types supported by a
+// probe session change, as the checks of the probe then need re-routing.
+type ProbeSessionUpdated struct {
+	Ts      time.Time
+	Payload *m.ProbeSession
+}
+
+func (a *ProbeSessionUpdated) Id() string {
+	return fmt.Sprintf("%d", a.Payload.Id)
+}
+
+func (a *ProbeSessionUpdated) Type() string {
+	return "ProbeSession.updated"
+}
+
+func (a *ProbeSessionUpdated) Timestamp() time.Time {
+	return a.Ts
+}
+
+func (a *ProbeSessionUpdated) Body() ([]byte, error) {
+	return json.Marshal(a.Payload)
+}
+
 type ProbeSessionDeleted struct {
 	Ts      time.Time
 	Payload *m.ProbeSession
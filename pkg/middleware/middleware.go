@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/raintank/raintank-apps/pkg/auth"
+	m "github.com/raintank/worldping-api/pkg/models"
+	"github.com/raintank/worldping-api/pkg/services/sqlstore"
 	"gopkg.in/macaron.v1"
 )
 
@@ -13,6 +15,8 @@ type Context struct {
 	*macaron.Context
 	*auth.SignedInUser
 	ApiKey string
+	// Probe is set when the request was authenticated with a probe token.
+	Probe *m.ProbeDTO
 }
 
 func GetContextHandler() macaron.Handler {
@@ -59,8 +63,33 @@ func Auth(adminKey string) macaron.Handler {
 			ctx.JSON(401, "Unauthorized")
 			return
 		}
+		if m.IsProbeToken(key) {
+			ctx.JSON(403, "Probe tokens can only be used by probes.")
+			return
+		}
+		orgAuth(ctx, adminKey, key)
+	}
+}
 
-		user, err := auth.Auth(adminKey, key)
+// ProbeAuth authenticates the requests made by probes, which can use either a
+// probe token or an org API key.  Requests made with a probe token can only
+// act on behalf of the probe that the token was issued for.
+func ProbeAuth(adminKey string) macaron.Handler {
+	return func(ctx *Context) {
+		key, err := getApiKey(ctx)
+		if err != nil {
+			ctx.JSON(401, "Invalid Authentication header.")
+			return
+		}
+		if key == "" {
+			ctx.JSON(401, "Unauthorized")
+			return
+		}
+		if !m.IsProbeToken(key) {
+			orgAuth(ctx, adminKey, key)
+			return
+		}
+		user, probe, err := ProbeTokenAuth(key)
 		if err != nil {
 			if err == auth.ErrInvalidApiKey {
 				ctx.JSON(401, "Unauthorized")
@@ -69,19 +98,50 @@ func Auth(adminKey string) macaron.Handler {
 			ctx.JSON(500, err)
 			return
 		}
-		// allow admin users to impersonate other orgs.
-		if user.IsAdmin {
-			header := ctx.Req.Header.Get("X-Worldping-Org")
-			if header != "" {
-				orgId, err := strconv.ParseInt(header, 10, 64)
-				if err == nil && orgId != 0 {
-					user.OrgId = orgId
-				}
+		ctx.SignedInUser = user
+		ctx.Probe = probe
+	}
+}
+
+// ProbeTokenAuth returns the probe that a probe token was issued for, and a
+// user with the least privileges in the org of the probe.
+func ProbeTokenAuth(token string) (*auth.SignedInUser, *m.ProbeDTO, error) {
+	probe, err := sqlstore.GetProbeByToken(token)
+	if err == m.ErrProbeTokenNotFound || err == m.ErrProbeNotFound {
+		return nil, nil, auth.ErrInvalidApiKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	user := &auth.SignedInUser{
+		OrgId: probe.OrgId,
+		Role:  auth.ROLE_VIEWER,
+	}
+	return user, probe, nil
+}
+
+func orgAuth(ctx *Context, adminKey, key string) {
+	user, err := auth.Auth(adminKey, key)
+	if err != nil {
+		if err == auth.ErrInvalidApiKey {
+			ctx.JSON(401, "Unauthorized")
+			return
+		}
+		ctx.JSON(500, err)
+		return
+	}
+	// allow admin users to impersonate other orgs.
+	if user.IsAdmin {
+		header := ctx.Req.Header.Get("X-Worldping-Org")
+		if header != "" {
+			orgId, err := strconv.ParseInt(header, 10, 64)
+			if err == nil && orgId != 0 {
+				user.OrgId = orgId
 			}
 		}
-		ctx.SignedInUser = user
-		ctx.ApiKey = key
 	}
+	ctx.SignedInUser = user
+	ctx.ApiKey = key
 }
 
 func getApiKey(c *Context) (string, error) {
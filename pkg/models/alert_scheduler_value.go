@@ -1,6 +1,17 @@
 package models
 
+import "time"
+
 type AlertSchedulerValue struct {
 	Id    string
 	Value string
 }
+
+// AlertSchedulerLease is held by the instance that is currently running the
+// alert scheduler.  The lease must be renewed before it expires, otherwise
+// another instance can acquire it.
+type AlertSchedulerLease struct {
+	Id      string
+	Owner   string
+	Expires time.Time
+}
@@ -15,8 +15,44 @@ type AlertingJob struct {
 	LastPointTs time.Time
 	NewState    CheckEvalResult
 	TimeExec    time.Time
+	Flap        FlapEvent
+
+	// the maintenance window the check's endpoint was in when the state changed.
+	MaintenanceWindow *MaintenanceWindow
+
+	// set when the job is a reminder that the check is still critical, sent to
+	// the targets of the check's escalation policy.
+	Escalated bool
+
+	// set when the job replays a second that was missed while no scheduler
+	// was running.  Its result is recorded at LastPointTs rather than when
+	// it was executed.
+	Backfill bool
+}
+
+// CheckForEscalationDTO is a critical check along with the time its
+// escalation policy last notified, which is zero if it never has.
+type CheckForEscalationDTO struct {
+	CheckForAlertDTO `xorm:"extends"`
+	Escalated        time.Time
 }
 
 func (job *AlertingJob) String() string {
 	return fmt.Sprintf("<Job> checkId=%d generatedAt=%s lastPointTs=%s definition: %d probes for %d steps", job.Id, job.GeneratedAt, job.LastPointTs, job.HealthSettings.NumProbes, job.HealthSettings.Steps)
 }
+
+// FlapEvent describes a change to whether a check is flapping.
+type FlapEvent int
+
+const (
+	FlapNone FlapEvent = iota
+	FlapStarted
+	FlapStopped
+)
+
+// CheckFlapState holds the recent state transitions of a check, which are
+// used to detect when the check is flapping between states.
+type CheckFlapState struct {
+	Flapping    bool    `json:"flapping"`
+	Transitions []int64 `json:"transitions"` // unix timestamps of recent state changes
+}
@@ -12,6 +12,7 @@ import (
 // Typed errors
 var (
 	ErrEndpointNotFound = NewNotFoundError("Endpoint not found")
+	ErrCheckNotCritical = NewValidationError("Only critical checks can be acknowledged")
 )
 
 type Endpoint struct {
@@ -56,6 +57,15 @@ const (
 	HTTPS_CHECK CheckType = "https"
 	DNS_CHECK   CheckType = "dns"
 	PING_CHECK  CheckType = "ping"
+	TCP_CHECK   CheckType = "tcp"
+	CERT_CHECK  CheckType = "cert"
+)
+
+// default number of days before a certificate expires at which a cert
+// check enters a warning or critical state.
+const (
+	DefaultCertWarnDays = 30
+	DefaultCertCritDays = 7
 )
 
 type Check struct {
@@ -63,7 +73,7 @@ type Check struct {
 	OrgId          int64                  `json:"orgId"`
 	EndpointId     int64                  `json:"endpointId"`
 	Route          *CheckRoute            `xorm:"JSON" json:"route"`
-	Type           CheckType              `json:"type" binding:"Required,In(http,https,dns,ping)"`
+	Type           CheckType              `json:"type" binding:"Required,In(http,https,dns,ping,tcp,cert)"`
 	Frequency      int64                  `json:"frequency" binding:"Required,Range(10,300)"`
 	Offset         int64                  `json:"offset"`
 	Enabled        bool                   `json:"enabled"`
@@ -72,10 +82,20 @@ type Check struct {
 	StateCheck     time.Time              `json:"stateCheck"`
 	Settings       map[string]interface{} `json:"settings" binding:"Required"`
 	HealthSettings *CheckHealthSettings   `xorm:"JSON" json:"healthSettings"`
+	Ack            *CheckAck              `xorm:"JSON" json:"ack"`
 	Created        time.Time              `json:"created"`
 	Updated        time.Time              `json:"updated"`
 }
 
+// CheckAck records that someone is handling a critical check.  Escalations
+// are not sent for acknowledged checks, and the ack is cleared when the
+// state of the check changes.
+type CheckAck struct {
+	User    string    `json:"user"`
+	Time    time.Time `json:"time"`
+	Comment string    `json:"comment"`
+}
+
 type CheckWithSlug struct {
 	Check `xorm:"extends"`
 	Slug  string `json:"endpointSlug"`
@@ -118,21 +138,239 @@ func (c Check) Validate(quotas []OrgQuotaDTO) error {
 		if err := c.validateDNSSettings(); err != nil {
 			return err
 		}
+	case TCP_CHECK:
+		if err := c.validateTCPSettings(); err != nil {
+			return err
+		}
+	case CERT_CHECK:
+		if err := c.validateCertSettings(); err != nil {
+			return err
+		}
 	default:
 		return NewValidationError(fmt.Sprintf("unknown check type. %s", c.Type))
 	}
+
+	if c.HealthSettings != nil {
+		if err := c.HealthSettings.Validate(); err != nil {
+			return err
+		}
+		if t := c.HealthSettings.MetricThreshold; t != nil {
+			if err := t.Validate(c.Type); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
 type CheckHealthSettings struct {
-	NumProbes     int                      `json:"num_collectors" binding:"Required"`
-	Steps         int                      `json:"steps" binding:"Required"`
-	Notifications CheckNotificationSetting `json:"notifications"`
+	NumProbes  int                   `json:"num_collectors" binding:"Required"`
+	Steps      int                   `json:"steps" binding:"Required"`
+	Warning    *CheckHealthThreshold `json:"warning,omitempty"`
+	Conditions []CheckProbeCondition `json:"conditions,omitempty"`
+	// MetricThreshold is validated by Check.Validate, as the valid metrics
+	// depend on the check type.
+	MetricThreshold *CheckMetricThreshold    `json:"metricThreshold,omitempty"`
+	Notifications   CheckNotificationSetting `json:"notifications"`
+}
+
+// metrics reported by probes that can be used in a CheckMetricThreshold.
+var ThresholdMetrics = map[CheckType][]string{
+	HTTP_CHECK:  {"dns", "connect", "send", "wait", "recv", "total"},
+	HTTPS_CHECK: {"dns", "connect", "send", "wait", "recv", "total"},
+	PING_CHECK:  {"min", "max", "median", "mean", "mdev", "loss"},
+	DNS_CHECK:   {"time"},
+	TCP_CHECK:   {"connect", "total"},
+}
+
+type MetricComparison string
+
+const (
+	ComparisonGreater        MetricComparison = "gt"
+	ComparisonGreaterOrEqual MetricComparison = "gte"
+	ComparisonLess           MetricComparison = "lt"
+	ComparisonLessOrEqual    MetricComparison = "lte"
+)
+
+// Breached returns true if the value breaches the threshold.
+func (c MetricComparison) Breached(val, threshold float64) bool {
+	switch c {
+	case ComparisonGreater:
+		return val > threshold
+	case ComparisonGreaterOrEqual:
+		return val >= threshold
+	case ComparisonLess:
+		return val < threshold
+	case ComparisonLessOrEqual:
+		return val <= threshold
+	}
+	return false
+}
+
+// CheckMetricThreshold puts a check into State when a metric reported by the
+// probes, such as the http "total" time or the ping "mean" latency, breaches
+// Value for Steps consecutive steps on NumProbes probes.  State defaults to
+// critical.
+type CheckMetricThreshold struct {
+	Metric     string           `json:"metric"`
+	Comparison MetricComparison `json:"comparison"`
+	Value      float64          `json:"value"`
+	NumProbes  int              `json:"num_collectors"`
+	Steps      int              `json:"steps"`
+	State      CheckEvalResult  `json:"state"`
+}
+
+func (t *CheckMetricThreshold) Validate(checkType CheckType) error {
+	valid := false
+	for _, metric := range ThresholdMetrics[checkType] {
+		if metric == t.Metric {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return NewValidationError(fmt.Sprintf("invalid metricThreshold metric %q for %s check", t.Metric, checkType))
+	}
+	switch t.Comparison {
+	case ComparisonGreater, ComparisonGreaterOrEqual, ComparisonLess, ComparisonLessOrEqual:
+	default:
+		return NewValidationError("metricThreshold comparison must be one of gt, gte, lt or lte")
+	}
+	if t.NumProbes < 1 || t.Steps < 1 {
+		return NewValidationError("metricThreshold num_collectors and steps must be greater than 0")
+	}
+	switch t.State {
+	case EvalResultOK:
+		// not set.
+		t.State = EvalResultCrit
+	case EvalResultWarn, EvalResultCrit:
+	default:
+		return NewValidationError("metricThreshold state must be 1 (warning) or 2 (critical)")
+	}
+	return nil
+}
+
+// CheckProbeCondition puts a check into the critical state when NumProbes of
+// the probes it applies to have failed for Steps consecutive steps, however
+// many other probes are failing.  It applies to the probes with any of the
+// ProbeTags and to the probes in ProbeIds.  Steps defaults to the Steps of
+// the CheckHealthSettings and can not be greater than it.
+type CheckProbeCondition struct {
+	ProbeIds  []int64  `json:"probeIds"`
+	ProbeTags []string `json:"probeTags"`
+	NumProbes int      `json:"num_collectors"`
+	Steps     int      `json:"steps"`
+}
+
+// Matches returns true if the condition applies to the probe.
+func (c *CheckProbeCondition) Matches(probe *ProbeDTO) bool {
+	for _, id := range c.ProbeIds {
+		if id == probe.Id {
+			return true
+		}
+	}
+	for _, cTag := range c.ProbeTags {
+		for _, tag := range probe.Tags {
+			if cTag == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckHealthThreshold is the number of probes that must fail for the
+// given number of consecutive steps.  It is used to define when a check
+// is in a warning state, before the critical NumProbes/Steps threshold
+// of the CheckHealthSettings is reached.
+type CheckHealthThreshold struct {
+	NumProbes int `json:"num_collectors"`
+	Steps     int `json:"steps"`
+}
+
+func (s *CheckHealthSettings) Validate() error {
+	if s.Warning != nil {
+		if s.Warning.NumProbes < 1 || s.Warning.Steps < 1 {
+			return NewValidationError("warning num_collectors and steps must be greater than 0")
+		}
+		if s.Warning.NumProbes > s.NumProbes || s.Warning.Steps > s.Steps {
+			return NewValidationError("warning threshold must not be greater than the critical threshold")
+		}
+		if s.Warning.NumProbes == s.NumProbes && s.Warning.Steps == s.Steps {
+			return NewValidationError("warning threshold must be lower than the critical threshold")
+		}
+	}
+	for _, c := range s.Conditions {
+		if len(c.ProbeIds) == 0 && len(c.ProbeTags) == 0 {
+			return NewValidationError("conditions must define probeIds or probeTags")
+		}
+		if c.NumProbes < 1 {
+			return NewValidationError("condition num_collectors must be greater than 0")
+		}
+		if c.Steps < 0 || c.Steps > s.Steps {
+			return NewValidationError("condition steps must not be greater than the critical threshold steps")
+		}
+	}
+	for i := range s.Notifications.Channels {
+		if err := s.Notifications.Channels[i].Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Notifications.Escalation != nil {
+		if err := s.Notifications.Escalation.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type CheckNotificationSetting struct {
-	Enabled   bool   `json:"enabled"`
-	Addresses string `json:"addresses"`
+	Enabled    bool                   `json:"enabled"`
+	Addresses  string                 `json:"addresses"`
+	Channels   []NotificationChannel  `json:"channels"`
+	Notifiers  []int64                `json:"notifiers"`
+	Escalation *CheckEscalationPolicy `json:"escalation,omitempty"`
+}
+
+// NotifierIds returns the ids of all org level notifiers referenced by the
+// settings, including those of the escalation policy.
+func (s *CheckNotificationSetting) NotifierIds() []int64 {
+	ids := make([]int64, 0, len(s.Notifiers))
+	ids = append(ids, s.Notifiers...)
+	if s.Escalation != nil {
+		ids = append(ids, s.Escalation.Notifiers...)
+	}
+	return ids
+}
+
+// CheckEscalationPolicy defines who to notify when a check stays critical.
+// Once the check has been critical for After minutes its targets are
+// notified, and then again every Repeat minutes until the check recovers.
+// A Repeat of 0 only notifies once.
+type CheckEscalationPolicy struct {
+	After     int                   `json:"after"`
+	Repeat    int                   `json:"repeat"`
+	Addresses string                `json:"addresses"`
+	Channels  []NotificationChannel `json:"channels"`
+	Notifiers []int64               `json:"notifiers"`
+}
+
+func (p *CheckEscalationPolicy) Validate() error {
+	if p.After < 1 {
+		return NewValidationError("escalation after must be at least 1 minute")
+	}
+	if p.Repeat < 0 {
+		return NewValidationError("escalation repeat must not be negative")
+	}
+	if strings.TrimSpace(p.Addresses) == "" && len(p.Channels) == 0 && len(p.Notifiers) == 0 {
+		return NewValidationError("escalation must define addresses, channels or notifiers")
+	}
+	for i := range p.Channels {
+		if err := p.Channels[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type RouteType string
@@ -238,6 +476,13 @@ type DiscoverEndpointCmd struct {
 	Name string `form:"name"`
 }
 
+// AckCheckCmd acknowledges a critical check.  User defaults to the name of
+// the api key making the request.
+type AckCheckCmd struct {
+	User    string `json:"user"`
+	Comment string `json:"comment"`
+}
+
 // ---------------------
 // QUERIES
 type GetEndpointsQuery struct {
@@ -660,3 +905,163 @@ func (c Check) validateDNSSettings() error {
 	}
 	return nil
 }
+
+func (c Check) validateTCPSettings() error {
+	settings := c.Settings
+
+	requiredFields := map[string]string{
+		"host": "string",
+		"port": "number",
+	}
+	optFields := map[string]string{
+		"send":      "string",
+		"expect":    "string",
+		"timeout":   "number",
+		"ipversion": "ipversion",
+	}
+	for field, dataType := range requiredFields {
+		rawVal, ok := settings[field]
+		if !ok {
+			return NewValidationError(fmt.Sprintf("%s field missing from TCP check", field))
+		}
+		switch dataType {
+		case "string":
+			value, ok := rawVal.(string)
+			if !ok {
+				return NewValidationError(fmt.Sprintf("%s field is invalid type. Expected string", field))
+			}
+			if value == "" {
+				return NewValidationError(fmt.Sprintf("%s field missing from TCP check", field))
+			}
+		case "number":
+			value, ok := rawVal.(float64)
+			if !ok {
+				return NewValidationError(fmt.Sprintf("%s field is invalid type. Expected number", field))
+			}
+			if field == "port" {
+				settings[field] = int(value)
+				if value < 1 || value > 65535 {
+					return NewValidationError(fmt.Sprintf("%s field is invalid. must be between 1 and 65535", field))
+				}
+			}
+		}
+	}
+
+	for field, dataType := range optFields {
+		rawVal, ok := settings[field]
+		if !ok {
+			continue
+		}
+		switch dataType {
+		case "string":
+			_, ok := rawVal.(string)
+			if !ok {
+				return NewValidationError(fmt.Sprintf("%s field is invalid type. Expected string", field))
+			}
+		case "number":
+			value, ok := rawVal.(float64)
+			if !ok {
+				return NewValidationError(fmt.Sprintf("%s field is invalid type. Expected number", field))
+			}
+			if field == "timeout" {
+				if value <= 0.0 || value > 10.0 {
+					return NewValidationError(fmt.Sprintf("%s field is invalid. must be between 1 and 10", field))
+				}
+			}
+		case "ipversion":
+			version, ok := rawVal.(string)
+			if !ok {
+				return NewValidationError(fmt.Sprintf("%s field is invalid type. Expected ip version", field))
+			}
+			if !(version == "v4" || version == "v6" || version == "any") {
+				return NewValidationError(fmt.Sprintf("%s field is invalid. Expected v4, v6 or any", field))
+			}
+		}
+	}
+	return nil
+}
+
+func (c Check) validateCertSettings() error {
+	settings := c.Settings
+
+	requiredFields := map[string]string{
+		"host": "string",
+	}
+	optFields := map[string]string{
+		"port":     "number",
+		"sni":      "string",
+		"warnDays": "number",
+		"critDays": "number",
+		"timeout":  "number",
+	}
+	for field, dataType := range requiredFields {
+		rawVal, ok := settings[field]
+		if !ok {
+			return NewValidationError(fmt.Sprintf("%s field missing from Cert check", field))
+		}
+		switch dataType {
+		case "string":
+			value, ok := rawVal.(string)
+			if !ok {
+				return NewValidationError(fmt.Sprintf("%s field is invalid type. Expected string", field))
+			}
+			if value == "" {
+				return NewValidationError(fmt.Sprintf("%s field missing from Cert check", field))
+			}
+		}
+	}
+
+	for field, dataType := range optFields {
+		rawVal, ok := settings[field]
+		if !ok {
+			continue
+		}
+		switch dataType {
+		case "string":
+			_, ok := rawVal.(string)
+			if !ok {
+				return NewValidationError(fmt.Sprintf("%s field is invalid type. Expected string", field))
+			}
+		case "number":
+			value, ok := rawVal.(float64)
+			if !ok {
+				return NewValidationError(fmt.Sprintf("%s field is invalid type. Expected number", field))
+			}
+			switch field {
+			case "timeout":
+				if value <= 0.0 || value > 10.0 {
+					return NewValidationError(fmt.Sprintf("%s field is invalid. must be between 1 and 10", field))
+				}
+			case "port":
+				settings[field] = int(value)
+				if value < 1 || value > 65535 {
+					return NewValidationError(fmt.Sprintf("%s field is invalid. must be between 1 and 65535", field))
+				}
+			case "warnDays", "critDays":
+				if value < 0 || value > 365 {
+					return NewValidationError(fmt.Sprintf("%s field is invalid. must be between 0 and 365", field))
+				}
+			}
+		}
+	}
+
+	warnDays, critDays := CertExpiryThresholds(settings)
+	if critDays > warnDays {
+		return NewValidationError("critDays field is invalid. must not be greater than warnDays")
+	}
+	return nil
+}
+
+// CertExpiryThresholds returns the warnDays and critDays settings of a cert
+// check, falling back to the defaults when they are not set.
+func CertExpiryThresholds(settings map[string]interface{}) (float64, float64) {
+	warnDays := float64(DefaultCertWarnDays)
+	critDays := float64(DefaultCertCritDays)
+	if v, ok := settings["warnDays"].(float64); ok {
+		warnDays = v
+	}
+	if v, ok := settings["critDays"].(float64); ok {
+		critDays = v
+	}
+	return warnDays, critDays
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"time"
+)
+
+// Typed errors
+var (
+	ErrMaintenanceWindowNotFound = NewNotFoundError("Maintenance window not found")
+)
+
+type MaintenanceRecurrence string
+
+const (
+	RecurrenceNone   MaintenanceRecurrence = ""
+	RecurrenceDaily  MaintenanceRecurrence = "daily"
+	RecurrenceWeekly MaintenanceRecurrence = "weekly"
+)
+
+// MaintenanceWindow is a period of time during which state changes of the
+// matching endpoints' checks do not send notifications.  Endpoints are
+// matched by id or by tag.  Recurring windows repeat every day or week,
+// starting from Start, for the duration of End - Start.
+type MaintenanceWindow struct {
+	Id           int64                 `json:"id"`
+	OrgId        int64                 `json:"orgId"`
+	Name         string                `json:"name" binding:"Required"`
+	EndpointIds  []int64               `xorm:"JSON" json:"endpointIds"`
+	EndpointTags []string              `xorm:"JSON" json:"endpointTags"`
+	Start        time.Time             `xorm:"'start_time'" json:"start" binding:"Required"`
+	End          time.Time             `xorm:"'end_time'" json:"end" binding:"Required"`
+	Recurrence   MaintenanceRecurrence `json:"recurrence"`
+	Notify       bool                  `json:"notify"`
+	Created      time.Time             `json:"created"`
+	Updated      time.Time             `json:"updated"`
+}
+
+func (w *MaintenanceWindow) Validate() error {
+	if w.Name == "" {
+		return NewValidationError("Maintenance window name not set.")
+	}
+	if len(w.EndpointIds) == 0 && len(w.EndpointTags) == 0 {
+		return NewValidationError("Maintenance window must define endpointIds or endpointTags.")
+	}
+	if !w.End.After(w.Start) {
+		return NewValidationError("Maintenance window end must be after start.")
+	}
+	switch w.Recurrence {
+	case RecurrenceNone:
+	case RecurrenceDaily, RecurrenceWeekly:
+		if w.End.Sub(w.Start) >= w.period() {
+			return NewValidationError("Maintenance window must be shorter than its recurrence period.")
+		}
+	default:
+		return NewValidationError("Invalid recurrence. Must be one of daily or weekly.")
+	}
+	return nil
+}
+
+func (w *MaintenanceWindow) period() time.Duration {
+	switch w.Recurrence {
+	case RecurrenceDaily:
+		return 24 * time.Hour
+	case RecurrenceWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// Active returns true if the window is in effect at time t.
+func (w *MaintenanceWindow) Active(t time.Time) bool {
+	if t.Before(w.Start) {
+		return false
+	}
+	if w.Recurrence == RecurrenceNone {
+		return t.Before(w.End)
+	}
+	offset := t.Sub(w.Start) % w.period()
+	return offset < w.End.Sub(w.Start)
+}
+
+// Matches returns true if the window applies to the endpoint.
+func (w *MaintenanceWindow) Matches(endpointId int64, tags []string) bool {
+	for _, id := range w.EndpointIds {
+		if id == endpointId {
+			return true
+		}
+	}
+	for _, wTag := range w.EndpointTags {
+		for _, tag := range tags {
+			if wTag == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ---------------------
+// QUERIES
+
+type GetMaintenanceWindowsQuery struct {
+	OrgId      int64  `form:"-"`
+	EndpointId int64  `form:"endpointId"`
+	Active     bool   `form:"active"`
+	OrderBy    string `form:"orderBy" binding:"In(name,start_time,end_time,created,updated,)"`
+}
@@ -51,12 +51,16 @@ var (
 		HTTPS_CHECK,
 		PING_CHECK,
 		DNS_CHECK,
+		TCP_CHECK,
+		CERT_CHECK,
 	}
 	CheckTypeToMonitorTypeMap = map[CheckType]int64{
 		HTTP_CHECK:  1,
 		HTTPS_CHECK: 2,
 		PING_CHECK:  3,
 		DNS_CHECK:   4,
+		TCP_CHECK:   5,
+		CERT_CHECK:  6,
 	}
 )
 
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type NotificationChannelType string
+
+const (
+	EmailChannel     NotificationChannelType = "email"
+	WebhookChannel   NotificationChannelType = "webhook"
+	SlackChannel     NotificationChannelType = "slack"
+	PagerDutyChannel NotificationChannelType = "pagerduty"
+)
+
+// NotificationChannel defines a single destination that check state
+// changes are delivered to.  The contents of Settings are specific to
+// each channel Type.
+type NotificationChannel struct {
+	Type     NotificationChannelType `json:"type" binding:"Required"`
+	Settings map[string]interface{}  `json:"settings"`
+}
+
+func (c *NotificationChannel) Validate() error {
+	switch c.Type {
+	case EmailChannel:
+		return c.validateSettings(
+			map[string]string{"addresses": "string"},
+			map[string]string{},
+		)
+	case WebhookChannel:
+		return c.validateSettings(
+			map[string]string{"url": "url"},
+			map[string]string{"method": "method", "username": "string", "password": "string", "notifyWarning": "bool"},
+		)
+	case SlackChannel:
+		return c.validateSettings(
+			map[string]string{"url": "url"},
+			map[string]string{"channel": "string", "username": "string", "notifyWarning": "bool"},
+		)
+	case PagerDutyChannel:
+		return c.validateSettings(
+			map[string]string{"routingKey": "string"},
+			map[string]string{"url": "url"},
+		)
+	default:
+		return NewValidationError(fmt.Sprintf("unknown notification channel type. %s", c.Type))
+	}
+}
+
+func (c *NotificationChannel) validateSettings(requiredFields, optFields map[string]string) error {
+	if c.Settings == nil {
+		return NewValidationError(fmt.Sprintf("settings missing from %s notification channel", c.Type))
+	}
+	for field := range requiredFields {
+		rawVal, ok := c.Settings[field]
+		if !ok {
+			return NewValidationError(fmt.Sprintf("%s field missing from %s notification channel", field, c.Type))
+		}
+		value, ok := rawVal.(string)
+		if !ok {
+			return NewValidationError(fmt.Sprintf("%s field is invalid type. Expected string", field))
+		}
+		if value == "" {
+			return NewValidationError(fmt.Sprintf("%s field missing from %s notification channel", field, c.Type))
+		}
+	}
+
+	fields := make(map[string]string)
+	for field, dataType := range requiredFields {
+		fields[field] = dataType
+	}
+	for field, dataType := range optFields {
+		fields[field] = dataType
+	}
+
+	for field, dataType := range fields {
+		rawVal, ok := c.Settings[field]
+		if !ok {
+			continue
+		}
+		value, ok := rawVal.(string)
+		if !ok {
+			return NewValidationError(fmt.Sprintf("%s field is invalid type. Expected string", field))
+		}
+		switch dataType {
+		case "url":
+			u, err := url.Parse(value)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return NewValidationError(fmt.Sprintf("%s field is invalid. Expected http or https URL", field))
+			}
+		case "method":
+			method := strings.ToUpper(value)
+			if method != "POST" && method != "PUT" {
+				return NewValidationError(fmt.Sprintf("%s field is invalid. Expected POST or PUT", field))
+			}
+		case "bool":
+			if value != "true" && value != "false" {
+				return NewValidationError(fmt.Sprintf("%s field is invalid. Expected true or false", field))
+			}
+		}
+	}
+	return nil
+}
+
+// Setting returns the string value of a channel setting, or "" if it is not set.
+func (c *NotificationChannel) Setting(key string) string {
+	if c.Settings == nil {
+		return ""
+	}
+	if value, ok := c.Settings[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// Typed errors
+var (
+	ErrNotifierNotFound = NewNotFoundError("Notifier not found")
+	ErrNotifierInUse    = NewValidationError("Notifier is still in use by one or more checks")
+)
+
+// Notifier is a named notification channel owned by an org.  Checks
+// reference notifiers by id from their HealthSettings.
+type Notifier struct {
+	Id       int64                   `json:"id"`
+	OrgId    int64                   `json:"orgId"`
+	Name     string                  `json:"name" binding:"Required"`
+	Type     NotificationChannelType `json:"type" binding:"Required"`
+	Settings map[string]interface{}  `xorm:"JSON" json:"settings"`
+	Created  time.Time               `json:"created"`
+	Updated  time.Time               `json:"updated"`
+}
+
+func (n *Notifier) Channel() *NotificationChannel {
+	return &NotificationChannel{Type: n.Type, Settings: n.Settings}
+}
+
+func (n *Notifier) Validate() error {
+	if n.Name == "" {
+		return NewValidationError("Notifier name not set.")
+	}
+	return n.Channel().Validate()
+}
+
+type CheckNotifierIndex struct {
+	Id         int64
+	OrgId      int64
+	CheckId    int64
+	NotifierId int64
+	Created    time.Time
+}
+
+// ---------------------
+// QUERIES
+
+type GetNotifiersQuery struct {
+	OrgId   int64  `form:"-"`
+	Name    string `form:"name"`
+	Type    string `form:"type"`
+	OrderBy string `form:"orderBy" binding:"In(name,type,created,updated,)"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// maximum number of evaluations a single alert preview may perform.
+const MaxAlertPreviewEvaluations = 10000
+
+// AlertPreview is the result of replaying the alerting rules of a check over
+// historical data.
+type AlertPreview struct {
+	CheckId       int64                      `json:"checkId"`
+	EndpointId    int64                      `json:"endpointId"`
+	CheckType     string                     `json:"checkType"`
+	From          time.Time                  `json:"from"`
+	To            time.Time                  `json:"to"`
+	Evaluations   int                        `json:"evaluations"`
+	Timeline      []AlertPreviewState        `json:"timeline"`
+	Notifications []AlertPreviewNotification `json:"notifications"`
+}
+
+// AlertPreviewState is the state the check would have entered at Timestamp.
+type AlertPreviewState struct {
+	Timestamp time.Time       `json:"timestamp"`
+	State     CheckEvalResult `json:"state"`
+}
+
+// AlertPreviewNotification is a notification the check would have sent.
+type AlertPreviewNotification struct {
+	Timestamp time.Time       `json:"timestamp"`
+	PrevState CheckEvalResult `json:"prevState"`
+	State     CheckEvalResult `json:"state"`
+	Targets   []string        `json:"targets"`
+}
+
+// ----------------------
+// COMMANDS
+
+// PreviewAlertCmd replays the alerting rules of an existing check, given by
+// CheckId, or of an unsaved Check.  HealthSettings, if set, replace those of
+// the check.  From and To are unix timestamps in seconds.  To defaults to now
+// and From defaults to 24 hours before To.
+type PreviewAlertCmd struct {
+	CheckId        int64                `json:"checkId"`
+	Check          *Check               `json:"check"`
+	HealthSettings *CheckHealthSettings `json:"healthSettings"`
+	From           int64                `json:"from"`
+	To             int64                `json:"to"`
+}
+
+func (cmd *PreviewAlertCmd) Validate() error {
+	if (cmd.CheckId == 0) == (cmd.Check == nil) {
+		return NewValidationError("exactly one of checkId or check must be set.")
+	}
+	if cmd.From < 0 || cmd.To < 0 {
+		return NewValidationError("from and to must not be negative.")
+	}
+	if cmd.To == 0 {
+		cmd.To = time.Now().Unix()
+	}
+	if cmd.From == 0 {
+		cmd.From = cmd.To - int64(24*time.Hour/time.Second)
+	}
+	if cmd.To <= cmd.From {
+		return NewValidationError("to must be after from.")
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"gopkg.in/raintank/schema.v1"
 )
 
 // Typed errors
@@ -44,7 +46,57 @@ type ProbeSession struct {
 	Version    string
 	InstanceId string
 	RemoteIp   string
-	Updated    time.Time
+	Health     *ProbeHealth `xorm:"JSON"`
+	// offset of the probe's clock from ours, in milliseconds.
+	ClockSkew float64
+	Updated   time.Time
+}
+
+// Supports returns true if the probe session can execute checks of the given
+// type.  Probes that have not reported the check types they support are
+// assumed to support all of them.
+func (s *ProbeSession) Supports(checkType CheckType) bool {
+	if s.Health == nil || len(s.Health.CheckTypes) == 0 {
+		return true
+	}
+	for _, t := range s.Health.CheckTypes {
+		if t == checkType {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionForCheck returns the session that should execute a check.  Checks
+// are spread by id over the sessions that support their type, so it returns
+// nil if no session supports the check type.
+func SessionForCheck(sessions []ProbeSession, checkId int64, checkType CheckType) *ProbeSession {
+	supported := make([]*ProbeSession, 0, len(sessions))
+	for i := range sessions {
+		if sessions[i].Supports(checkType) {
+			supported = append(supported, &sessions[i])
+		}
+	}
+	if len(supported) == 0 {
+		return nil
+	}
+	return supported[checkId%int64(len(supported))]
+}
+
+// ProbeHealth is the health report that probes periodically send over their
+// socket.
+type ProbeHealth struct {
+	// number of checks waiting to be executed.
+	QueueDepth int `json:"queueDepth"`
+	// number of checks currently executing.
+	ChecksExecuting int `json:"checksExecuting"`
+	// number of check executions that failed since the probe started.
+	Failures int64 `json:"failures"`
+	// offset of the probe's clock from NTP, in milliseconds.
+	ClockSkew float64 `json:"clockSkew"`
+	// check types the probe can execute.
+	CheckTypes []CheckType `json:"checkTypes"`
+	Updated    time.Time   `json:"updated"`
 }
 
 // ----------------------
@@ -65,6 +117,11 @@ type ProbeDTO struct {
 	Created       time.Time `json:"created"`
 	Updated       time.Time `json:"updated"`
 	RemoteIp      []string  `json:"remoteIp"`
+	// latest health reports of the connected probe sessions.
+	Health []*ProbeHealth `json:"health,omitempty"`
+	// largest offset of the clock of the connected probe sessions from ours,
+	// in milliseconds.
+	ClockSkew float64 `json:"clockSkew"`
 }
 
 type ProbeLocationDTO struct {
@@ -74,6 +131,24 @@ type ProbeLocationDTO struct {
 	Name      string  `json:"name"`
 }
 
+// ProbeClockSync is sent to probes to measure the offset of their clock.
+// Probes reply with the same Ts, and ProbeTs set to the time on their clock.
+type ProbeClockSync struct {
+	// time the request was sent, in milliseconds.
+	Ts int64 `json:"ts"`
+	// time on the probe's clock when it received the request, in milliseconds.
+	ProbeTs int64 `json:"probeTs"`
+}
+
+// ClockSkew returns the offset of the probe's clock, in milliseconds, for a
+// reply received at the given time.  The probe is assumed to have received
+// the request half way through the round trip.
+func (s *ProbeClockSync) ClockSkew(received time.Time) float64 {
+	sent := float64(s.Ts)
+	rtt := float64(received.UnixNano()/int64(time.Millisecond)) - sent
+	return float64(s.ProbeTs) - (sent + rtt/2)
+}
+
 type ProbeReadyPayload struct {
 	Collector    *ProbeDTO        `json:"collector"`
 	MonitorTypes []MonitorTypeDTO `json:"monitor_types"`
@@ -100,3 +175,12 @@ func (collector *Probe) UpdateSlug() {
 	re2 := regexp.MustCompile("\\s")
 	collector.Slug = re2.ReplaceAllString(re.ReplaceAllString(name, ""), "-")
 }
+
+// ---------------------
+// COMMANDS
+
+// ProbeResultsCmd is a batch of results pushed by a probe over http.
+type ProbeResultsCmd struct {
+	Metrics []*schema.MetricData `json:"metrics"`
+	Events  []*schema.ProbeEvent `json:"events"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Typed errors
+var (
+	ErrProbeTokenNotFound = NewNotFoundError("Probe token not found")
+)
+
+// ProbeTokenPrefix is the prefix of all probe tokens, so that they can be
+// told apart from org API keys.
+const ProbeTokenPrefix = "wpp_"
+
+// ProbeToken authenticates a single probe.  Unlike org API keys, probe tokens
+// only allow a probe to connect, fetch its checks and submit results.  Only
+// a hash of the token is stored.
+type ProbeToken struct {
+	Id      int64
+	OrgId   int64
+	ProbeId int64
+	Hash    string
+	Created time.Time
+}
+
+// ---------------------
+// DTO
+type ProbeTokenDTO struct {
+	Id      int64     `json:"id"`
+	ProbeId int64     `json:"probeId"`
+	Token   string    `json:"token,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+func (t *ProbeToken) ToDTO() ProbeTokenDTO {
+	return ProbeTokenDTO{
+		Id:      t.Id,
+		ProbeId: t.ProbeId,
+		Created: t.Created,
+	}
+}
+
+// NewProbeToken generates a new random probe token.
+func NewProbeToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return ProbeTokenPrefix + hex.EncodeToString(b), nil
+}
+
+// HashProbeToken returns the hash of a probe token that is stored in the DB.
+func HashProbeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsProbeToken returns true if key is a probe token rather than an API key.
+func IsProbeToken(key string) bool {
+	return strings.HasPrefix(key, ProbeTokenPrefix)
+}
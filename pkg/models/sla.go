@@ -0,0 +1,127 @@
+package models
+
+import (
+	"time"
+)
+
+// CheckSLA summarizes the availability of a check over a time range.  A
+// check is considered down while it is in the critical state.  Time during
+// which the state of the check is unknown is excluded from the uptime.
+type CheckSLA struct {
+	CheckId    int64     `json:"checkId"`
+	EndpointId int64     `json:"endpointId"`
+	CheckType  CheckType `json:"checkType"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+
+	// percentage of time with a known state that the check was not critical.
+	// nil if the state of the check was never known during the range.
+	Uptime *float64 `json:"uptime"`
+
+	// number of times the check became critical.  A check that was already
+	// critical at the start of the range counts as one incident.
+	Incidents int `json:"incidents"`
+
+	// mean duration, in seconds, of the incidents that were resolved within
+	// the range.
+	MTTR float64 `json:"mttr"`
+
+	// total time, in seconds, that the check was critical.
+	Downtime int64 `json:"downtime"`
+
+	// total time, in seconds, that the state of the check was unknown.
+	Unknown int64 `json:"unknown"`
+}
+
+// NewCheckSLA computes the SLA of a check from the state it was in at from,
+// and its state changes within the range, which must be ordered by time.
+func NewCheckSLA(check *Check, initial CheckEvalResult, changes []CheckStateChange, from, to time.Time) *CheckSLA {
+	sla := &CheckSLA{
+		CheckId:    check.Id,
+		EndpointId: check.EndpointId,
+		CheckType:  check.Type,
+		From:       from,
+		To:         to,
+	}
+	var downtime, unknown, repairTime time.Duration
+	resolved := 0
+
+	state := initial
+	last := from
+	incidentStart := from
+	if state == EvalResultCrit {
+		sla.Incidents++
+	}
+	account := func(until time.Time) {
+		d := until.Sub(last)
+		switch state {
+		case EvalResultCrit:
+			downtime += d
+		case EvalResultUnknown:
+			unknown += d
+		}
+		last = until
+	}
+
+	for _, c := range changes {
+		if c.Timestamp.Before(from) || !c.Timestamp.Before(to) {
+			continue
+		}
+		account(c.Timestamp)
+		if c.State == EvalResultCrit && state != EvalResultCrit {
+			sla.Incidents++
+			incidentStart = c.Timestamp
+		} else if state == EvalResultCrit && c.State != EvalResultCrit {
+			resolved++
+			repairTime += c.Timestamp.Sub(incidentStart)
+		}
+		state = c.State
+	}
+	account(to)
+
+	sla.Downtime = int64(downtime.Seconds())
+	sla.Unknown = int64(unknown.Seconds())
+	if resolved > 0 {
+		sla.MTTR = repairTime.Seconds() / float64(resolved)
+	}
+	known := to.Sub(from) - unknown
+	if known > 0 {
+		uptime := 100 * (known - downtime).Seconds() / known.Seconds()
+		sla.Uptime = &uptime
+	}
+	return sla
+}
+
+// ---------------------
+// QUERIES
+
+// GetSLAReportQuery requests the SLA of a check, or of all checks of an
+// endpoint.  From and To are unix timestamps in seconds.  To defaults to, and
+// is limited to, now.  From defaults to 30 days before To.
+type GetSLAReportQuery struct {
+	OrgId      int64  `form:"-"`
+	CheckId    int64  `form:"-"`
+	EndpointId int64  `form:"-"`
+	From       int64  `form:"from"`
+	To         int64  `form:"to"`
+	Format     string `form:"format" binding:"In(json,csv,)"`
+}
+
+func (q *GetSLAReportQuery) Validate() error {
+	if q.From < 0 || q.To < 0 {
+		return NewValidationError("from and to must not be negative.")
+	}
+	// the report can not extend past now, as the current state would
+	// otherwise be counted up to the future end of the window.
+	now := time.Now().Unix()
+	if q.To == 0 || q.To > now {
+		q.To = now
+	}
+	if q.From == 0 {
+		q.From = q.To - int64(30*24*time.Hour/time.Second)
+	}
+	if q.To <= q.From {
+		return NewValidationError("to must be after from.")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// CheckStateChange records a single transition of a check's state.
+type CheckStateChange struct {
+	Id         int64           `json:"id"`
+	OrgId      int64           `json:"orgId"`
+	EndpointId int64           `json:"endpointId"`
+	CheckId    int64           `json:"checkId"`
+	CheckType  CheckType       `json:"checkType"`
+	PrevState  CheckEvalResult `json:"prevState"`
+	State      CheckEvalResult `json:"state"`
+	Timestamp  time.Time       `xorm:"'ts'" json:"timestamp"`
+}
+
+// ---------------------
+// QUERIES
+
+// GetCheckStateHistoryQuery returns the state changes of a check, or of all
+// checks of an endpoint, that happened between From and To.  From and To are
+// unix timestamps in seconds, and are unbounded when not set.
+type GetCheckStateHistoryQuery struct {
+	OrgId      int64 `form:"-"`
+	CheckId    int64 `form:"-"`
+	EndpointId int64 `form:"-"`
+	From       int64 `form:"from"`
+	To         int64 `form:"to"`
+	Limit      int   `form:"limit"`
+}
+
+func (q *GetCheckStateHistoryQuery) Validate() error {
+	if q.From < 0 || q.To < 0 || q.Limit < 0 {
+		return NewValidationError("from, to and limit must not be negative.")
+	}
+	if q.To != 0 && q.To <= q.From {
+		return NewValidationError("to must be after from.")
+	}
+	return nil
+}
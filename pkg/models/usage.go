@@ -22,6 +22,8 @@ type CheckUsage struct {
 	HTTPS CheckHTTPSUsage
 	PING  CheckPINGUsage
 	DNS   CheckDNSUsage
+	TCP   CheckTCPUsage
+	CERT  CheckCERTUsage
 }
 
 type CheckHTTPUsage struct {
@@ -41,6 +43,14 @@ type CheckDNSUsage struct {
 	Total  int64
 	PerOrg map[string]int64
 }
+type CheckTCPUsage struct {
+	Total  int64
+	PerOrg map[string]int64
+}
+type CheckCERTUsage struct {
+	Total  int64
+	PerOrg map[string]int64
+}
 
 func NewUsage() *Usage {
 	return &Usage{
@@ -63,6 +73,12 @@ func NewUsage() *Usage {
 			DNS: CheckDNSUsage{
 				PerOrg: make(map[string]int64),
 			},
+			TCP: CheckTCPUsage{
+				PerOrg: make(map[string]int64),
+			},
+			CERT: CheckCERTUsage{
+				PerOrg: make(map[string]int64),
+			},
 		},
 	}
 }
@@ -101,6 +101,40 @@ func (s MonitorSettingsDTO) ToV2Setting(t CheckType) map[string]interface{} {
 				settings["timeout"], _ = strconv.ParseFloat(v.Value, 64)
 			}
 		}
+	case TCP_CHECK:
+		for _, v := range s {
+			switch v.Variable {
+			case "host":
+				settings["host"] = v.Value
+			case "port":
+				settings["port"], _ = strconv.ParseInt(v.Value, 10, 64)
+			case "send":
+				settings["send"] = v.Value
+			case "expect":
+				settings["expect"] = v.Value
+			case "timeout":
+				settings["timeout"], _ = strconv.ParseFloat(v.Value, 64)
+			case "ipversion":
+				settings["ipversion"] = v.Value
+			}
+		}
+	case CERT_CHECK:
+		for _, v := range s {
+			switch v.Variable {
+			case "host":
+				settings["host"] = v.Value
+			case "port":
+				settings["port"], _ = strconv.ParseInt(v.Value, 10, 64)
+			case "sni":
+				settings["sni"] = v.Value
+			case "warnDays":
+				settings["warnDays"], _ = strconv.ParseFloat(v.Value, 64)
+			case "critDays":
+				settings["critDays"], _ = strconv.ParseFloat(v.Value, 64)
+			case "timeout":
+				settings["timeout"], _ = strconv.ParseFloat(v.Value, 64)
+			}
+		}
 	}
 	return settings
 }
@@ -322,4 +356,114 @@ var MonitorTypes = []MonitorTypeDTO{
 			},
 		},
 	},
+	{
+		Id:   5,
+		Name: "TCP",
+		Settings: []MonitorTypeSettingDTO{
+			{
+				Variable:     "host",
+				Description:  "Hostname",
+				Required:     true,
+				DataType:     "String",
+				Conditions:   map[string]interface{}{},
+				DefaultValue: "",
+			},
+			{
+				Variable:     "port",
+				Description:  "Port",
+				Required:     true,
+				DataType:     "Number",
+				Conditions:   map[string]interface{}{},
+				DefaultValue: "",
+			},
+			{
+				Variable:     "send",
+				Description:  "Data to send after connecting",
+				Required:     false,
+				DataType:     "String",
+				Conditions:   map[string]interface{}{},
+				DefaultValue: "",
+			},
+			{
+				Variable:     "expect",
+				Description:  "Expected response banner",
+				Required:     false,
+				DataType:     "String",
+				Conditions:   map[string]interface{}{},
+				DefaultValue: "",
+			},
+			{
+				Variable:     "timeout",
+				Description:  "Timeout",
+				Required:     true,
+				DataType:     "Number",
+				Conditions:   map[string]interface{}{},
+				DefaultValue: "5",
+			},
+			{
+				Variable:    "ipversion",
+				Description: "IP Version",
+				Required:    false,
+				DataType:    "Enum",
+				Conditions: map[string]interface{}{
+					"values": []string{"v4", "v6", "any"},
+				},
+				DefaultValue: "v4",
+			},
+		},
+	},
+	{
+		Id:   6,
+		Name: "Cert",
+		Settings: []MonitorTypeSettingDTO{
+			{
+				Variable:     "host",
+				Description:  "Hostname",
+				Required:     true,
+				DataType:     "String",
+				Conditions:   map[string]interface{}{},
+				DefaultValue: "",
+			},
+			{
+				Variable:     "port",
+				Description:  "Port",
+				Required:     false,
+				DataType:     "Number",
+				Conditions:   map[string]interface{}{},
+				DefaultValue: "443",
+			},
+			{
+				Variable:     "sni",
+				Description:  "SNI Server Name",
+				Required:     false,
+				DataType:     "String",
+				Conditions:   map[string]interface{}{},
+				DefaultValue: "",
+			},
+			{
+				Variable:     "warnDays",
+				Description:  "Warn Days Before Expiry",
+				Required:     false,
+				DataType:     "Number",
+				Conditions:   map[string]interface{}{},
+				DefaultValue: "30",
+			},
+			{
+				Variable:     "critDays",
+				Description:  "Critical Days Before Expiry",
+				Required:     false,
+				DataType:     "Number",
+				Conditions:   map[string]interface{}{},
+				DefaultValue: "7",
+			},
+			{
+				Variable:     "timeout",
+				Description:  "Timeout",
+				Required:     false,
+				DataType:     "Number",
+				Conditions:   map[string]interface{}{},
+				DefaultValue: "5",
+			},
+		},
+	},
 }
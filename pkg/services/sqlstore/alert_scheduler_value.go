@@ -1,6 +1,8 @@
 package sqlstore
 
 import (
+	"time"
+
 	m "github.com/raintank/worldping-api/pkg/models"
 )
 
@@ -56,3 +58,83 @@ func updateAlertSchedulerValue(sess *session, id, value string) error {
 
 	return err
 }
+
+// AcquireAlertSchedulerLease acquires or renews the lease with the given id
+// for owner, until now+ttl.  It returns false if the lease is held by
+// another owner and has not expired.
+func AcquireAlertSchedulerLease(id, owner string, now time.Time, ttl time.Duration) (bool, error) {
+	sess, err := newSession(true, "alert_scheduler_lease")
+	if err != nil {
+		return false, err
+	}
+	defer sess.Cleanup()
+
+	acquired, err := acquireAlertSchedulerLease(sess, id, owner, now, ttl)
+	if err != nil {
+		return false, err
+	}
+	sess.Complete()
+	return acquired, nil
+}
+
+func acquireAlertSchedulerLease(sess *session, id, owner string, now time.Time, ttl time.Duration) (bool, error) {
+	rawSql := "UPDATE alert_scheduler_lease SET owner=?, expires=? WHERE id=? AND (owner=? OR expires < ?)"
+	res, err := sess.Exec(rawSql, owner, now.Add(ttl), id, owner, now)
+	if err != nil {
+		return false, err
+	}
+	if aff, _ := res.RowsAffected(); aff > 0 {
+		return true, nil
+	}
+	sess.Table("alert_scheduler_lease")
+	exists, err := sess.Where("id=?", id).Get(&m.AlertSchedulerLease{})
+	if err != nil || exists {
+		return false, err
+	}
+	lease := &m.AlertSchedulerLease{
+		Id:      id,
+		Owner:   owner,
+		Expires: now.Add(ttl),
+	}
+	sess.Table("alert_scheduler_lease")
+	if _, err := sess.Insert(lease); err != nil {
+		if isUniqueConstraintError(err) {
+			// another instance inserted the lease first.
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseAlertSchedulerLease gives up the lease with the given id, if it is
+// held by owner, so that another instance can acquire it straight away.
+func ReleaseAlertSchedulerLease(id, owner string) error {
+	sess, err := newSession(true, "alert_scheduler_lease")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	rawSql := "UPDATE alert_scheduler_lease SET expires=? WHERE id=? AND owner=?"
+	if _, err := sess.Exec(rawSql, time.Unix(0, 0), id, owner); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+// GetAlertSchedulerLease returns the lease with the given id, or nil if it
+// has never been acquired.
+func GetAlertSchedulerLease(id string) (*m.AlertSchedulerLease, error) {
+	sess, err := newSession(false, "alert_scheduler_lease")
+	if err != nil {
+		return nil, err
+	}
+	lease := new(m.AlertSchedulerLease)
+	exists, err := sess.Where("id=?", id).Get(lease)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return lease, nil
+}
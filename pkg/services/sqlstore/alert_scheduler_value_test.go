@@ -0,0 +1,81 @@
+package sqlstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAlertSchedulerLease(t *testing.T) {
+	InitTestDB(t)
+	now := time.Now().Truncate(time.Second)
+	ttl := 30 * time.Second
+
+	Convey("When acquiring the scheduler lease", t, func() {
+		// the lease may be held by "b" from a previous run of this block.
+		So(ReleaseAlertSchedulerLease("scheduler", "b"), ShouldBeNil)
+		acquired, err := AcquireAlertSchedulerLease("scheduler", "a", now, ttl)
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeTrue)
+
+		lease, err := GetAlertSchedulerLease("scheduler")
+		So(err, ShouldBeNil)
+		So(lease.Owner, ShouldEqual, "a")
+		So(lease.Expires.Unix(), ShouldEqual, now.Add(ttl).Unix())
+
+		Convey("another owner should not acquire it before it expires", func() {
+			acquired, err := AcquireAlertSchedulerLease("scheduler", "b", now.Add(10*time.Second), ttl)
+			So(err, ShouldBeNil)
+			So(acquired, ShouldBeFalse)
+		})
+		Convey("the owner should be able to renew it", func() {
+			acquired, err := AcquireAlertSchedulerLease("scheduler", "a", now.Add(10*time.Second), ttl)
+			So(err, ShouldBeNil)
+			So(acquired, ShouldBeTrue)
+			lease, err := GetAlertSchedulerLease("scheduler")
+			So(err, ShouldBeNil)
+			So(lease.Expires.Unix(), ShouldEqual, now.Add(10*time.Second+ttl).Unix())
+		})
+		Convey("another owner should acquire it once it has expired", func() {
+			acquired, err := AcquireAlertSchedulerLease("scheduler", "b", now.Add(ttl+time.Second), ttl)
+			So(err, ShouldBeNil)
+			So(acquired, ShouldBeTrue)
+			lease, err := GetAlertSchedulerLease("scheduler")
+			So(err, ShouldBeNil)
+			So(lease.Owner, ShouldEqual, "b")
+		})
+		Convey("another owner should acquire it once it has been released", func() {
+			So(ReleaseAlertSchedulerLease("scheduler", "b"), ShouldBeNil)
+			acquired, err := AcquireAlertSchedulerLease("scheduler", "b", now, ttl)
+			So(err, ShouldBeNil)
+			So(acquired, ShouldBeFalse)
+
+			So(ReleaseAlertSchedulerLease("scheduler", "a"), ShouldBeNil)
+			acquired, err = AcquireAlertSchedulerLease("scheduler", "b", now, ttl)
+			So(err, ShouldBeNil)
+			So(acquired, ShouldBeTrue)
+		})
+	})
+}
+
+func TestUniqueConstraintError(t *testing.T) {
+	InitTestDB(t)
+
+	Convey("When inserting a lease that already exists", t, func() {
+		lease := &m.AlertSchedulerLease{Id: "duplicate", Owner: "a", Expires: time.Now()}
+		_, err := x.Table("alert_scheduler_lease").Insert(lease)
+		So(err, ShouldBeNil)
+		_, err = x.Table("alert_scheduler_lease").Insert(lease)
+		So(err, ShouldNotBeNil)
+		So(isUniqueConstraintError(err), ShouldBeTrue)
+	})
+	Convey("Other errors should not be unique constraint errors", t, func() {
+		So(isUniqueConstraintError(errors.New("connection refused")), ShouldBeFalse)
+		_, err := x.Exec("INSERT INTO no_such_table (id) VALUES (1)")
+		So(err, ShouldNotBeNil)
+		So(isUniqueConstraintError(err), ShouldBeFalse)
+	})
+}
@@ -442,6 +442,10 @@ func addCheck(sess *session, c *m.Check) error {
 		return err
 	}
 
+	if err := addCheckNotifiers(sess, c); err != nil {
+		return err
+	}
+
 	return addCheckRoutes(sess, c)
 }
 
@@ -501,14 +505,30 @@ func updateCheck(sess *session, c *m.Check) error {
 	c.Offset = c.EndpointId % c.Frequency
 	sess.Table("check")
 	sess.UseBool("enabled")
+	// the ack is only changed by AckCheck and state changes.
+	c.Ack = existing.Ack
 	if !c.Enabled && existing.Enabled {
 		c.StateChange = time.Now()
 		c.State = -1
+		c.Ack = nil
 	}
-	_, err = sess.Id(c.Id).Update(c)
+	_, err = sess.Id(c.Id).Omit("ack").Update(c)
 	if err != nil {
 		return err
 	}
+	if c.Ack == nil && existing.Ack != nil {
+		if _, err := sess.Exec("UPDATE `check` SET ack=NULL WHERE id=?", c.Id); err != nil {
+			return err
+		}
+	}
+
+	// re-index the notifiers referenced by the check.
+	if err := deleteCheckNotifiers(sess, c); err != nil {
+		return err
+	}
+	if err := addCheckNotifiers(sess, c); err != nil {
+		return err
+	}
 
 	// handle task routes.
 	if existing.Route.Type != c.Route.Type {
@@ -639,6 +659,14 @@ func deleteCheck(sess *session, c *m.Check) error {
 		return err
 	}
 
+	if err := deleteCheckNotifiers(sess, c); err != nil {
+		return err
+	}
+
+	if err := deleteCheckStateHistory(sess, c.Id); err != nil {
+		return err
+	}
+
 	return deleteCheckRoutes(sess, c)
 }
 
@@ -776,7 +804,8 @@ func BatchUpdateCheckState(jobs []*m.AlertingJob) ([]*m.AlertingJob, error) {
 }
 
 func batchUpdateCheckState(sess *session, jobs []*m.AlertingJob) ([]*m.AlertingJob, error) {
-	stateSql := "UPDATE `check` SET state=?, state_change=? WHERE id=? AND state != ? AND state_change < ?"
+	// acknowledgements only apply to the state they were made in.
+	stateSql := "UPDATE `check` SET state=?, state_change=?, ack=NULL WHERE id=? AND state != ? AND state_change < ?"
 	lastCheckSql := "UPDATE `check` SET state_check=? WHERE id=?"
 	jobsWithStateChange := make([]*m.AlertingJob, 0)
 	for _, j := range jobs {
@@ -789,6 +818,9 @@ func batchUpdateCheckState(sess *session, jobs []*m.AlertingJob) ([]*m.AlertingJ
 		if aff > 0 {
 			// state change.
 			jobsWithStateChange = append(jobsWithStateChange, j)
+			if err := addCheckStateChange(sess, j); err != nil {
+				return nil, err
+			}
 		}
 
 		res, err = sess.Exec(lastCheckSql, j.TimeExec, j.Id)
@@ -800,6 +832,56 @@ func batchUpdateCheckState(sess *session, jobs []*m.AlertingJob) ([]*m.AlertingJ
 	return jobsWithStateChange, nil
 }
 
+func GetCheckFlapState(checkId int64) (*m.CheckFlapState, error) {
+	sess, err := newSession(false, "check")
+	if err != nil {
+		return nil, err
+	}
+	return getCheckFlapState(sess, checkId)
+}
+
+func getCheckFlapState(sess *session, checkId int64) (*m.CheckFlapState, error) {
+	type flapStateRow struct {
+		FlapState string
+	}
+	row := flapStateRow{}
+	state := &m.CheckFlapState{Transitions: make([]int64, 0)}
+	has, err := sess.Sql("SELECT flap_state FROM `check` WHERE id=?", checkId).Get(&row)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, m.NewNotFoundError("check not found")
+	}
+	if row.FlapState == "" {
+		return state, nil
+	}
+	err = json.Unmarshal([]byte(row.FlapState), state)
+	return state, err
+}
+
+func UpdateCheckFlapState(checkId int64, state *m.CheckFlapState) error {
+	sess, err := newSession(true, "check")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+	if err = updateCheckFlapState(sess, checkId, state); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func updateCheckFlapState(sess *session, checkId int64, state *m.CheckFlapState) error {
+	body, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = sess.Exec("UPDATE `check` SET flap_state=? WHERE id=?", string(body), checkId)
+	return err
+}
+
 func GetChecksForAlerts(ts int64) ([]m.CheckForAlertDTO, error) {
 	sess, err := newSession(false, "check")
 	if err != nil {
@@ -834,6 +916,72 @@ func getChecksForAlerts(sess *session, ts int64) ([]m.CheckForAlertDTO, error) {
 	return checks, err
 }
 
+// GetChecksForEscalation returns all enabled checks that are critical and
+// have not been acknowledged.
+func GetChecksForEscalation() ([]m.CheckForEscalationDTO, error) {
+	sess, err := newSession(false, "check")
+	if err != nil {
+		return nil, err
+	}
+	return getChecksForEscalation(sess)
+}
+
+func getChecksForEscalation(sess *session) ([]m.CheckForEscalationDTO, error) {
+	sess.Join("INNER", "endpoint", "`check`.endpoint_id=endpoint.id")
+	sess.Where("`check`.enabled=1 AND `check`.state=? AND `check`.ack IS NULL", int(m.EvalResultCrit))
+	sess.Cols(
+		"`check`.id",
+		"`check`.org_id",
+		"`check`.endpoint_id",
+		"endpoint.slug",
+		"endpoint.name",
+		"`check`.type",
+		"`check`.offset",
+		"`check`.frequency",
+		"`check`.enabled",
+		"`check`.state",
+		"`check`.state_change",
+		"`check`.state_check",
+		"`check`.settings",
+		"`check`.health_settings",
+		"`check`.created",
+		"`check`.updated",
+		"`check`.escalated",
+	)
+	checks := make([]m.CheckForEscalationDTO, 0)
+	err := sess.Find(&checks)
+	return checks, err
+}
+
+// MarkCheckEscalated records that the escalation policy of the check notified
+// at ts.  To ensure only one instance sends each escalation, the update only
+// succeeds if the check is still critical, not acknowledged, and was last
+// escalated before prev.  It returns false if the update did not happen.
+func MarkCheckEscalated(checkId int64, prev, ts time.Time) (bool, error) {
+	sess, err := newSession(true, "check")
+	if err != nil {
+		return false, err
+	}
+	defer sess.Cleanup()
+
+	updated, err := markCheckEscalated(sess, checkId, prev, ts)
+	if err != nil {
+		return false, err
+	}
+	sess.Complete()
+	return updated, nil
+}
+
+func markCheckEscalated(sess *session, checkId int64, prev, ts time.Time) (bool, error) {
+	rawSql := "UPDATE `check` SET escalated=? WHERE id=? AND state=? AND ack IS NULL AND (escalated IS NULL OR escalated < ?)"
+	res, err := sess.Exec(rawSql, ts, checkId, int(m.EvalResultCrit), prev)
+	if err != nil {
+		return false, err
+	}
+	aff, _ := res.RowsAffected()
+	return aff > 0, nil
+}
+
 func ValidateCheckRoute(check *m.Check) error {
 	sess, err := newSession(false, "check")
 	if err != nil {
@@ -876,3 +1024,64 @@ func validateCheckRoute(sess *session, check *m.Check) error {
 	}
 	return nil
 }
+
+// AckCheck acknowledges the critical state of a check.
+func AckCheck(orgId, checkId int64, ack *m.CheckAck) error {
+	sess, err := newSession(true, "check")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	if err = ackCheck(sess, orgId, checkId, ack); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func ackCheck(sess *session, orgId, checkId int64, ack *m.CheckAck) error {
+	check, err := getCheckById(sess, orgId, checkId)
+	if err != nil {
+		return err
+	}
+	if check.State != m.EvalResultCrit {
+		return m.ErrCheckNotCritical
+	}
+	body, err := json.Marshal(ack)
+	if err != nil {
+		return err
+	}
+	res, err := sess.Exec("UPDATE `check` SET ack=? WHERE id=? AND state=?", string(body), checkId, int(m.EvalResultCrit))
+	if err != nil {
+		return err
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		// the state changed since we read it.
+		return m.ErrCheckNotCritical
+	}
+	return nil
+}
+
+// UnackCheck removes the acknowledgement of a check.
+func UnackCheck(orgId, checkId int64) error {
+	sess, err := newSession(true, "check")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	if err = unackCheck(sess, orgId, checkId); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func unackCheck(sess *session, orgId, checkId int64) error {
+	if _, err := getCheckById(sess, orgId, checkId); err != nil {
+		return err
+	}
+	_, err := sess.Exec("UPDATE `check` SET ack=NULL WHERE id=?", checkId)
+	return err
+}
@@ -51,6 +51,41 @@ func populateProbes(t *testing.T) {
 	}
 }
 
+// testEndpoint returns an endpoint with a single ping check, routed to the
+// first probe, that notifies the given org level notifiers.
+func testEndpoint(name string, notifiers ...int64) *m.EndpointDTO {
+	return &m.EndpointDTO{
+		Name:  name,
+		OrgId: 1,
+		Tags:  []string{},
+		Checks: []m.Check{
+			{
+				Route: &m.CheckRoute{
+					Type: m.RouteByIds,
+					Config: map[string]interface{}{
+						"ids": []int64{1},
+					},
+				},
+				Frequency: 60,
+				Type:      m.PING_CHECK,
+				Enabled:   true,
+				Settings: map[string]interface{}{
+					"hostname": name,
+					"timeout":  5,
+				},
+				HealthSettings: &m.CheckHealthSettings{
+					NumProbes: 1,
+					Steps:     3,
+					Notifications: m.CheckNotificationSetting{
+						Enabled:   true,
+						Notifiers: notifiers,
+					},
+				},
+			},
+		},
+	}
+}
+
 func TestEndpoints(t *testing.T) {
 	InitTestDB(t)
 	populateProbes(t)
@@ -241,3 +276,203 @@ func TestEndpoints(t *testing.T) {
 		So(len(checks), ShouldEqual, (endpointCount*2)-2)
 	})
 }
+
+func TestBatchUpdateCheckState(t *testing.T) {
+	InitTestDB(t)
+	populateProbes(t)
+	e := testEndpoint("state.example.com")
+	if err := AddEndpoint(e); err != nil {
+		t.Fatal(err)
+	}
+	checkId := e.Checks[0].Id
+	ts := time.Now()
+
+	updateState := func(state m.CheckEvalResult) []*m.AlertingJob {
+		ts = ts.Add(time.Minute)
+		job := &m.AlertingJob{
+			CheckForAlertDTO: &m.CheckForAlertDTO{Id: checkId, OrgId: 1},
+			NewState:         state,
+			TimeExec:         ts,
+		}
+		changes, err := BatchUpdateCheckState([]*m.AlertingJob{job})
+		So(err, ShouldBeNil)
+		return changes
+	}
+
+	Convey("When check states are updated", t, func() {
+		So(updateState(m.EvalResultOK), ShouldHaveLength, 1)
+		So(updateState(m.EvalResultOK), ShouldHaveLength, 0)
+		Convey("warning state should be a state change", func() {
+			So(updateState(m.EvalResultWarn), ShouldHaveLength, 1)
+			So(updateState(m.EvalResultWarn), ShouldHaveLength, 0)
+			check, err := GetCheckById(1, checkId)
+			So(err, ShouldBeNil)
+			So(check.State, ShouldEqual, m.EvalResultWarn)
+			So(check.StateChange.Unix(), ShouldEqual, ts.Add(-time.Minute).Unix())
+			Convey("moving between warning and critical should be a state change", func() {
+				So(updateState(m.EvalResultCrit), ShouldHaveLength, 1)
+				So(updateState(m.EvalResultWarn), ShouldHaveLength, 1)
+			})
+		})
+	})
+}
+
+func TestCheckFlapState(t *testing.T) {
+	InitTestDB(t)
+	populateProbes(t)
+	e := testEndpoint("flap.example.com")
+	if err := AddEndpoint(e); err != nil {
+		t.Fatal(err)
+	}
+	checkId := e.Checks[0].Id
+
+	Convey("When getting flap state of new check", t, func() {
+		state, err := GetCheckFlapState(checkId)
+		So(err, ShouldBeNil)
+		So(state.Flapping, ShouldBeFalse)
+		So(state.Transitions, ShouldHaveLength, 0)
+	})
+	Convey("When updating flap state", t, func() {
+		err := UpdateCheckFlapState(checkId, &m.CheckFlapState{Flapping: true, Transitions: []int64{1, 2, 3}})
+		So(err, ShouldBeNil)
+		state, err := GetCheckFlapState(checkId)
+		So(err, ShouldBeNil)
+		So(state.Flapping, ShouldBeTrue)
+		So(state.Transitions, ShouldResemble, []int64{1, 2, 3})
+	})
+	Convey("When getting flap state of unknown check", t, func() {
+		_, err := GetCheckFlapState(checkId + 100)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCheckEscalation(t *testing.T) {
+	InitTestDB(t)
+	populateProbes(t)
+	e := testEndpoint("escalation.example.com")
+	e.Checks[0].HealthSettings.Notifications.Escalation = &m.CheckEscalationPolicy{After: 10, Addresses: "oncall@example.com"}
+	if err := AddEndpoint(e); err != nil {
+		t.Fatal(err)
+	}
+	checkId := e.Checks[0].Id
+	critSince := time.Now().Add(time.Minute).Truncate(time.Second)
+
+	Convey("When a check is not critical", t, func() {
+		checks, err := GetChecksForEscalation()
+		So(err, ShouldBeNil)
+		So(checks, ShouldHaveLength, 0)
+	})
+
+	job := &m.AlertingJob{
+		CheckForAlertDTO: &m.CheckForAlertDTO{Id: checkId, OrgId: 1},
+		NewState:         m.EvalResultCrit,
+		TimeExec:         critSince,
+	}
+	if _, err := BatchUpdateCheckState([]*m.AlertingJob{job}); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("When a check is critical", t, func() {
+		checks, err := GetChecksForEscalation()
+		So(err, ShouldBeNil)
+		So(checks, ShouldHaveLength, 1)
+		So(checks[0].Id, ShouldEqual, checkId)
+		So(checks[0].Slug, ShouldEqual, "escalation_example_com")
+		So(checks[0].StateChange.Unix(), ShouldEqual, critSince.Unix())
+		So(checks[0].Escalated.IsZero(), ShouldBeTrue)
+		So(checks[0].HealthSettings.Notifications.Escalation.After, ShouldEqual, 10)
+
+		Convey("the escalation should only be claimed once", func() {
+			ts := critSince.Add(10 * time.Minute)
+			ok, err := MarkCheckEscalated(checkId, critSince, ts)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			ok, err = MarkCheckEscalated(checkId, critSince, ts)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+
+			checks, err := GetChecksForEscalation()
+			So(err, ShouldBeNil)
+			So(checks[0].Escalated.Unix(), ShouldEqual, ts.Unix())
+		})
+	})
+}
+
+func TestAckCheck(t *testing.T) {
+	InitTestDB(t)
+	populateProbes(t)
+	e := testEndpoint("ack.example.com")
+	e.Checks[0].HealthSettings.Notifications.Escalation = &m.CheckEscalationPolicy{After: 10, Addresses: "oncall@example.com"}
+	if err := AddEndpoint(e); err != nil {
+		t.Fatal(err)
+	}
+	checkId := e.Checks[0].Id
+	ts := time.Now().Add(time.Minute).Truncate(time.Second)
+	setState := func(state m.CheckEvalResult) {
+		ts = ts.Add(time.Minute)
+		job := &m.AlertingJob{
+			CheckForAlertDTO: &m.CheckForAlertDTO{Id: checkId, OrgId: 1},
+			NewState:         state,
+			TimeExec:         ts,
+		}
+		_, err := BatchUpdateCheckState([]*m.AlertingJob{job})
+		So(err, ShouldBeNil)
+	}
+	getAck := func() *m.CheckAck {
+		endpoint, err := GetEndpointById(1, e.Id)
+		So(err, ShouldBeNil)
+		return endpoint.Checks[0].Ack
+	}
+
+	Convey("When acknowledging a check that is not critical", t, func() {
+		setState(m.EvalResultOK)
+		err := AckCheck(1, checkId, &m.CheckAck{User: "bob", Time: time.Now()})
+		So(err, ShouldResemble, m.ErrCheckNotCritical)
+	})
+
+	Convey("When acknowledging a critical check", t, func() {
+		setState(m.EvalResultCrit)
+		err := AckCheck(1, checkId, &m.CheckAck{User: "bob", Time: time.Now(), Comment: "looking into it"})
+		So(err, ShouldBeNil)
+
+		ack := getAck()
+		So(ack, ShouldNotBeNil)
+		So(ack.User, ShouldEqual, "bob")
+		So(ack.Comment, ShouldEqual, "looking into it")
+
+		Convey("the check should not be escalated", func() {
+			checks, err := GetChecksForEscalation()
+			So(err, ShouldBeNil)
+			So(checks, ShouldHaveLength, 0)
+			ok, err := MarkCheckEscalated(checkId, ts, ts.Add(time.Hour))
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+		Convey("updating the endpoint should keep the ack", func() {
+			endpoint, err := GetEndpointById(1, e.Id)
+			So(err, ShouldBeNil)
+			endpoint.Checks[0].Ack = nil
+			err = UpdateEndpoint(endpoint)
+			So(err, ShouldBeNil)
+			So(getAck(), ShouldNotBeNil)
+		})
+		Convey("a state change should clear the ack", func() {
+			setState(m.EvalResultOK)
+			So(getAck(), ShouldBeNil)
+		})
+		Convey("unacknowledging should clear the ack", func() {
+			err := UnackCheck(1, checkId)
+			So(err, ShouldBeNil)
+			So(getAck(), ShouldBeNil)
+			checks, err := GetChecksForEscalation()
+			So(err, ShouldBeNil)
+			So(checks, ShouldHaveLength, 1)
+		})
+		Convey("other orgs should not be able to acknowledge it", func() {
+			err := AckCheck(2, checkId, &m.CheckAck{User: "eve", Time: time.Now()})
+			So(err, ShouldNotBeNil)
+			err = UnackCheck(2, checkId)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
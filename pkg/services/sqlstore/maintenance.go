@@ -0,0 +1,196 @@
+package sqlstore
+
+import (
+	"fmt"
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+)
+
+func GetMaintenanceWindows(query *m.GetMaintenanceWindowsQuery) ([]m.MaintenanceWindow, error) {
+	sess, err := newSession(false, "maintenance_window")
+	if err != nil {
+		return nil, err
+	}
+	return getMaintenanceWindows(sess, query)
+}
+
+func getMaintenanceWindows(sess *session, query *m.GetMaintenanceWindowsQuery) ([]m.MaintenanceWindow, error) {
+	if query.OrgId == 0 {
+		return nil, fmt.Errorf("GetMaintenanceWindowsQuery requires OrgId to be set.")
+	}
+	windows := make([]m.MaintenanceWindow, 0)
+	sess.Where("org_id=?", query.OrgId)
+	if query.OrderBy == "" {
+		query.OrderBy = "start_time"
+	}
+	sess.Asc(query.OrderBy)
+	if err := sess.Find(&windows); err != nil {
+		return nil, err
+	}
+	if query.EndpointId == 0 && !query.Active {
+		return windows, nil
+	}
+
+	var tags []string
+	if query.EndpointId != 0 {
+		var err error
+		tags, err = getEndpointTagsById(sess, query.EndpointId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	filtered := make([]m.MaintenanceWindow, 0)
+	for _, w := range windows {
+		if query.EndpointId != 0 && !w.Matches(query.EndpointId, tags) {
+			continue
+		}
+		if query.Active && !w.Active(now) {
+			continue
+		}
+		filtered = append(filtered, w)
+	}
+	return filtered, nil
+}
+
+func GetMaintenanceWindowById(orgId, id int64) (*m.MaintenanceWindow, error) {
+	sess, err := newSession(false, "maintenance_window")
+	if err != nil {
+		return nil, err
+	}
+	return getMaintenanceWindowById(sess, orgId, id)
+}
+
+func getMaintenanceWindowById(sess *session, orgId, id int64) (*m.MaintenanceWindow, error) {
+	w := &m.MaintenanceWindow{}
+	has, err := sess.Where("org_id=? AND id=?", orgId, id).Get(w)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, m.ErrMaintenanceWindowNotFound
+	}
+	return w, nil
+}
+
+// GetActiveMaintenanceWindow returns the maintenance window that applies to
+// the endpoint at time t, or nil if the endpoint is not in maintenance.
+func GetActiveMaintenanceWindow(orgId, endpointId int64, t time.Time) (*m.MaintenanceWindow, error) {
+	sess, err := newSession(false, "maintenance_window")
+	if err != nil {
+		return nil, err
+	}
+	return getActiveMaintenanceWindow(sess, orgId, endpointId, t)
+}
+
+func getActiveMaintenanceWindow(sess *session, orgId, endpointId int64, t time.Time) (*m.MaintenanceWindow, error) {
+	windows := make([]m.MaintenanceWindow, 0)
+	sess.Where("org_id=? AND start_time <= ?", orgId, t)
+	sess.And("(recurrence != '' OR end_time > ?)", t)
+	if err := sess.Find(&windows); err != nil {
+		return nil, err
+	}
+	if len(windows) == 0 {
+		return nil, nil
+	}
+	tags, err := getEndpointTagsById(sess, endpointId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range windows {
+		if windows[i].Active(t) && windows[i].Matches(endpointId, tags) {
+			return &windows[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func getEndpointTagsById(sess *session, endpointId int64) ([]string, error) {
+	type tagRow struct {
+		Tag string
+	}
+	rows := make([]tagRow, 0)
+	if err := sess.Sql("SELECT tag FROM endpoint_tag WHERE endpoint_id=?", endpointId).Find(&rows); err != nil {
+		return nil, err
+	}
+	tags := make([]string, len(rows))
+	for i, row := range rows {
+		tags[i] = row.Tag
+	}
+	return tags, nil
+}
+
+func AddMaintenanceWindow(w *m.MaintenanceWindow) error {
+	sess, err := newSession(true, "maintenance_window")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	if err = addMaintenanceWindow(sess, w); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func addMaintenanceWindow(sess *session, w *m.MaintenanceWindow) error {
+	w.Created = time.Now()
+	w.Updated = time.Now()
+	if _, err := sess.Insert(w); err != nil {
+		return err
+	}
+	return nil
+}
+
+func UpdateMaintenanceWindow(w *m.MaintenanceWindow) error {
+	sess, err := newSession(true, "maintenance_window")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	if err = updateMaintenanceWindow(sess, w); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func updateMaintenanceWindow(sess *session, w *m.MaintenanceWindow) error {
+	existing, err := getMaintenanceWindowById(sess, w.OrgId, w.Id)
+	if err != nil {
+		return err
+	}
+	w.Created = existing.Created
+	w.Updated = time.Now()
+	sess.Table("maintenance_window")
+	if _, err := sess.Id(w.Id).AllCols().Update(w); err != nil {
+		return err
+	}
+	return nil
+}
+
+func DeleteMaintenanceWindow(orgId, id int64) error {
+	sess, err := newSession(true, "maintenance_window")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	if err = deleteMaintenanceWindow(sess, orgId, id); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func deleteMaintenanceWindow(sess *session, orgId, id int64) error {
+	if _, err := getMaintenanceWindowById(sess, orgId, id); err != nil {
+		return err
+	}
+	rawSql := "DELETE FROM maintenance_window WHERE id=? and org_id=?"
+	_, err := sess.Exec(rawSql, id, orgId)
+	return err
+}
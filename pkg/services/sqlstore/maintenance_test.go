@@ -0,0 +1,107 @@
+package sqlstore
+
+import (
+	"testing"
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	InitTestDB(t)
+	populateProbes(t)
+	e := testEndpoint("maintenance.example.com")
+	e.Tags = []string{"db", "prod"}
+	if err := AddEndpoint(e); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+
+	Convey("When adding maintenance window", t, func() {
+		w := &m.MaintenanceWindow{
+			OrgId:       1,
+			Name:        "db upgrade",
+			EndpointIds: []int64{e.Id},
+			Start:       now.Add(-time.Hour),
+			End:         now.Add(time.Hour),
+		}
+		So(w.Validate(), ShouldBeNil)
+		err := AddMaintenanceWindow(w)
+		So(err, ShouldBeNil)
+		So(w.Id, ShouldNotEqual, 0)
+
+		Convey("it should be returned by GetMaintenanceWindowById", func() {
+			window, err := GetMaintenanceWindowById(1, w.Id)
+			So(err, ShouldBeNil)
+			So(window.Name, ShouldEqual, "db upgrade")
+			So(window.EndpointIds, ShouldResemble, []int64{e.Id})
+			So(window.Start.Unix(), ShouldEqual, w.Start.Unix())
+			So(window.End.Unix(), ShouldEqual, w.End.Unix())
+		})
+		Convey("it should be the active window for the endpoint", func() {
+			window, err := GetActiveMaintenanceWindow(1, e.Id, now)
+			So(err, ShouldBeNil)
+			So(window, ShouldNotBeNil)
+			So(window.Id, ShouldEqual, w.Id)
+
+			window, err = GetActiveMaintenanceWindow(1, e.Id, now.Add(2*time.Hour))
+			So(err, ShouldBeNil)
+			So(window, ShouldBeNil)
+
+			window, err = GetActiveMaintenanceWindow(1, e.Id+100, now)
+			So(err, ShouldBeNil)
+			So(window, ShouldBeNil)
+		})
+		Convey("it should be updatable", func() {
+			w.EndpointIds = []int64{}
+			w.EndpointTags = []string{"prod"}
+			w.Start = now.Add(-25 * time.Hour)
+			w.End = now.Add(-23 * time.Hour)
+			w.Recurrence = m.RecurrenceDaily
+			So(w.Validate(), ShouldBeNil)
+			err := UpdateMaintenanceWindow(w)
+			So(err, ShouldBeNil)
+
+			Convey("recurring window matched by tag should be active", func() {
+				window, err := GetActiveMaintenanceWindow(1, e.Id, now)
+				So(err, ShouldBeNil)
+				So(window, ShouldNotBeNil)
+				So(window.Recurrence, ShouldEqual, m.RecurrenceDaily)
+
+				window, err = GetActiveMaintenanceWindow(1, e.Id, now.Add(2*time.Hour))
+				So(err, ShouldBeNil)
+				So(window, ShouldBeNil)
+			})
+			Convey("it should be listed when filtering by endpoint", func() {
+				windows, err := GetMaintenanceWindows(&m.GetMaintenanceWindowsQuery{OrgId: 1, EndpointId: e.Id, Active: true})
+				So(err, ShouldBeNil)
+				So(windows, ShouldHaveLength, 1)
+			})
+		})
+		Convey("it should be deletable", func() {
+			err := DeleteMaintenanceWindow(1, w.Id)
+			So(err, ShouldBeNil)
+			_, err = GetMaintenanceWindowById(1, w.Id)
+			So(err, ShouldResemble, m.ErrMaintenanceWindowNotFound)
+		})
+		Convey("it should not be visible to other orgs", func() {
+			_, err := GetMaintenanceWindowById(2, w.Id)
+			So(err, ShouldResemble, m.ErrMaintenanceWindowNotFound)
+		})
+		DeleteMaintenanceWindow(1, w.Id)
+	})
+
+	Convey("When validating maintenance windows", t, func() {
+		invalid := []m.MaintenanceWindow{
+			{Name: "", EndpointIds: []int64{1}, Start: now, End: now.Add(time.Hour)},
+			{Name: "no endpoints", Start: now, End: now.Add(time.Hour)},
+			{Name: "ends first", EndpointIds: []int64{1}, Start: now, End: now.Add(-time.Hour)},
+			{Name: "too long", EndpointIds: []int64{1}, Start: now, End: now.Add(25 * time.Hour), Recurrence: m.RecurrenceDaily},
+			{Name: "bad recurrence", EndpointIds: []int64{1}, Start: now, End: now.Add(time.Hour), Recurrence: "hourly"},
+		}
+		for _, w := range invalid {
+			So(w.Validate(), ShouldNotBeNil)
+		}
+	})
+}
@@ -13,4 +13,13 @@ func addAlertSchedulerValueMigration(mg *Migrator) {
 	}
 	mg.AddMigration("create alert_scheduler_value table v1", NewAddTableMigration(alertSchedV1))
 
+	var alertSchedLeaseV1 = Table{
+		Name: "alert_scheduler_lease",
+		Columns: []*Column{
+			{Name: "id", Type: DB_Varchar, Length: 255, IsPrimaryKey: true},
+			{Name: "owner", Type: DB_Varchar, Length: 255, Nullable: false},
+			{Name: "expires", Type: DB_DateTime, Nullable: false},
+		},
+	}
+	mg.AddMigration("create alert_scheduler_lease table v1", NewAddTableMigration(alertSchedLeaseV1))
 }
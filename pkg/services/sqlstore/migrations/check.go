@@ -439,4 +439,19 @@ func addCheckMigration(mg *Migrator) {
 	}
 
 	mg.AddMigration("Drop old table monitor_collector_tag", NewDropTableMigration("monitor_collector_tag"))
+
+	// add flap detection state
+	mg.AddMigration("check add flap_state v1", NewAddColumnMigration(checkV1, &Column{
+		Name: "flap_state", Type: DB_Text, Nullable: true,
+	}))
+
+	// add time of last escalation
+	mg.AddMigration("check add escalated v1", NewAddColumnMigration(checkV1, &Column{
+		Name: "escalated", Type: DB_DateTime, Nullable: true,
+	}))
+
+	// add acknowledgement of critical state
+	mg.AddMigration("check add ack v1", NewAddColumnMigration(checkV1, &Column{
+		Name: "ack", Type: DB_Text, Nullable: true,
+	}))
 }
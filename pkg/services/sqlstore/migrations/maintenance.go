@@ -0,0 +1,31 @@
+package migrations
+
+import . "github.com/raintank/worldping-api/pkg/services/sqlstore/migrator"
+
+func addMaintenanceWindowMigration(mg *Migrator) {
+
+	var maintenanceWindowV1 = Table{
+		Name: "maintenance_window",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "name", Type: DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "endpoint_ids", Type: DB_Text, Nullable: true},
+			{Name: "endpoint_tags", Type: DB_Text, Nullable: true},
+			{Name: "start_time", Type: DB_DateTime, Nullable: false},
+			{Name: "end_time", Type: DB_DateTime, Nullable: false},
+			{Name: "recurrence", Type: DB_NVarchar, Length: 16, Nullable: false},
+			{Name: "notify", Type: DB_Bool, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"org_id", "name"}, Type: UniqueIndex},
+			{Cols: []string{"org_id", "start_time"}},
+		},
+	}
+	mg.AddMigration("create maintenance_window table v1", NewAddTableMigration(maintenanceWindowV1))
+
+	//-------  indexes ------------------
+	addTableIndicesMigrations(mg, "v1", maintenanceWindowV1)
+}
@@ -14,6 +14,9 @@ func AddMigrations(mg *Migrator) {
 	addEndpointMigration(mg)
 	addAlertSchedulerValueMigration(mg)
 	addQuotaMigration(mg)
+	addNotifierMigration(mg)
+	addMaintenanceWindowMigration(mg)
+	addCheckStateHistoryMigration(mg)
 }
 
 func addMigrationLogMigrations(mg *Migrator) {
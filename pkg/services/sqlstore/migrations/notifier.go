@@ -0,0 +1,45 @@
+package migrations
+
+import . "github.com/raintank/worldping-api/pkg/services/sqlstore/migrator"
+
+func addNotifierMigration(mg *Migrator) {
+
+	var notifierV1 = Table{
+		Name: "notifier",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "name", Type: DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "type", Type: DB_NVarchar, Length: 32, Nullable: false},
+			{Name: "settings", Type: DB_Text, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"org_id", "name"}, Type: UniqueIndex},
+		},
+	}
+	mg.AddMigration("create notifier table v1", NewAddTableMigration(notifierV1))
+
+	//-------  indexes ------------------
+	addTableIndicesMigrations(mg, "v1", notifierV1)
+
+	var checkNotifierIndexV1 = Table{
+		Name: "check_notifier_index",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "check_id", Type: DB_BigInt, Nullable: false},
+			{Name: "notifier_id", Type: DB_BigInt, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: true},
+		},
+		Indices: []*Index{
+			{Cols: []string{"check_id", "notifier_id"}, Type: UniqueIndex},
+			{Cols: []string{"notifier_id"}},
+		},
+	}
+	mg.AddMigration("create check_notifier_index table v1", NewAddTableMigration(checkNotifierIndexV1))
+
+	//-------  indexes ------------------
+	addTableIndicesMigrations(mg, "v1", checkNotifierIndexV1)
+}
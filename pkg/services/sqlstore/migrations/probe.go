@@ -154,4 +154,34 @@ func addCollectorMigration(mg *Migrator) {
 	}
 	mg.AddMigration("Drop old table collector_session", NewDropTableMigration("collector_session"))
 
+	// add the latest health report of the probe
+	mg.AddMigration("probe_session add health v1", NewAddColumnMigration(probeSessionV1, &Column{
+		Name: "health", Type: DB_Text, Nullable: true,
+	}))
+
+	// add the measured clock skew of the probe
+	mg.AddMigration("probe_session add clock_skew v1", NewAddColumnMigration(probeSessionV1, &Column{
+		Name: "clock_skew", Type: DB_Double, Nullable: false, Default: "0",
+	}))
+
+	// probe tokens
+	probeTokenV1 := Table{
+		Name: "probe_token",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "probe_id", Type: DB_BigInt, Nullable: false},
+			{Name: "hash", Type: DB_NVarchar, Length: 64, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"hash"}, Type: UniqueIndex},
+			{Cols: []string{"probe_id"}},
+		},
+	}
+	mg.AddMigration("create probe_token table v1", NewAddTableMigration(probeTokenV1))
+	for _, index := range probeTokenV1.Indices {
+		migrationId := fmt.Sprintf("create index %s - %s", index.XName(probeTokenV1.Name), "v1")
+		mg.AddMigration(migrationId, NewAddIndexMigration(probeTokenV1, index))
+	}
 }
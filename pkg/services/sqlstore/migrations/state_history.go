@@ -0,0 +1,29 @@
+package migrations
+
+import . "github.com/raintank/worldping-api/pkg/services/sqlstore/migrator"
+
+func addCheckStateHistoryMigration(mg *Migrator) {
+
+	var checkStateHistoryV1 = Table{
+		Name: "check_state_history",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "endpoint_id", Type: DB_BigInt, Nullable: false},
+			{Name: "check_id", Type: DB_BigInt, Nullable: false},
+			{Name: "check_type", Type: DB_NVarchar, Length: 16, Nullable: false},
+			{Name: "prev_state", Type: DB_Int, Nullable: false},
+			{Name: "state", Type: DB_Int, Nullable: false},
+			{Name: "ts", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"check_id", "ts"}},
+			{Cols: []string{"endpoint_id", "ts"}},
+			{Cols: []string{"org_id", "ts"}},
+		},
+	}
+	mg.AddMigration("create check_state_history table v1", NewAddTableMigration(checkStateHistoryV1))
+
+	//-------  indexes ------------------
+	addTableIndicesMigrations(mg, "v1", checkStateHistoryV1)
+}
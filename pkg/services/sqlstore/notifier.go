@@ -0,0 +1,197 @@
+package sqlstore
+
+import (
+	"fmt"
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+)
+
+func GetNotifiers(query *m.GetNotifiersQuery) ([]m.Notifier, error) {
+	sess, err := newSession(false, "notifier")
+	if err != nil {
+		return nil, err
+	}
+	return getNotifiers(sess, query)
+}
+
+func getNotifiers(sess *session, query *m.GetNotifiersQuery) ([]m.Notifier, error) {
+	if query.OrgId == 0 {
+		return nil, fmt.Errorf("GetNotifiersQuery requires OrgId to be set.")
+	}
+	notifiers := make([]m.Notifier, 0)
+	sess.Where("org_id=?", query.OrgId)
+	if query.Name != "" {
+		sess.And("name like ?", query.Name)
+	}
+	if query.Type != "" {
+		sess.And("type=?", query.Type)
+	}
+	if query.OrderBy == "" {
+		query.OrderBy = "name"
+	}
+	sess.Asc(query.OrderBy)
+	err := sess.Find(&notifiers)
+	return notifiers, err
+}
+
+func GetNotifierById(orgId, id int64) (*m.Notifier, error) {
+	sess, err := newSession(false, "notifier")
+	if err != nil {
+		return nil, err
+	}
+	return getNotifierById(sess, orgId, id)
+}
+
+func getNotifierById(sess *session, orgId, id int64) (*m.Notifier, error) {
+	notifier := &m.Notifier{}
+	has, err := sess.Where("org_id=? AND id=?", orgId, id).Get(notifier)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, m.ErrNotifierNotFound
+	}
+	return notifier, nil
+}
+
+func GetNotifiersByIds(orgId int64, ids []int64) ([]m.Notifier, error) {
+	sess, err := newSession(false, "notifier")
+	if err != nil {
+		return nil, err
+	}
+	return getNotifiersByIds(sess, orgId, ids)
+}
+
+func getNotifiersByIds(sess *session, orgId int64, ids []int64) ([]m.Notifier, error) {
+	notifiers := make([]m.Notifier, 0)
+	if len(ids) == 0 {
+		return notifiers, nil
+	}
+	err := sess.Where("org_id=?", orgId).In("id", ids).Find(&notifiers)
+	return notifiers, err
+}
+
+func AddNotifier(n *m.Notifier) error {
+	sess, err := newSession(true, "notifier")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	if err = addNotifier(sess, n); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func addNotifier(sess *session, n *m.Notifier) error {
+	n.Created = time.Now()
+	n.Updated = time.Now()
+	if _, err := sess.Insert(n); err != nil {
+		return err
+	}
+	return nil
+}
+
+func UpdateNotifier(n *m.Notifier) error {
+	sess, err := newSession(true, "notifier")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	if err = updateNotifier(sess, n); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func updateNotifier(sess *session, n *m.Notifier) error {
+	existing, err := getNotifierById(sess, n.OrgId, n.Id)
+	if err != nil {
+		return err
+	}
+	n.Created = existing.Created
+	n.Updated = time.Now()
+	sess.Table("notifier")
+	if _, err := sess.Id(n.Id).AllCols().Update(n); err != nil {
+		return err
+	}
+	return nil
+}
+
+func DeleteNotifier(orgId, id int64) error {
+	sess, err := newSession(true, "notifier")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	if err = deleteNotifier(sess, orgId, id); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func deleteNotifier(sess *session, orgId, id int64) error {
+	if _, err := getNotifierById(sess, orgId, id); err != nil {
+		return err
+	}
+	sess.Table("check_notifier_index")
+	inUse, err := sess.Where("notifier_id=?", id).Count(&m.CheckNotifierIndex{})
+	if err != nil {
+		return err
+	}
+	if inUse > 0 {
+		return m.ErrNotifierInUse
+	}
+
+	rawSql := "DELETE FROM notifier WHERE id=? and org_id=?"
+	_, err = sess.Exec(rawSql, id, orgId)
+	return err
+}
+
+func addCheckNotifiers(sess *session, c *m.Check) error {
+	if c.HealthSettings == nil || len(c.HealthSettings.Notifications.NotifierIds()) == 0 {
+		return nil
+	}
+	// only index each notifier once, and only if it belongs to the check's org.
+	ids := make(map[int64]struct{})
+	for _, id := range c.HealthSettings.Notifications.NotifierIds() {
+		ids[id] = struct{}{}
+	}
+	notifierIds := make([]int64, 0, len(ids))
+	for id := range ids {
+		notifierIds = append(notifierIds, id)
+	}
+	sess.Table("notifier")
+	notifiers, err := getNotifiersByIds(sess, c.OrgId, notifierIds)
+	if err != nil {
+		return err
+	}
+	if len(notifiers) != len(notifierIds) {
+		return m.NewValidationError("Invalid notifier id defined in health settings.")
+	}
+
+	idxs := make([]m.CheckNotifierIndex, len(notifierIds))
+	for i, id := range notifierIds {
+		idxs[i] = m.CheckNotifierIndex{
+			OrgId:      c.OrgId,
+			CheckId:    c.Id,
+			NotifierId: id,
+			Created:    time.Now(),
+		}
+	}
+	sess.Table("check_notifier_index")
+	_, err = sess.Insert(&idxs)
+	return err
+}
+
+func deleteCheckNotifiers(sess *session, c *m.Check) error {
+	_, err := sess.Exec("DELETE from check_notifier_index where check_id = ?", c.Id)
+	return err
+}
@@ -0,0 +1,86 @@
+package sqlstore
+
+import (
+	"fmt"
+	"testing"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNotifiers(t *testing.T) {
+	InitTestDB(t)
+	populateProbes(t)
+	notifierCount := 0
+
+	Convey("When adding notifier", t, func() {
+		notifierCount++
+		n := &m.Notifier{
+			OrgId: 1,
+			Name:  fmt.Sprintf("ops webhook %d", notifierCount),
+			Type:  m.WebhookChannel,
+			Settings: map[string]interface{}{
+				"url": "https://example.com/hook",
+			},
+		}
+		err := AddNotifier(n)
+		So(err, ShouldBeNil)
+		So(n.Id, ShouldNotEqual, 0)
+
+		Convey("it should be returned by GetNotifierById", func() {
+			notifier, err := GetNotifierById(1, n.Id)
+			So(err, ShouldBeNil)
+			So(notifier.Name, ShouldEqual, n.Name)
+			So(notifier.Type, ShouldEqual, m.WebhookChannel)
+			So(notifier.Settings["url"], ShouldEqual, "https://example.com/hook")
+		})
+		Convey("it should not be visible to other orgs", func() {
+			_, err := GetNotifierById(2, n.Id)
+			So(err, ShouldResemble, m.ErrNotifierNotFound)
+			notifiers, err := GetNotifiers(&m.GetNotifiersQuery{OrgId: 2})
+			So(err, ShouldBeNil)
+			So(notifiers, ShouldHaveLength, 0)
+		})
+		Convey("it should be updatable", func() {
+			n.Name = fmt.Sprintf("ops slack %d", notifierCount)
+			n.Type = m.SlackChannel
+			err := UpdateNotifier(n)
+			So(err, ShouldBeNil)
+			notifiers, err := GetNotifiers(&m.GetNotifiersQuery{OrgId: 1, Type: "slack"})
+			So(err, ShouldBeNil)
+			So(notifiers, ShouldHaveLength, 1)
+			So(notifiers[0].Name, ShouldEqual, n.Name)
+		})
+		Convey("when referenced by a check", func() {
+			e := testEndpoint(fmt.Sprintf("notifier%d.example.com", notifierCount), n.Id)
+			err := AddEndpoint(e)
+			So(err, ShouldBeNil)
+
+			Convey("deleting the notifier should fail", func() {
+				err := DeleteNotifier(1, n.Id)
+				So(err, ShouldResemble, m.ErrNotifierInUse)
+			})
+			Convey("removing the reference should allow delete", func() {
+				e.Checks[0].HealthSettings.Notifications.Notifiers = []int64{}
+				err := UpdateEndpoint(e)
+				So(err, ShouldBeNil)
+				err = DeleteNotifier(1, n.Id)
+				So(err, ShouldBeNil)
+				_, err = GetNotifierById(1, n.Id)
+				So(err, ShouldResemble, m.ErrNotifierNotFound)
+			})
+			Convey("deleting the endpoint should allow delete", func() {
+				err := DeleteEndpoint(1, e.Id)
+				So(err, ShouldBeNil)
+				err = DeleteNotifier(1, n.Id)
+				So(err, ShouldBeNil)
+			})
+		})
+		Convey("check referencing an unknown notifier should be rejected", func() {
+			err := AddEndpoint(testEndpoint("invalid.example.com", n.Id+100))
+			So(err, ShouldNotBeNil)
+			_, ok := err.(m.ValidationError)
+			So(ok, ShouldBeTrue)
+		})
+	})
+}
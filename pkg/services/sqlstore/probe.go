@@ -531,6 +531,10 @@ func deleteProbe(sess *session, id int64, orgId int64) error {
 	if _, err := sess.Exec(rawSql, existing.Id); err != nil {
 		return err
 	}
+	rawSql = "DELETE FROM probe_token WHERE probe_id=?"
+	if _, err := sess.Exec(rawSql, existing.Id); err != nil {
+		return err
+	}
 	events.Publish(&events.ProbeDeleted{
 		Ts:      time.Now(),
 		Payload: existing,
@@ -599,6 +603,46 @@ func addProbeSession(sess *session, probeSess *m.ProbeSession) error {
 
 }
 
+// UpdateProbeSessionHealth stores the latest health report of a probe
+// session.  The updated time of the session is left unchanged, as it orders
+// the sessions that the checks of a probe are spread over.
+func UpdateProbeSessionHealth(p *m.ProbeSession) error {
+	sess, err := newSession(true, "probe_session")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	if err = updateProbeSessionHealth(sess, p); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func updateProbeSessionHealth(sess *session, p *m.ProbeSession) error {
+	sess.Where("org_id=? AND socket_id=?", p.OrgId, p.SocketId).Cols("health")
+	_, err := sess.Update(p)
+	return err
+}
+
+// UpdateProbeSessionClockSkew stores the latest clock skew measured for a
+// probe session.
+func UpdateProbeSessionClockSkew(p *m.ProbeSession) error {
+	sess, err := newSession(true, "probe_session")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	rawSql := "UPDATE probe_session SET clock_skew=? WHERE org_id=? AND socket_id=?"
+	if _, err := sess.Exec(rawSql, p.ClockSkew, p.OrgId, p.SocketId); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
 func GetProbeSessions(probeId int64, instance string) ([]m.ProbeSession, error) {
 	sess, err := newSession(false, "probe_session")
 	if err != nil {
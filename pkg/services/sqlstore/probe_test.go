@@ -136,6 +136,54 @@ func TestProbeSessions(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(session.Id, ShouldNotEqual, 0)
 
+		Convey("when saving a health report", func() {
+			session.Health = &m.ProbeHealth{
+				QueueDepth:      3,
+				ChecksExecuting: 2,
+				Failures:        1,
+				ClockSkew:       -12.5,
+				CheckTypes:      []m.CheckType{m.HTTP_CHECK, m.PING_CHECK},
+				Updated:         time.Now(),
+			}
+			err := UpdateProbeSessionHealth(&session)
+			So(err, ShouldBeNil)
+			Convey("the report should be stored with the session", func() {
+				sessions, err := GetProbeSessions(p.Id, "")
+				So(err, ShouldBeNil)
+				var saved *m.ProbeSession
+				for i := range sessions {
+					if sessions[i].Id == session.Id {
+						saved = &sessions[i]
+					}
+				}
+				So(saved, ShouldNotBeNil)
+				So(saved.Health, ShouldNotBeNil)
+				So(saved.Health.QueueDepth, ShouldEqual, 3)
+				So(saved.Health.ChecksExecuting, ShouldEqual, 2)
+				So(saved.Health.ClockSkew, ShouldEqual, -12.5)
+				So(saved.Updated.Unix(), ShouldEqual, session.Updated.Unix())
+				So(saved.Supports(m.HTTP_CHECK), ShouldBeTrue)
+				So(saved.Supports(m.DNS_CHECK), ShouldBeFalse)
+			})
+		})
+
+		Convey("when saving the clock skew", func() {
+			session.ClockSkew = 2500
+			err := UpdateProbeSessionClockSkew(&session)
+			So(err, ShouldBeNil)
+			sessions, err := GetProbeSessions(p.Id, "")
+			So(err, ShouldBeNil)
+			var saved *m.ProbeSession
+			for i := range sessions {
+				if sessions[i].Id == session.Id {
+					saved = &sessions[i]
+				}
+			}
+			So(saved, ShouldNotBeNil)
+			So(saved.ClockSkew, ShouldEqual, 2500)
+			So(saved.Updated.Unix(), ShouldEqual, session.Updated.Unix())
+		})
+
 		Convey("new session should set probe to online", func() {
 			probe, err := GetProbeById(p.Id, p.OrgId)
 			So(err, ShouldBeNil)
@@ -157,3 +205,24 @@ func TestProbeSessions(t *testing.T) {
 		})
 	})
 }
+
+func TestSessionForCheck(t *testing.T) {
+	Convey("When routing checks over probe sessions", t, func() {
+		sessions := []m.ProbeSession{
+			{SocketId: "http-only", Health: &m.ProbeHealth{CheckTypes: []m.CheckType{m.HTTP_CHECK}}},
+			{SocketId: "all"},
+		}
+		Convey("checks should be spread over the sessions supporting them", func() {
+			So(m.SessionForCheck(sessions, 2, m.HTTP_CHECK).SocketId, ShouldEqual, "http-only")
+			So(m.SessionForCheck(sessions, 3, m.HTTP_CHECK).SocketId, ShouldEqual, "all")
+		})
+		Convey("checks should only go to sessions supporting their type", func() {
+			So(m.SessionForCheck(sessions, 2, m.PING_CHECK).SocketId, ShouldEqual, "all")
+			So(m.SessionForCheck(sessions, 3, m.PING_CHECK).SocketId, ShouldEqual, "all")
+		})
+		Convey("no session should be returned when none support the type", func() {
+			So(m.SessionForCheck(sessions[:1], 2, m.PING_CHECK), ShouldBeNil)
+			So(m.SessionForCheck(nil, 2, m.PING_CHECK), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package sqlstore
+
+import (
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+)
+
+func GetProbeTokens(probeId, orgId int64) ([]m.ProbeToken, error) {
+	sess, err := newSession(false, "probe_token")
+	if err != nil {
+		return nil, err
+	}
+	return getProbeTokens(sess, probeId, orgId)
+}
+
+func getProbeTokens(sess *session, probeId, orgId int64) ([]m.ProbeToken, error) {
+	tokens := make([]m.ProbeToken, 0)
+	sess.Where("probe_id=? AND org_id=?", probeId, orgId).Asc("id")
+	err := sess.Find(&tokens)
+	return tokens, err
+}
+
+// AddProbeToken issues a new token for a probe.  It returns the token, which
+// can not be retrieved again as only its hash is stored.
+func AddProbeToken(probeId, orgId int64) (*m.ProbeTokenDTO, error) {
+	sess, err := newSession(true, "probe")
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Cleanup()
+
+	token, err := addProbeToken(sess, probeId, orgId)
+	if err != nil {
+		return nil, err
+	}
+	sess.Complete()
+	return token, nil
+}
+
+func addProbeToken(sess *session, probeId, orgId int64) (*m.ProbeTokenDTO, error) {
+	probe, err := getProbeById(sess, probeId, orgId)
+	if err != nil {
+		return nil, err
+	}
+	if probe.OrgId != orgId {
+		return nil, m.ErrProbeNotFound
+	}
+	token, err := m.NewProbeToken()
+	if err != nil {
+		return nil, err
+	}
+	t := &m.ProbeToken{
+		OrgId:   orgId,
+		ProbeId: probeId,
+		Hash:    m.HashProbeToken(token),
+		Created: time.Now(),
+	}
+	sess.Table("probe_token")
+	if _, err := sess.Insert(t); err != nil {
+		return nil, err
+	}
+	dto := t.ToDTO()
+	dto.Token = token
+	return &dto, nil
+}
+
+// DeleteProbeToken revokes a probe token.
+func DeleteProbeToken(id, probeId, orgId int64) error {
+	sess, err := newSession(true, "probe_token")
+	if err != nil {
+		return err
+	}
+	defer sess.Cleanup()
+
+	if err = deleteProbeToken(sess, id, probeId, orgId); err != nil {
+		return err
+	}
+	sess.Complete()
+	return nil
+}
+
+func deleteProbeToken(sess *session, id, probeId, orgId int64) error {
+	rawSql := "DELETE FROM probe_token WHERE id=? AND probe_id=? AND org_id=?"
+	res, err := sess.Exec(rawSql, id, probeId, orgId)
+	if err != nil {
+		return err
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return m.ErrProbeTokenNotFound
+	}
+	return nil
+}
+
+// GetProbeByToken returns the probe that a token was issued for.
+func GetProbeByToken(token string) (*m.ProbeDTO, error) {
+	sess, err := newSession(false, "probe_token")
+	if err != nil {
+		return nil, err
+	}
+	return getProbeByToken(sess, token)
+}
+
+func getProbeByToken(sess *session, token string) (*m.ProbeDTO, error) {
+	t := &m.ProbeToken{}
+	has, err := sess.Where("hash=?", m.HashProbeToken(token)).Get(t)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, m.ErrProbeTokenNotFound
+	}
+	sess.Table("probe")
+	return getProbeById(sess, t.ProbeId, t.OrgId)
+}
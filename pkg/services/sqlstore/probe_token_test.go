@@ -0,0 +1,61 @@
+package sqlstore
+
+import (
+	"testing"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProbeTokens(t *testing.T) {
+	InitTestDB(t)
+	probe := &m.ProbeDTO{
+		Name:    "tokenProbe",
+		OrgId:   1,
+		Enabled: true,
+	}
+	if err := AddProbe(probe); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("When issuing a probe token", t, func() {
+		token, err := AddProbeToken(probe.Id, 1)
+		So(err, ShouldBeNil)
+		So(token.Id, ShouldNotEqual, 0)
+		So(token.ProbeId, ShouldEqual, probe.Id)
+		So(m.IsProbeToken(token.Token), ShouldBeTrue)
+
+		Convey("only its hash should be stored", func() {
+			tokens, err := GetProbeTokens(probe.Id, 1)
+			So(err, ShouldBeNil)
+			So(len(tokens), ShouldBeGreaterThan, 0)
+			last := tokens[len(tokens)-1]
+			So(last.Id, ShouldEqual, token.Id)
+			So(last.Hash, ShouldEqual, m.HashProbeToken(token.Token))
+			So(last.Hash, ShouldNotContainSubstring, token.Token)
+		})
+		Convey("the token should identify the probe", func() {
+			p, err := GetProbeByToken(token.Token)
+			So(err, ShouldBeNil)
+			So(p.Id, ShouldEqual, probe.Id)
+			So(p.OrgId, ShouldEqual, 1)
+		})
+		Convey("unknown tokens should not identify a probe", func() {
+			_, err := GetProbeByToken(m.ProbeTokenPrefix + "unknown")
+			So(err, ShouldResemble, m.ErrProbeTokenNotFound)
+		})
+		Convey("other orgs should not be able to revoke it", func() {
+			err := DeleteProbeToken(token.Id, probe.Id, 2)
+			So(err, ShouldResemble, m.ErrProbeTokenNotFound)
+		})
+		Convey("when revoked it should no longer identify the probe", func() {
+			So(DeleteProbeToken(token.Id, probe.Id, 1), ShouldBeNil)
+			_, err := GetProbeByToken(token.Token)
+			So(err, ShouldResemble, m.ErrProbeTokenNotFound)
+		})
+	})
+	Convey("When issuing a token for a probe of another org", t, func() {
+		_, err := AddProbeToken(probe.Id, 2)
+		So(err, ShouldResemble, m.ErrProbeNotFound)
+	})
+}
@@ -1,7 +1,10 @@
 package sqlstore
 
 import (
+	"github.com/go-sql-driver/mysql"
 	"github.com/go-xorm/xorm"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 )
 
 type session struct {
@@ -38,3 +41,19 @@ func (sess *session) Cleanup() {
 		sess.Close()
 	}
 }
+
+// isUniqueConstraintError returns true if err is a violation of a unique or
+// primary key constraint, such as when inserting a row that another
+// transaction inserted first.
+func isUniqueConstraintError(err error) bool {
+	switch e := err.(type) {
+	case sqlite3.Error:
+		return e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	case *mysql.MySQLError:
+		// ER_DUP_ENTRY
+		return e.Number == 1062
+	case *pq.Error:
+		return e.Code.Name() == "unique_violation"
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package sqlstore
+
+import (
+	"fmt"
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+)
+
+func GetCheckStateHistory(query *m.GetCheckStateHistoryQuery) ([]m.CheckStateChange, error) {
+	sess, err := newSession(false, "check_state_history")
+	if err != nil {
+		return nil, err
+	}
+	return getCheckStateHistory(sess, query)
+}
+
+func getCheckStateHistory(sess *session, query *m.GetCheckStateHistoryQuery) ([]m.CheckStateChange, error) {
+	if query.OrgId == 0 {
+		return nil, fmt.Errorf("GetCheckStateHistoryQuery requires OrgId to be set.")
+	}
+	changes := make([]m.CheckStateChange, 0)
+	sess.Where("org_id=?", query.OrgId)
+	if query.CheckId != 0 {
+		sess.And("check_id=?", query.CheckId)
+	}
+	if query.EndpointId != 0 {
+		sess.And("endpoint_id=?", query.EndpointId)
+	}
+	if query.From != 0 {
+		sess.And("ts >= ?", time.Unix(query.From, 0))
+	}
+	if query.To != 0 {
+		sess.And("ts < ?", time.Unix(query.To, 0))
+	}
+	if query.Limit > 0 {
+		sess.Limit(query.Limit)
+	}
+	sess.Asc("ts", "id")
+	err := sess.Find(&changes)
+	return changes, err
+}
+
+func addCheckStateChange(sess *session, job *m.AlertingJob) error {
+	change := &m.CheckStateChange{
+		OrgId:      job.OrgId,
+		EndpointId: job.EndpointId,
+		CheckId:    job.Id,
+		CheckType:  m.CheckType(job.Type),
+		PrevState:  job.State,
+		State:      job.NewState,
+		Timestamp:  job.TimeExec,
+	}
+	_, err := sess.Table("check_state_history").Insert(change)
+	return err
+}
+
+func deleteCheckStateHistory(sess *session, checkId int64) error {
+	_, err := sess.Exec("DELETE FROM check_state_history WHERE check_id=?", checkId)
+	return err
+}
+
+// GetSLAReport computes the SLA of the check, or of all checks of the
+// endpoint, selected by the query.
+func GetSLAReport(query *m.GetSLAReportQuery) ([]*m.CheckSLA, error) {
+	sess, err := newSession(false, "check_state_history")
+	if err != nil {
+		return nil, err
+	}
+	return getSLAReport(sess, query)
+}
+
+func getSLAReport(sess *session, query *m.GetSLAReportQuery) ([]*m.CheckSLA, error) {
+	var checks []m.Check
+	if query.CheckId != 0 {
+		sess.Table("check")
+		check, err := getCheckById(sess, query.OrgId, query.CheckId)
+		if err != nil {
+			return nil, err
+		}
+		checks = []m.Check{*check}
+	} else {
+		sess.Table("endpoint")
+		endpoint, err := getEndpointById(sess, query.OrgId, query.EndpointId)
+		if err != nil {
+			return nil, err
+		}
+		checks = endpoint.Checks
+	}
+
+	from := time.Unix(query.From, 0)
+	to := time.Unix(query.To, 0)
+	report := make([]*m.CheckSLA, 0, len(checks))
+	for i := range checks {
+		check := &checks[i]
+		sess.Table("check_state_history")
+		changes, err := getCheckStateHistory(sess, &m.GetCheckStateHistoryQuery{
+			OrgId:   query.OrgId,
+			CheckId: check.Id,
+			From:    query.From,
+			To:      query.To,
+		})
+		if err != nil {
+			return nil, err
+		}
+		initial, err := getCheckStateAt(sess, check, changes, from)
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, m.NewCheckSLA(check, initial, changes, from, to))
+	}
+	return report, nil
+}
+
+// getCheckStateAt returns the state the check was in at time t.  changes are
+// the state changes of the check from t onwards.
+func getCheckStateAt(sess *session, check *m.Check, changes []m.CheckStateChange, t time.Time) (m.CheckEvalResult, error) {
+	last := &m.CheckStateChange{}
+	has, err := sess.Table("check_state_history").Where("org_id=? AND check_id=? AND ts < ?", check.OrgId, check.Id, t).Desc("ts", "id").Get(last)
+	if err != nil {
+		return m.EvalResultUnknown, err
+	}
+	if has {
+		return last.State, nil
+	}
+	// history may not have been recorded at t, in which case the state
+	// before the first change in the range is the best we know.
+	if len(changes) > 0 {
+		return changes[0].PrevState, nil
+	}
+	if !check.StateChange.After(t) {
+		return check.State, nil
+	}
+	return m.EvalResultUnknown, nil
+}
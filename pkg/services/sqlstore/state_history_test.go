@@ -0,0 +1,175 @@
+package sqlstore
+
+import (
+	"testing"
+	"time"
+
+	m "github.com/raintank/worldping-api/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheckStateHistory(t *testing.T) {
+	InitTestDB(t)
+	populateProbes(t)
+	e := testEndpoint("history.example.com")
+	if err := AddEndpoint(e); err != nil {
+		t.Fatal(err)
+	}
+	checkId := e.Checks[0].Id
+	start := time.Now().Add(time.Minute).Truncate(time.Second)
+	state := m.CheckEvalResult(m.EvalResultUnknown)
+
+	// record OK -> CRIT -> OK, one minute apart.
+	for i, s := range []m.CheckEvalResult{m.EvalResultOK, m.EvalResultCrit, m.EvalResultCrit, m.EvalResultOK} {
+		job := &m.AlertingJob{
+			CheckForAlertDTO: &m.CheckForAlertDTO{Id: checkId, OrgId: 1, EndpointId: e.Id, Type: string(m.PING_CHECK), State: state},
+			NewState:         s,
+			TimeExec:         start.Add(time.Duration(i) * time.Minute),
+		}
+		if _, err := BatchUpdateCheckState([]*m.AlertingJob{job}); err != nil {
+			t.Fatal(err)
+		}
+		state = s
+	}
+
+	Convey("When getting check state history", t, func() {
+		history, err := GetCheckStateHistory(&m.GetCheckStateHistoryQuery{OrgId: 1, CheckId: checkId})
+		So(err, ShouldBeNil)
+		So(history, ShouldHaveLength, 3)
+		So(history[0].PrevState, ShouldEqual, m.EvalResultUnknown)
+		So(history[0].State, ShouldEqual, m.EvalResultOK)
+		So(history[1].PrevState, ShouldEqual, m.EvalResultOK)
+		So(history[1].State, ShouldEqual, m.EvalResultCrit)
+		So(history[1].Timestamp.Unix(), ShouldEqual, start.Add(time.Minute).Unix())
+		So(history[2].State, ShouldEqual, m.EvalResultOK)
+		So(history[2].Timestamp.Unix(), ShouldEqual, start.Add(3*time.Minute).Unix())
+		So(history[2].EndpointId, ShouldEqual, e.Id)
+		So(history[2].CheckType, ShouldEqual, m.PING_CHECK)
+
+		Convey("it should be filtered by time range", func() {
+			history, err := GetCheckStateHistory(&m.GetCheckStateHistoryQuery{
+				OrgId:   1,
+				CheckId: checkId,
+				From:    start.Add(time.Minute).Unix(),
+				To:      start.Add(3 * time.Minute).Unix(),
+			})
+			So(err, ShouldBeNil)
+			So(history, ShouldHaveLength, 1)
+			So(history[0].State, ShouldEqual, m.EvalResultCrit)
+		})
+		Convey("it should be returned for the endpoint", func() {
+			history, err := GetCheckStateHistory(&m.GetCheckStateHistoryQuery{OrgId: 1, EndpointId: e.Id})
+			So(err, ShouldBeNil)
+			So(history, ShouldHaveLength, 3)
+		})
+		Convey("it should not be visible to other orgs", func() {
+			history, err := GetCheckStateHistory(&m.GetCheckStateHistoryQuery{OrgId: 2, CheckId: checkId})
+			So(err, ShouldBeNil)
+			So(history, ShouldHaveLength, 0)
+		})
+	})
+
+	Convey("When the endpoint is deleted", t, func() {
+		err := DeleteEndpoint(1, e.Id)
+		So(err, ShouldBeNil)
+		history, err := GetCheckStateHistory(&m.GetCheckStateHistoryQuery{OrgId: 1, CheckId: checkId})
+		So(err, ShouldBeNil)
+		So(history, ShouldHaveLength, 0)
+	})
+}
+
+func TestSLAReport(t *testing.T) {
+	InitTestDB(t)
+	populateProbes(t)
+	e := testEndpoint("sla.example.com")
+	if err := AddEndpoint(e); err != nil {
+		t.Fatal(err)
+	}
+	checkId := e.Checks[0].Id
+	start := time.Now().Add(time.Minute).Truncate(time.Second)
+	state := m.CheckEvalResult(m.EvalResultUnknown)
+
+	// OK at start, CRIT for 2 minutes from start+1m.
+	for _, change := range []struct {
+		state  m.CheckEvalResult
+		offset time.Duration
+	}{
+		{m.EvalResultOK, 0},
+		{m.EvalResultCrit, time.Minute},
+		{m.EvalResultOK, 3 * time.Minute},
+	} {
+		job := &m.AlertingJob{
+			CheckForAlertDTO: &m.CheckForAlertDTO{Id: checkId, OrgId: 1, EndpointId: e.Id, Type: string(m.PING_CHECK), State: state},
+			NewState:         change.state,
+			TimeExec:         start.Add(change.offset),
+		}
+		if _, err := BatchUpdateCheckState([]*m.AlertingJob{job}); err != nil {
+			t.Fatal(err)
+		}
+		state = change.state
+	}
+
+	Convey("When getting the SLA report of a check", t, func() {
+		report, err := GetSLAReport(&m.GetSLAReportQuery{
+			OrgId:   1,
+			CheckId: checkId,
+			From:    start.Unix(),
+			To:      start.Add(10 * time.Minute).Unix(),
+		})
+		So(err, ShouldBeNil)
+		So(report, ShouldHaveLength, 1)
+		So(report[0].CheckId, ShouldEqual, checkId)
+		So(*report[0].Uptime, ShouldAlmostEqual, 80.0)
+		So(report[0].Incidents, ShouldEqual, 1)
+		So(report[0].MTTR, ShouldEqual, 120)
+		So(report[0].Downtime, ShouldEqual, 120)
+		So(report[0].Unknown, ShouldEqual, 0)
+
+		Convey("state at the start of the range should come from earlier history", func() {
+			report, err := GetSLAReport(&m.GetSLAReportQuery{
+				OrgId:   1,
+				CheckId: checkId,
+				From:    start.Add(2 * time.Minute).Unix(),
+				To:      start.Add(4 * time.Minute).Unix(),
+			})
+			So(err, ShouldBeNil)
+			So(*report[0].Uptime, ShouldAlmostEqual, 50.0)
+			So(report[0].Incidents, ShouldEqual, 1)
+			So(report[0].MTTR, ShouldEqual, 60)
+			So(report[0].Downtime, ShouldEqual, 60)
+		})
+		Convey("time before the first state should be unknown", func() {
+			report, err := GetSLAReport(&m.GetSLAReportQuery{
+				OrgId:   1,
+				CheckId: checkId,
+				From:    start.Add(-10 * time.Minute).Unix(),
+				To:      start.Add(10 * time.Minute).Unix(),
+			})
+			So(err, ShouldBeNil)
+			So(*report[0].Uptime, ShouldAlmostEqual, 80.0)
+			So(report[0].Unknown, ShouldEqual, 600)
+		})
+		Convey("endpoint report should include all checks", func() {
+			report, err := GetSLAReport(&m.GetSLAReportQuery{
+				OrgId:      1,
+				EndpointId: e.Id,
+				From:       start.Unix(),
+				To:         start.Add(10 * time.Minute).Unix(),
+			})
+			So(err, ShouldBeNil)
+			So(report, ShouldHaveLength, 1)
+			So(report[0].Downtime, ShouldEqual, 120)
+		})
+		Convey("unknown check should return not found", func() {
+			_, err := GetSLAReport(&m.GetSLAReportQuery{OrgId: 2, CheckId: checkId, From: 1, To: 2})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("When the state of a check is never known", t, func() {
+		sla := m.NewCheckSLA(&e.Checks[0], m.EvalResultUnknown, nil, start, start.Add(time.Hour))
+		So(sla.Uptime, ShouldBeNil)
+		So(sla.Unknown, ShouldEqual, 3600)
+		So(sla.Incidents, ShouldEqual, 0)
+	})
+}
@@ -93,5 +93,29 @@ func getUsage(sess *session) (*m.Usage, error) {
 		usage.Checks.DNS.PerOrg[strconv.FormatInt(row.OrgId, 10)] = row.Count
 	}
 
+	rows = rows[:0]
+	err = sess.Sql("SELECT org_id, COUNT(*) as count FROM `check` where type='tcp' GROUP BY org_id").Find(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		usage.Checks.Total += row.Count
+		usage.Checks.TCP.Total += row.Count
+		usage.Checks.TCP.PerOrg[strconv.FormatInt(row.OrgId, 10)] = row.Count
+	}
+
+	rows = rows[:0]
+	err = sess.Sql("SELECT org_id, COUNT(*) as count FROM `check` where type='cert' GROUP BY org_id").Find(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		usage.Checks.Total += row.Count
+		usage.Checks.CERT.Total += row.Count
+		usage.Checks.CERT.PerOrg[strconv.FormatInt(row.OrgId, 10)] = row.Count
+	}
+
 	return usage, nil
 }
@@ -86,6 +86,28 @@ func TestUsageQuery(t *testing.T) {
 				},
 			},
 		}
+		if i%2 == 0 {
+			e.Checks = append(e.Checks, m.Check{
+				Route: &m.CheckRoute{
+					Type: m.RouteByIds,
+					Config: map[string]interface{}{
+						"ids": []int64{1},
+					},
+				},
+				Frequency: 60,
+				Type:      m.TCP_CHECK,
+				Enabled:   true,
+				Settings: map[string]interface{}{
+					"host":    fmt.Sprintf("www%d.google.com", i),
+					"port":    25,
+					"timeout": 5,
+				},
+				HealthSettings: &m.CheckHealthSettings{
+					NumProbes: 1,
+					Steps:     3,
+				},
+			})
+		}
 		err := AddEndpoint(e)
 		if err != nil {
 			t.Fatal(err)
@@ -105,16 +127,18 @@ func TestUsageQuery(t *testing.T) {
 			So(usage.Probes.PerOrg["1"], ShouldEqual, 4)
 		})
 		Convey("checks data should be accurate", func() {
-			So(usage.Checks.Total, ShouldEqual, 12)
+			So(usage.Checks.Total, ShouldEqual, 15)
 			So(usage.Checks.HTTP.Total, ShouldEqual, 6)
 			So(usage.Checks.HTTPS.Total, ShouldEqual, 0)
 			So(usage.Checks.PING.Total, ShouldEqual, 6)
 			So(usage.Checks.DNS.Total, ShouldEqual, 0)
+			So(usage.Checks.TCP.Total, ShouldEqual, 3)
 			So(usage.Endpoints.PerOrg["1"], ShouldEqual, 2)
 			So(len(usage.Checks.HTTP.PerOrg), ShouldEqual, 3)
 			So(len(usage.Checks.HTTPS.PerOrg), ShouldEqual, 0)
 			So(len(usage.Checks.PING.PerOrg), ShouldEqual, 3)
 			So(len(usage.Checks.DNS.PerOrg), ShouldEqual, 0)
+			So(len(usage.Checks.TCP.PerOrg), ShouldEqual, 3)
 			So(usage.Checks.HTTP.PerOrg["1"], ShouldEqual, 2)
 		})
 
@@ -2,6 +2,7 @@ package setting
 
 import (
 	"net/url"
+	"time"
 
 	"github.com/raintank/worldping-api/pkg/log"
 )
@@ -9,6 +10,11 @@ import (
 type AlertingSettings struct {
 	Enabled              bool
 	Topic                string
+	Transport            string
+	RedisAddr            string
+	RedisPassword        string
+	RedisDb              int
+	RedisShards          int
 	Distributed          bool
 	TickQueueSize        int
 	InternalJobQueueSize int
@@ -17,6 +23,26 @@ type AlertingSettings struct {
 	EnableWorker         bool
 	Executors            int
 	GraphiteUrl          string
+	Datasource           string
+	PrometheusUrl        string
+
+	MemoryBufferSize      int
+	MemoryBufferRetention time.Duration
+
+	NotificationRetries    int
+	NotificationRetryDelay time.Duration
+	NotificationTimeout    time.Duration
+
+	FlapThreshold int
+	FlapWindow    time.Duration
+
+	EscalationInterval time.Duration
+
+	SchedulerLeaseTTL time.Duration
+
+	Backfill       bool
+	BackfillMaxAge time.Duration
+	BackfillRate   int
 }
 
 func readAlertingSettings() {
@@ -24,6 +50,11 @@ func readAlertingSettings() {
 	Alerting.Enabled = alerting.Key("enabled").MustBool(false)
 	Alerting.Distributed = alerting.Key("distributed").MustBool(false)
 	Alerting.Topic = alerting.Key("topic").MustString("worldping-alerts")
+	Alerting.Transport = alerting.Key("transport").In("kafka", []string{"kafka", "redis"})
+	Alerting.RedisAddr = alerting.Key("redis_addr").MustString("localhost:6379")
+	Alerting.RedisPassword = alerting.Key("redis_password").String()
+	Alerting.RedisDb = alerting.Key("redis_db").MustInt(0)
+	Alerting.RedisShards = alerting.Key("redis_shards").MustInt(16)
 	Alerting.TickQueueSize = alerting.Key("tickqueue_size").MustInt(0)
 	Alerting.InternalJobQueueSize = alerting.Key("internal_jobqueue_size").MustInt(0)
 
@@ -41,8 +72,44 @@ func readAlertingSettings() {
 		log.Fatal(4, "Invalid graphite_url(%s): %s", Alerting.GraphiteUrl, err)
 	}
 
-	if Alerting.Distributed && !Kafka.Enabled {
+	Alerting.Datasource = alerting.Key("datasource").In("graphite", []string{"graphite", "prometheus", "memory"})
+	Alerting.PrometheusUrl = alerting.Key("prometheus_url").MustString("http://localhost:9090/")
+	if Alerting.PrometheusUrl[len(Alerting.PrometheusUrl)-1] != '/' {
+		Alerting.PrometheusUrl += "/"
+	}
+	_, err = url.Parse(Alerting.PrometheusUrl)
+	if err != nil {
+		log.Fatal(4, "Invalid prometheus_url(%s): %s", Alerting.PrometheusUrl, err)
+	}
+
+	Alerting.MemoryBufferSize = alerting.Key("memory_buffer_size").MustInt(60)
+	Alerting.MemoryBufferRetention = time.Duration(alerting.Key("memory_buffer_retention").MustInt(3600)) * time.Second
+
+	Alerting.NotificationRetries = alerting.Key("notification_retries").MustInt(3)
+	Alerting.NotificationRetryDelay = time.Duration(alerting.Key("notification_retry_delay").MustInt(5)) * time.Second
+	Alerting.NotificationTimeout = time.Duration(alerting.Key("notification_timeout").MustInt(10)) * time.Second
+
+	Alerting.FlapThreshold = alerting.Key("flap_threshold").MustInt(5)
+	Alerting.FlapWindow = time.Duration(alerting.Key("flap_window").MustInt(3600)) * time.Second
+
+	Alerting.EscalationInterval = time.Duration(alerting.Key("escalation_interval").MustInt(60)) * time.Second
+	Alerting.SchedulerLeaseTTL = time.Duration(alerting.Key("scheduler_lease_ttl").MustInt(30)) * time.Second
+	if Alerting.SchedulerLeaseTTL < 3*time.Second {
+		log.Fatal(4, "scheduler_lease_ttl must be at least 3 seconds.")
+	}
+
+	Alerting.Backfill = alerting.Key("backfill").MustBool(false)
+	Alerting.BackfillMaxAge = time.Duration(alerting.Key("backfill_max_age").MustInt(3600)) * time.Second
+	Alerting.BackfillRate = alerting.Key("backfill_rate").MustInt(10)
+	if Alerting.Backfill && Alerting.BackfillRate < 2 {
+		log.Fatal(4, "backfill_rate must be at least 2 to catch up with missed seconds.")
+	}
+
+	if Alerting.Distributed && Alerting.Transport == "kafka" && !Kafka.Enabled {
 		log.Fatal(4, "Kafka must be enabled to use distributed alerting.")
 
 	}
+	if Alerting.Distributed && Alerting.Datasource == "memory" {
+		log.Fatal(4, "The memory datasource can not be used with distributed alerting.")
+	}
 }
@@ -95,6 +95,8 @@ var (
 
 	// QUOTA
 	Quota QuotaSettings
+
+	Probes ProbeSettings
 )
 
 type CommandLineArgs struct {
@@ -378,6 +380,7 @@ func NewConfigContext(args *CommandLineArgs) error {
 	readAlertingSettings()
 	readSmtpSettings()
 	readQuotaSettings()
+	readProbeSettings()
 	return nil
 }
 
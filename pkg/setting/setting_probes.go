@@ -0,0 +1,23 @@
+package setting
+
+import (
+	"time"
+
+	"github.com/raintank/worldping-api/pkg/log"
+)
+
+type ProbeSettings struct {
+	ClockSyncInterval time.Duration
+	MaxClockSkew      time.Duration
+	ClockSkewAction   string
+}
+
+func readProbeSettings() {
+	sec := Cfg.Section("probes")
+	Probes.ClockSyncInterval = time.Duration(sec.Key("clock_sync_interval").MustInt(60)) * time.Second
+	if Probes.ClockSyncInterval < time.Second {
+		log.Fatal(4, "clock_sync_interval must be at least 1 second.")
+	}
+	Probes.MaxClockSkew = time.Duration(sec.Key("max_clock_skew").MustInt(0)) * time.Second
+	Probes.ClockSkewAction = sec.Key("clock_skew_action").In("reject", []string{"reject", "correct"})
+}